@@ -0,0 +1,156 @@
+package calendar
+
+import (
+	"sync"
+	"time"
+)
+
+// IST is the Indian Standard Time zone used by the exchanges and by Kite.
+var IST = time.FixedZone("IST", 5*60*60+30*60)
+
+const (
+	// SessionOpenHour and SessionOpenMinute mark the start of the regular equity session.
+	SessionOpenHour   = 9
+	SessionOpenMinute = 15
+	// SessionCloseHour and SessionCloseMinute mark the end of the regular equity session.
+	SessionCloseHour   = 15
+	SessionCloseMinute = 30
+)
+
+// nseHolidays lists NSE trading holidays that fall on weekdays, as published
+// in the exchange circulars. Extra closures can be added with AddHolidays.
+var nseHolidays = []string{
+	// 2023
+	"2023-01-26", "2023-03-07", "2023-03-30", "2023-04-04", "2023-04-07", "2023-04-14",
+	"2023-05-01", "2023-06-29", "2023-08-15", "2023-09-19", "2023-10-02", "2023-10-24",
+	"2023-11-14", "2023-11-27", "2023-12-25",
+	// 2024
+	"2024-01-22", "2024-01-26", "2024-03-08", "2024-03-25", "2024-03-29", "2024-04-11",
+	"2024-04-17", "2024-05-01", "2024-05-20", "2024-06-17", "2024-07-17", "2024-08-15",
+	"2024-10-02", "2024-11-01", "2024-11-15", "2024-11-20", "2024-12-25",
+	// 2025
+	"2025-02-26", "2025-03-14", "2025-03-31", "2025-04-10", "2025-04-14", "2025-04-18",
+	"2025-05-01", "2025-08-15", "2025-08-27", "2025-10-02", "2025-10-21", "2025-10-22",
+	"2025-11-05", "2025-12-25",
+	// 2026
+	"2026-01-26", "2026-03-03", "2026-03-26", "2026-03-31", "2026-04-03", "2026-04-14",
+	"2026-05-01", "2026-05-28", "2026-06-26", "2026-09-14", "2026-10-02", "2026-10-20",
+	"2026-11-10", "2026-11-24", "2026-12-25",
+}
+
+var (
+	holidaysOnce sync.Once
+	holidaysMu   sync.RWMutex
+	holidays     map[string]bool
+)
+
+func loadHolidays() {
+	holidaysOnce.Do(func() {
+		holidays = make(map[string]bool, len(nseHolidays))
+		for _, d := range nseHolidays {
+			holidays[d] = true
+		}
+	})
+}
+
+// AddHolidays registers additional non-trading days (e.g. from config).
+func AddHolidays(days ...time.Time) {
+	loadHolidays()
+	holidaysMu.Lock()
+	defer holidaysMu.Unlock()
+	for _, d := range days {
+		holidays[d.In(IST).Format("2006-01-02")] = true
+	}
+}
+
+// Date returns midnight IST of the calendar day containing t.
+func Date(t time.Time) time.Time {
+	t = t.In(IST)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, IST)
+}
+
+// IsHoliday reports whether the day containing t is an exchange holiday.
+func IsHoliday(t time.Time) bool {
+	loadHolidays()
+	holidaysMu.RLock()
+	defer holidaysMu.RUnlock()
+	return holidays[t.In(IST).Format("2006-01-02")]
+}
+
+// IsTradingDay reports whether the exchange is open on the day containing t.
+func IsTradingDay(t time.Time) bool {
+	switch t.In(IST).Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+	return !IsHoliday(t)
+}
+
+// SessionOpen returns the session open time on the day containing t.
+func SessionOpen(t time.Time) time.Time {
+	return Date(t).Add(SessionOpenHour*time.Hour + SessionOpenMinute*time.Minute)
+}
+
+// SessionClose returns the session close time on the day containing t.
+func SessionClose(t time.Time) time.Time {
+	return Date(t).Add(SessionCloseHour*time.Hour + SessionCloseMinute*time.Minute)
+}
+
+// IsSessionOpen reports whether the market is trading at now.
+func IsSessionOpen(now time.Time) bool {
+	return IsTradingDay(now) && !now.Before(SessionOpen(now)) && now.Before(SessionClose(now))
+}
+
+// PreviousTradingDay returns the last trading day strictly before the day containing t.
+func PreviousTradingDay(t time.Time) time.Time {
+	d := Date(t).AddDate(0, 0, -1)
+	for !IsTradingDay(d) {
+		d = d.AddDate(0, 0, -1)
+	}
+	return d
+}
+
+// LastTradingDay returns the most recent trading day whose session has closed at now.
+func LastTradingDay(now time.Time) time.Time {
+	if IsTradingDay(now) && !now.Before(SessionClose(now)) {
+		return Date(now)
+	}
+	return PreviousTradingDay(now)
+}
+
+// TradingDays counts the trading days between from and to, inclusive of both days.
+func TradingDays(from, to time.Time) int {
+	count := 0
+	for d := Date(from); !d.After(Date(to)); d = d.AddDate(0, 0, 1) {
+		if IsTradingDay(d) {
+			count++
+		}
+	}
+	return count
+}
+
+// HolidaysKnown reports whether the built-in holiday list covers every year
+// from the day containing from to the day containing to. Outside those years
+// only weekends are skipped, so trading days are overcounted.
+func HolidaysKnown(from, to time.Time) bool {
+	first, _ := time.Parse("2006-01-02", nseHolidays[0])
+	last, _ := time.Parse("2006-01-02", nseHolidays[len(nseHolidays)-1])
+	return Date(from).Year() >= first.Year() && Date(to).Year() <= last.Year()
+}
+
+// AddTradingDays moves n trading days forward (or backward when n is negative)
+// from the day containing t. The starting day itself need not be a trading day.
+func AddTradingDays(t time.Time, n int) time.Time {
+	d := Date(t)
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	for n > 0 {
+		d = d.AddDate(0, 0, step)
+		if IsTradingDay(d) {
+			n--
+		}
+	}
+	return d
+}
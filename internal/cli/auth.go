@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+	"zerodha-connect/internal/config"
+	"zerodha-connect/internal/kite"
+	"zerodha-connect/internal/logger"
+
+	"github.com/spf13/cobra"
+)
+
+var forceLogin bool
+
+// authCmd represents the parent auth command
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage the Zerodha login session",
+	Long: `Manage the Zerodha Kite login session.
+
+This command has three subcommands:
+- login: Log in through the browser and store the access token
+- status: Show the stored session and check it against the API
+- logout: Invalidate the session and remove the stored token
+
+All other commands use the stored session and never start a login themselves.
+
+Use "zerodha-connect auth [subcommand] --help" for more information.`,
+}
+
+// authLoginCmd represents the auth login command
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to Zerodha and store the access token",
+	Long: `Log in to Zerodha through the browser and store the resulting access token.
+
+Kite access tokens expire every day at 06:00 IST, so this needs to be run once
+per trading day before fetching data.
+
+Examples:
+  # Log in using API credentials from config file
+  zerodha-connect auth login
+
+  # Log in again even if the stored token is still valid
+  zerodha-connect auth login --force`,
+	RunE: runAuthLogin,
+}
+
+// authStatusCmd represents the auth status command
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the stored session and verify it",
+	Long: `Show the user, token age and expected expiry of the stored session, and verify
+the token against the Kite API.`,
+	RunE: runAuthStatus,
+}
+
+// authLogoutCmd represents the auth logout command
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Invalidate the session and remove the stored token",
+	Long: `Invalidate the current access token through the Kite API and remove it from
+local storage.`,
+	RunE: runAuthLogout,
+}
+
+func runAuthLogin(cmd *cobra.Command, args []string) error {
+	conf, err := loadAuthConfig()
+	if err != nil {
+		return err
+	}
+	kiteClient := kite.NewClientWithConfigPath(conf, newAuthLogger(), configFile)
+
+	if !forceLogin {
+		if err := kiteClient.EnsureSession(); err == nil {
+			session, _ := kiteClient.CachedSession()
+			fmt.Printf("✅ Already logged in%s (token expires %s)\n", sessionUser(session), formatExpiry(session))
+			fmt.Println("   Use --force to log in again")
+			return nil
+		}
+	}
+
+	session, err := kiteClient.Login()
+	if err != nil {
+		return fmt.Errorf("login failed: %v", err)
+	}
+
+	fmt.Printf("✅ Logged in%s\n", sessionUser(session))
+	fmt.Printf("   Token expires: %s\n", formatExpiry(session))
+	return nil
+}
+
+func runAuthStatus(cmd *cobra.Command, args []string) error {
+	conf, err := loadAuthConfig()
+	if err != nil {
+		return err
+	}
+	kiteClient := kite.NewClientWithConfigPath(conf, newAuthLogger(), configFile)
+
+	session, err := kiteClient.CachedSession()
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		fmt.Println("❌ Not logged in")
+		fmt.Printf("   Run '%s auth login' to authenticate\n", appName)
+		return nil
+	}
+
+	now := time.Now()
+	fmt.Println("🔑 Session:")
+	if session.UserID != "" {
+		fmt.Printf("   User ID:    %s\n", session.UserID)
+	}
+	if session.UserName != "" {
+		fmt.Printf("   User Name:  %s\n", session.UserName)
+	}
+	if session.LoginTime.IsZero() {
+		fmt.Println("   Logged in:  unknown (token stored in config file)")
+	} else {
+		fmt.Printf("   Logged in:  %s (%s ago)\n", session.LoginTime.In(calendar.IST).Format("2006-01-02 15:04 MST"),
+			session.Age(now).Truncate(time.Minute))
+	}
+	fmt.Printf("   Expires:    %s\n", formatExpiry(session))
+
+	if err := kiteClient.EnsureSession(); err != nil {
+		fmt.Printf("   ❌ Token check: %v\n", err)
+		fmt.Printf("   Run '%s auth login' to authenticate\n", appName)
+		return nil
+	}
+	fmt.Println("   ✅ Token check: valid")
+	return nil
+}
+
+func runAuthLogout(cmd *cobra.Command, args []string) error {
+	conf, err := loadAuthConfig()
+	if err != nil {
+		return err
+	}
+	kiteClient := kite.NewClientWithConfigPath(conf, newAuthLogger(), configFile)
+
+	if err := kiteClient.Logout(); err != nil {
+		var authErr *kite.AuthenticationError
+		if errors.As(err, &authErr) && authErr.Type == kite.AuthErrorNotLoggedIn {
+			fmt.Println("ℹ️  Not logged in, nothing to do")
+			return nil
+		}
+		return fmt.Errorf("logout failed: %v", err)
+	}
+
+	fmt.Println("✅ Logged out")
+	return nil
+}
+
+// requireSession verifies the stored session and turns authentication failures
+// into a consistent error that points the user at "auth login".
+func requireSession(kiteClient *kite.Client) error {
+	err := kiteClient.EnsureSession()
+	if err == nil {
+		return nil
+	}
+	var authErr *kite.AuthenticationError
+	if errors.As(err, &authErr) {
+		switch authErr.Type {
+		case kite.AuthErrorNotLoggedIn:
+			return fmt.Errorf("not logged in. Run '%s auth login' first", appName)
+		case kite.AuthErrorTokenExpired:
+			return fmt.Errorf("token expired (%v). Run '%s auth login' to log in again", err, appName)
+		}
+	}
+	return fmt.Errorf("authentication failed: %v", err)
+}
+
+func loadAuthConfig() (*config.Config, error) {
+	conf, err := loadConfig(configFile, true, credentialFlags())
+	if err != nil {
+		return nil, err
+	}
+	if err := requireCredentials(conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+func newAuthLogger() *log.Logger {
+	if verbose {
+		appLogger := logger.New("auth.log")
+		appLogger.Println("🔧 Verbose mode enabled")
+		return appLogger
+	}
+	return logger.NewSilent()
+}
+
+func sessionUser(session *kite.Session) string {
+	if session == nil || session.UserID == "" {
+		return ""
+	}
+	return " as " + session.UserID
+}
+
+func formatExpiry(session *kite.Session) string {
+	if session == nil {
+		return "unknown"
+	}
+	expiry := session.ExpiresAt()
+	if expiry.IsZero() {
+		return "unknown (06:00 IST on the day after login)"
+	}
+	return expiry.Format("2006-01-02 15:04 MST")
+}
+
+func init() {
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authStatusCmd)
+	authCmd.AddCommand(authLogoutCmd)
+
+	authLoginCmd.Flags().BoolVar(&forceLogin, "force", false, "log in again even if the stored token is valid")
+}
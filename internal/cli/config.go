@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"zerodha-connect/internal/config"
+)
+
+// loadConfig builds the effective configuration for a command using the
+// precedence chain flags > environment > config file > defaults. When
+// optional is true the command can run without a config file.
+func loadConfig(path string, optional bool, flags config.Overrides) (*config.Config, error) {
+	conf, err := config.Resolve(path, optional, flags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file '%s': %v", path, err)
+	}
+	warnOutdatedConfig(conf, path)
+	return conf, nil
+}
+
+// warnOutdatedConfig tells the user when a config file was migrated in memory.
+// It writes to stderr so that it does not mix with data printed by query.
+func warnOutdatedConfig(conf *config.Config, path string) {
+	if conf.MigratedFrom == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "⚠️  %s uses config version %d (current: %d). Run '%s config migrate -c %s' to upgrade it.\n",
+		path, conf.MigratedFrom, config.CurrentVersion, appName, path)
+	if verbose {
+		for _, note := range conf.MigrationNotes {
+			fmt.Fprintf(os.Stderr, "   - %s\n", note)
+		}
+	}
+}
+
+// credentialFlags returns the overrides for the global credential flags.
+func credentialFlags() config.Overrides {
+	return config.Overrides{
+		APIKey:    apiKey,
+		APISecret: apiSecret,
+	}
+}
+
+// requireCredentials checks that the effective config has API credentials.
+func requireCredentials(conf *config.Config) error {
+	if conf.APIKey == "" || conf.APISecret == "" {
+		return fmt.Errorf("API credentials required. Provide them via:\n" +
+			"  • Command flags: --api-key and --api-secret\n" +
+			"  • Environment: " + config.EnvPrefix + "API_KEY and " + config.EnvPrefix + "API_SECRET\n" +
+			"  • Config file: api_key and api_secret fields (values may use ${VAR} or file:path)")
+	}
+	return nil
+}
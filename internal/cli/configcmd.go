@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+
+	"zerodha-connect/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var migrateDryRun bool
+
+// configCmd represents the parent config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the configuration file",
+	Long: `Manage the configuration file.
+
+Use "zerodha-connect config [subcommand] --help" for more information.`,
+}
+
+// configMigrateCmd represents the config migrate command
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the config file to the current schema version",
+	Long: `Upgrade the config file to the current schema version.
+
+Older config files are migrated in memory every time they are loaded; this
+command rewrites the file so the migration is permanent. Comments and ${VAR}
+or file: references are preserved, and the original file is kept as
+<config>.bak.
+
+Examples:
+  # Show the migrated config without writing it
+  zerodha-connect config migrate --dry-run
+
+  # Migrate a specific config file
+  zerodha-connect config migrate --config my-config.yaml`,
+	RunE: runConfigMigrate,
+}
+
+func runConfigMigrate(cmd *cobra.Command, args []string) error {
+	out, from, notes, err := config.MigrateFile(configFile, migrateDryRun)
+	if err != nil {
+		return fmt.Errorf("migration failed: %v", err)
+	}
+
+	if from == config.CurrentVersion {
+		fmt.Printf("✅ %s is already at config version %d\n", configFile, config.CurrentVersion)
+		return nil
+	}
+
+	fmt.Printf("🔄 Migrating %s from version %d to %d\n", configFile, from, config.CurrentVersion)
+	for _, note := range notes {
+		fmt.Printf("   - %s\n", note)
+	}
+
+	if migrateDryRun {
+		fmt.Println("\n📄 Migrated config (not written):")
+		fmt.Println(string(out))
+		return nil
+	}
+
+	fmt.Printf("✅ Migrated config written to %s (backup: %s.bak)\n", configFile, configFile)
+	return nil
+}
+
+func init() {
+	configCmd.AddCommand(configMigrateCmd)
+
+	configMigrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "print the migrated config without writing it")
+}
@@ -0,0 +1,434 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"zerodha-connect/internal/logger"
+	"zerodha-connect/internal/storage"
+
+	"github.com/spf13/cobra"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// convertBatchSize is the number of candles handed to the target store per write.
+const convertBatchSize = 50000
+
+var (
+	// Convert command flags
+	convertFromType    string
+	convertFromPath    string
+	convertToType      string
+	convertToPath      string
+	convertCompression string
+	convertTemplate    string
+	convertTimezone    string
+	convertInstruments []string
+	convertExchange    string
+	convertInterval    string
+	convertRestart     bool
+)
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Copy stored data from one storage backend to another",
+	Long: `Copy every stored instrument and interval from one storage backend to another
+without refetching anything from the API.
+
+Candles are streamed series by series. Compressed source files (.gz, .zst)
+are read like uncompressed ones. Timestamps that occur more than once in
+the source, or that the target already holds, are written only once. After each
+series the target's row count is checked against what was written.
+
+Candles keep their lineage (fetched_at, run_id and is_complete), and the
+history of fetch runs recorded in the source is copied to the target.
+
+Candles keep their instant; the target writes them in its storage timezone,
+set for a new target with --to-timezone (UTC or Asia/Kolkata). An existing
+target must already use that zone. A new CSV, JSON or JSONL target can be
+laid out with --to-path-template, e.g. one file per year of each series.
+
+Progress is recorded next to the target (<to-path>.convert.json). If a
+conversion is interrupted, running the same command again skips the series
+that were completed and continues the interrupted one where it stopped.
+
+Examples:
+  # Move CSV history into DuckDB
+  zerodha-connect convert --from-type csv --from-path data/csv --to-type duckdb --to-path market.duckdb
+
+  # Convert only some instruments to Parquet
+  zerodha-connect convert --from-type duckdb --from-path market.duckdb \
+    --to-type parquet --to-path data/parquet --instruments SBIN,RELIANCE
+
+  # Shrink CSV history into zstd-compressed JSON Lines
+  zerodha-connect convert --from-type csv --from-path data/csv --to-type jsonl --to-path data/jsonl \
+    --to-compression zstd
+
+  # Export DuckDB data as CSV with UTC timestamps
+  zerodha-connect convert --from-type duckdb --from-path market.duckdb --to-type csv --to-path export/csv \
+    --to-timezone UTC
+
+  # Split CSV history into one file per instrument and year
+  zerodha-connect convert --from-type csv --from-path data/csv --to-type csv --to-path data/csv-yearly \
+    --to-path-template "{exchange}/{interval}/{symbol}/{year}.csv"
+
+  # Flat CSV files from older releases do not record exchange and interval
+  zerodha-connect convert --from-type csv --from-path data/csv --to-type parquet --to-path data/parquet \
+    --set-exchange NSE --set-interval minute`,
+	RunE: runConvert,
+}
+
+// convertState records the series a conversion has completed.
+type convertState struct {
+	Source    string   `json:"source"`
+	Completed []string `json:"completed"`
+}
+
+// convertResult is the outcome of converting one series.
+type convertResult struct {
+	series     storage.Series
+	sourceRows int64
+	duplicates int64
+	present    int64
+	written    int64
+	targetRows int64
+	expected   int64
+}
+
+func runConvert(cmd *cobra.Command, args []string) error {
+	for _, flag := range []struct{ name, value string }{
+		{"--from-type", convertFromType}, {"--from-path", convertFromPath},
+		{"--to-type", convertToType}, {"--to-path", convertToPath},
+	} {
+		if flag.value == "" {
+			return fmt.Errorf("%s is required", flag.name)
+		}
+	}
+	for _, storageType := range []string{convertFromType, convertToType} {
+		if !isValidStorageType(storageType) {
+			return &storage.UnknownTypeError{Name: storage.StorageType(storageType)}
+		}
+	}
+	if convertFromType == convertToType && filepath.Clean(convertFromPath) == filepath.Clean(convertToPath) {
+		return fmt.Errorf("source and target are the same store")
+	}
+
+	appLogger := logger.NewSilent()
+	if verbose {
+		appLogger = logger.New("convert.log")
+		appLogger.Println("🔧 Verbose mode enabled")
+	}
+
+	source, err := storage.OpenReader(storage.StorageType(convertFromType), convertFromPath, appLogger)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	compression, err := storage.ParseCompression(convertCompression)
+	if err != nil {
+		return err
+	}
+	targetBackend, _ := storage.Lookup(storage.StorageType(convertToType))
+	if compression != storage.CompressionNone && !targetBackend.Schema.Compression {
+		return fmt.Errorf("--to-compression does not apply to %s targets", convertToType)
+	}
+	if convertTemplate != "" && !targetBackend.Schema.PathTemplate {
+		return fmt.Errorf("--to-path-template does not apply to %s targets", convertToType)
+	}
+	timezone, err := storage.ParseTimezone(convertTimezone)
+	if err != nil {
+		return err
+	}
+	if timezone != "" && !targetBackend.Schema.SupportsTimezone(timezone) {
+		return fmt.Errorf("%s targets always store UTC; --to-timezone %s does not apply", convertToType, timezone)
+	}
+	opts := storage.Options{Compression: compression, PathTemplate: convertTemplate, Timezone: timezone}
+	target, err := storage.NewStore(storage.StorageType(convertToType), convertToPath, opts, appLogger)
+	if err != nil {
+		return fmt.Errorf("failed to initialize %s store: %v", convertToType, err)
+	}
+	if err := target.Init(); err != nil {
+		target.Close()
+		return fmt.Errorf("failed to initialize %s storage: %v", convertToType, err)
+	}
+	targetReader, ok := target.(storage.Reader)
+	if !ok {
+		target.Close()
+		return fmt.Errorf("%s storage cannot be read back for verification", convertToType)
+	}
+
+	// Resume state
+	statePath := filepath.Clean(convertToPath) + ".convert.json"
+	sourceID := convertFromType + ":" + convertFromPath
+	state := convertState{Source: sourceID}
+	if !convertRestart {
+		if data, err := os.ReadFile(statePath); err == nil {
+			var saved convertState
+			if err := json.Unmarshal(data, &saved); err != nil {
+				target.Close()
+				return fmt.Errorf("failed to read %s: %v (use --restart to start over)", statePath, err)
+			}
+			if saved.Source == sourceID {
+				state = saved
+			}
+		}
+	}
+	completed := make(map[string]bool, len(state.Completed))
+	for _, name := range state.Completed {
+		completed[name] = true
+	}
+
+	all, err := source.ListSeries()
+	if err != nil {
+		target.Close()
+		return err
+	}
+	var selected []storage.Series
+	for _, s := range all {
+		if len(convertInstruments) == 0 || slices.Contains(convertInstruments, s.Symbol) ||
+			slices.Contains(convertInstruments, s.Exchange+":"+s.Symbol) {
+			selected = append(selected, s)
+		}
+	}
+	if len(selected) == 0 {
+		target.Close()
+		return fmt.Errorf("no matching series in %s", convertFromPath)
+	}
+
+	fmt.Printf("🔄 Converting %d series from %s (%s) to %s (%s)\n",
+		len(selected), convertFromType, convertFromPath, convertToType, convertToPath)
+	if len(completed) > 0 {
+		fmt.Printf("⏯️  Resuming: %d series already converted\n", len(completed))
+	}
+
+	var results []convertResult
+	for i, s := range selected {
+		if completed[s.String()] {
+			continue
+		}
+		result, err := convertSeries(source, target, targetReader, s, appLogger)
+		if err != nil {
+			target.Close()
+			return fmt.Errorf("%s: %v", s, err)
+		}
+		results = append(results, result)
+		fmt.Printf("   [%d/%d] %s: %d written, %d duplicates, %d already present\n",
+			i+1, len(selected), result.series, result.written, result.duplicates, result.present)
+
+		state.Completed = append(state.Completed, s.String())
+		if err := saveConvertState(statePath, state); err != nil {
+			appLogger.Printf("Warning: failed to save conversion state: %v", err)
+		}
+	}
+
+	runs, err := convertRuns(source, target)
+	if err != nil {
+		target.Close()
+		return fmt.Errorf("failed to copy fetch runs: %v", err)
+	}
+	if runs > 0 {
+		fmt.Printf("   Copied %d fetch run(s)\n", runs)
+	}
+
+	if err := target.Close(); err != nil {
+		return fmt.Errorf("failed to close %s store: %v", convertToType, err)
+	}
+
+	// Verification
+	var mismatched []string
+	var written int64
+	for _, r := range results {
+		written += r.written
+		if r.targetRows != r.expected {
+			mismatched = append(mismatched, fmt.Sprintf("%s (expected %d rows, found %d)", r.series, r.expected, r.targetRows))
+		}
+	}
+	if len(mismatched) > 0 {
+		fmt.Println("❌ Row count verification failed:")
+		for _, m := range mismatched {
+			fmt.Printf("  - %s\n", m)
+		}
+		return fmt.Errorf("%d series failed verification", len(mismatched))
+	}
+
+	os.Remove(statePath)
+	fmt.Printf("✅ Converted %d series, %d candles written, row counts verified\n", len(results), written)
+	return nil
+}
+
+// convertSeries copies one series, skipping timestamps the target already has.
+func convertSeries(source storage.Reader, target storage.Store, targetReader storage.Reader, s storage.Series, logger *log.Logger) (convertResult, error) {
+	result := convertResult{series: s}
+	out := s
+	if out.Exchange == "" {
+		out.Exchange = convertExchange
+	}
+	if out.Interval == "" {
+		out.Interval = convertInterval
+	}
+	result.series = out
+
+	// Timestamps already in the target, e.g. from an interrupted run
+	existing := make(map[int64]bool)
+	err := targetReader.ReadRange(out, time.Time{}, time.Time{}, func(c storage.Candle) error {
+		existing[c.Timestamp.Unix()] = true
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to read target: %v", err)
+	}
+	before, err := targetReader.Coverage(out)
+	if err != nil {
+		return result, fmt.Errorf("failed to read target: %v", err)
+	}
+
+	// A target that can keep lineage gets the candles as they are stored:
+	// fetched_at, run_id and is_complete included. Otherwise candles still
+	// forming keep their flag in a target that can store it.
+	keeper, keepsLineage := target.(storage.LineageStorer)
+	flagger, canFlag := target.(storage.IncompleteStorer)
+	batch := make([]storage.Candle, 0, convertBatchSize)
+	var forming []kiteconnect.HistoricalData
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var n int
+		var err error
+		if keepsLineage {
+			n, err = keeper.StoreLineageCandles(out, batch)
+		} else {
+			n, err = target.StoreCandles(out, historicalData(batch))
+		}
+		if err != nil {
+			return err
+		}
+		if n != len(batch) {
+			return fmt.Errorf("stored %d of %d candles", n, len(batch))
+		}
+		result.written += int64(n)
+		batch = batch[:0]
+		return nil
+	}
+
+	seen := make(map[int64]bool)
+	err = source.ReadRange(s, time.Time{}, time.Time{}, func(c storage.Candle) error {
+		result.sourceRows++
+		ts := c.Timestamp.Unix()
+		switch {
+		case existing[ts]:
+			result.present++
+			return nil
+		case seen[ts]:
+			result.duplicates++
+			return nil
+		}
+		seen[ts] = true
+		if c.Incomplete && !keepsLineage && canFlag {
+			forming = append(forming, historicalData([]storage.Candle{c})...)
+			return nil
+		}
+		batch = append(batch, c)
+		if len(batch) == convertBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+	if len(forming) > 0 {
+		n, err := flagger.StoreIncompleteCandles(out, forming)
+		if err != nil {
+			return result, err
+		}
+		result.written += int64(n)
+	}
+
+	after, err := targetReader.Coverage(out)
+	if err != nil {
+		return result, fmt.Errorf("failed to verify target: %v", err)
+	}
+	result.expected = before.Rows + result.written
+	result.targetRows = after.Rows
+	logger.Printf("%s: source %d, written %d, target %d -> %d rows", out, result.sourceRows, result.written, before.Rows, after.Rows)
+	return result, nil
+}
+
+// historicalData converts stored candles back to Kite candles, dropping their lineage.
+func historicalData(candles []storage.Candle) []kiteconnect.HistoricalData {
+	data := make([]kiteconnect.HistoricalData, len(candles))
+	for i, c := range candles {
+		data[i] = kiteconnect.HistoricalData{
+			Date:   models.Time{Time: c.Timestamp},
+			Open:   c.Open,
+			High:   c.High,
+			Low:    c.Low,
+			Close:  c.Close,
+			Volume: int(c.Volume),
+			OI:     int(c.OI),
+		}
+	}
+	return data
+}
+
+// convertRuns copies the fetch run history of the source to the target, when
+// both keep one. Recording a run replaces an earlier copy, so resumed
+// conversions copy them again safely.
+func convertRuns(source storage.Reader, target storage.Store) (int, error) {
+	from, ok := source.(storage.RunRecorder)
+	if !ok {
+		return 0, nil
+	}
+	to, ok := target.(storage.RunRecorder)
+	if !ok {
+		return 0, nil
+	}
+	runs, err := from.FetchRuns()
+	if err != nil {
+		return 0, err
+	}
+	for _, run := range runs {
+		if err := to.RecordRun(run); err != nil {
+			return 0, err
+		}
+	}
+	return len(runs), nil
+}
+
+func saveConvertState(path string, state convertState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func init() {
+	convertCmd.Flags().StringVar(&convertFromType, "from-type", "", "source storage type (duckdb, sqlite, json, jsonl, csv, parquet)")
+	convertCmd.Flags().StringVar(&convertFromPath, "from-path", "", "source storage path")
+	convertCmd.Flags().StringVar(&convertToType, "to-type", "", "target storage type")
+	convertCmd.Flags().StringVar(&convertToPath, "to-path", "", "target storage path")
+	convertCmd.Flags().StringVar(&convertCompression, "to-compression", "", "compression of target csv, json and jsonl files (none, gzip, zstd)")
+	convertCmd.Flags().StringVar(&convertTemplate, "to-path-template", "", "layout of a new csv, json or jsonl target, e.g. \"{exchange}/{interval}/{symbol}/{year}\"")
+	convertCmd.Flags().StringVar(&convertTimezone, "to-timezone", "", "storage timezone of a new target (UTC or Asia/Kolkata)")
+	convertCmd.Flags().StringSliceVarP(&convertInstruments, "instruments", "i", []string{}, "only convert these instruments (SYMBOL or EXCHANGE:SYMBOL)")
+	convertCmd.Flags().StringVar(&convertExchange, "set-exchange", "", "exchange to record for source series that do not have one")
+	convertCmd.Flags().StringVar(&convertInterval, "set-interval", "", "interval to record for source series that do not have one")
+	convertCmd.Flags().BoolVar(&convertRestart, "restart", false, "ignore saved progress and convert every series again")
+}
@@ -1,10 +1,14 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 	"time"
 
+	"zerodha-connect/internal/calendar"
 	"zerodha-connect/internal/config"
 	"zerodha-connect/internal/kite"
 	"zerodha-connect/internal/logger"
@@ -12,6 +16,7 @@ import (
 	"zerodha-connect/internal/ui"
 
 	"github.com/spf13/cobra"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
 )
 
 var (
@@ -23,8 +28,8 @@ var (
 	storageType    string
 	storagePath    string
 	skipConfirm    bool
-	apiKey         string
-	apiSecret      string
+	jobNames       []string
+	allJobs        bool
 	dataConfigFile string
 )
 
@@ -55,7 +60,8 @@ var fetchInstrumentsCmd = &cobra.Command{
 This command fetches all available instruments and saves them to instruments_cache.json.
 The cache is used by other commands to validate instrument symbols and get token mappings.
 
-API credentials can be provided via config file or command line flags.
+API credentials can be provided via config file, ZC_API_KEY/ZC_API_SECRET
+environment variables or command line flags.
 
 Examples:
   # Download instruments using API credentials from config file
@@ -86,43 +92,38 @@ Examples:
   # Fetch specific instruments with CLI flags
   zerodha-connect fetch data --instruments SBIN,RELIANCE --from 2024-01-01 --to 2024-01-31
 
+  # Use relative dates resolved at run time (IST)
+  zerodha-connect fetch data --from -30d --to last_trading_day
+
+  # Fetch part of a session (timestamps are IST)
+  zerodha-connect fetch data --interval minute --from "2024-01-25 09:15" --to "2024-01-25 10:30"
+
   # Use different storage backend
   zerodha-connect fetch data --storage-type csv --storage-path ./data/csv
 
   # Skip confirmation prompt
-  zerodha-connect fetch data --yes`,
+  zerodha-connect fetch data --yes
+
+  # Run one named job, or every job, from a multi-job config
+  zerodha-connect fetch data --job fno-5min
+  zerodha-connect fetch data --all-jobs`,
 	RunE: runFetchData,
 }
 
 func runFetchInstruments(cmd *cobra.Command, args []string) error {
-	var apiKeyToUse, apiSecretToUse string
-
-	// Try to load config file if it exists, otherwise use flags
-	if conf, err := config.Load(configFile); err == nil {
-		// Config file exists, use those credentials as defaults
-		apiKeyToUse = conf.APIKey
-		apiSecretToUse = conf.APISecret
-	}
-
-	// Override with command line flags if provided
-	if apiKey != "" {
-		apiKeyToUse = apiKey
-	}
-	if apiSecret != "" {
-		apiSecretToUse = apiSecret
+	// The config file is optional here, credentials can come from flags or environment
+	conf, err := loadConfig(configFile, true, credentialFlags())
+	if err != nil {
+		return err
 	}
-
-	// Validate we have API credentials
-	if apiKeyToUse == "" || apiSecretToUse == "" {
-		return fmt.Errorf("API credentials required. Provide them via:\n" +
-			"  • Config file (api_key and api_secret fields)\n" +
-			"  • Command flags: --api-key and --api-secret")
+	if err := requireCredentials(conf); err != nil {
+		return err
 	}
 
 	// Create minimal config for authentication
 	tempConfig := &config.Config{
-		APIKey:    apiKeyToUse,
-		APISecret: apiSecretToUse,
+		APIKey:    conf.APIKey,
+		APISecret: conf.APISecret,
 		LogFile:   "instruments_fetch.log",
 	}
 
@@ -138,8 +139,8 @@ func runFetchInstruments(cmd *cobra.Command, args []string) error {
 
 	// Initialize Kite client
 	kiteClient := kite.NewClientWithConfigPath(tempConfig, appLogger, configFile)
-	if err := kiteClient.Authenticate(); err != nil {
-		return fmt.Errorf("authentication failed: %v", err)
+	if err := requireSession(kiteClient); err != nil {
+		return err
 	}
 	fmt.Println("✅ API authentication successful")
 
@@ -161,39 +162,28 @@ func runFetchData(cmd *cobra.Command, args []string) error {
 	}
 
 	// Load configuration
-	conf, err := config.Load(configPath)
+	flags := credentialFlags()
+	flags.Instruments = instruments
+	flags.FromDate = fromDate
+	flags.ToDate = toDate
+	flags.Interval = interval
+	flags.StorageType = storageType
+	flags.StoragePath = storagePath
+	conf, err := loadConfig(configPath, false, flags)
 	if err != nil {
-		return fmt.Errorf("failed to read config file '%s': %v", configPath, err)
+		return err
 	}
 
-	// Override config with CLI flags if provided
-	if len(instruments) > 0 {
-		conf.Instruments = instruments
-	}
-	if fromDate != "" {
-		conf.FromDate = fromDate
-	}
-	if toDate != "" {
-		conf.ToDate = toDate
-	}
-	if interval != "" {
-		conf.Interval = interval
-	}
-	if storageType != "" {
-		conf.StorageType = storageType
-	}
-	if storagePath != "" {
-		conf.StoragePath = storagePath
-	}
-	if apiKey != "" {
-		conf.APIKey = apiKey
-	}
-	if apiSecret != "" {
-		conf.APISecret = apiSecret
+	jobs, err := conf.SelectJobs(jobNames, allJobs)
+	if err != nil {
+		return err
 	}
 
-	// Perform comprehensive validation
-	validation := conf.ValidateComplete()
+	// Perform comprehensive validation of the selected jobs
+	validation := &config.ValidationResult{}
+	for _, job := range jobs {
+		validation.Merge(job.ValidateComplete(), jobFieldPrefix(job))
+	}
 	if validation.HasErrors() {
 		fmt.Println("❌ Configuration validation failed:")
 		for _, err := range validation.Errors {
@@ -206,7 +196,7 @@ func runFetchData(cmd *cobra.Command, args []string) error {
 	appLogger := logger.NewSilent()
 	if verbose {
 		// Only use verbose logger if explicitly requested
-		appLogger = logger.New(conf.LogFile)
+		appLogger = logger.New(jobs[0].LogFile)
 		appLogger.Println("🔧 Verbose mode enabled")
 	}
 
@@ -214,140 +204,487 @@ func runFetchData(cmd *cobra.Command, args []string) error {
 
 	// Services Initialization
 	kiteClient := kite.NewClientWithConfigPath(conf, appLogger, configPath)
-	if err := kiteClient.Authenticate(); err != nil {
-		return fmt.Errorf("authentication failed: %v", err)
+	if err := requireSession(kiteClient); err != nil {
+		return err
 	}
 	fmt.Println("✅ API authentication successful")
 
-	// Determine storage configuration
-	storageType := storage.StorageType(conf.StorageType)
-	storagePath := conf.StoragePath
-
-	// Backward compatibility with old DuckDB config
-	if storagePath == "" && conf.DuckDBPath != "" {
-		storagePath = conf.DuckDBPath
-		storageType = storage.StorageTypeDuckDB
-		if verbose {
-			fmt.Println("⚠️  Using deprecated 'duckdb_path' config. Please use 'storage_type' and 'storage_path' instead.")
-		}
+	// Instrument Discovery
+	fmt.Println("🔍 Loading instruments...")
+	instruments, err := kite.GetInstruments(kiteClient.GetKiteConnectClient(), appLogger)
+	if err != nil {
+		return fmt.Errorf("failed to get instruments: %v", err)
 	}
+	index := kite.NewInstrumentIndex(instruments)
+	fmt.Printf("✅ Loaded %d instruments\n", len(instruments))
 
-	// Default storage settings
-	if storageType == "" {
-		storageType = storage.StorageTypeDuckDB
-	}
-	if storagePath == "" {
-		switch storageType {
-		case storage.StorageTypeJSON:
-			storagePath = "data/json"
-		case storage.StorageTypeCSV:
-			storagePath = "data/csv"
-		case storage.StorageTypeSQLite:
-			storagePath = "market_data.sqlite"
-		default:
-			storagePath = "market_data.duckdb"
+	var failed []string
+	for _, job := range jobs {
+		if len(jobs) > 1 || job.JobName != "" {
+			fmt.Printf("\n▶️  Job: %s\n", job.DisplayName())
+		}
+		if err := runFetchJob(job, index, kiteClient, appLogger); err != nil {
+			if len(jobs) == 1 {
+				return err
+			}
+			fmt.Printf("❌ Job %s failed: %v\n", job.DisplayName(), err)
+			failed = append(failed, job.DisplayName())
 		}
 	}
-
-	dbStore, err := storage.NewStore(storageType, storagePath, appLogger)
-	if err != nil {
-		return fmt.Errorf("failed to initialize %s store: %v", storageType, err)
-	}
-	defer dbStore.Close()
-	if err := dbStore.Init(); err != nil {
-		return fmt.Errorf("failed to initialize %s storage: %v", storageType, err)
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d jobs failed: %s", len(failed), len(jobs), strings.Join(failed, ", "))
 	}
 
-	fmt.Printf("📦 Using %s storage: %s\n", storageType, storagePath)
+	fmt.Println("✅ Market data fetch completed successfully!")
+	return nil
+}
 
-	// Instrument Discovery
-	fmt.Println("🔍 Loading instruments...")
-	instruments, err := kite.GetInstruments(kiteClient.GetKiteConnectClient(), appLogger)
+// runFetchJob fetches and stores the data described by a single job config.
+func runFetchJob(conf *config.Config, index *kite.InstrumentIndex, kiteClient *kite.Client, appLogger *log.Logger) error {
+	run, err := newFetchRun(conf, kiteClient)
 	if err != nil {
-		return fmt.Errorf("failed to get instruments: %v", err)
+		return err
 	}
-	instrumentTokenMap := make(map[string]int)
-	for _, instr := range instruments {
-		instrumentTokenMap[instr.Tradingsymbol] = int(instr.InstrumentToken)
+	dbStore, err := openFetchStore(conf, run.ID, appLogger)
+	if err != nil {
+		return err
 	}
-	fmt.Printf("✅ Loaded %d instruments\n", len(instruments))
+	defer dbStore.Close()
 
 	// Execution Plan - dates are already validated
-	from, _ := time.Parse("2006-01-02", conf.FromDate)
-	to, _ := time.Parse("2006-01-02", conf.ToDate)
-
-	totalAPICalls, validInstruments := calculateAPICalls(conf, instrumentTokenMap, from, to, appLogger)
+	now := time.Now()
+	if ranges, err := conf.TimeRanges(now); err == nil {
+		if len(conf.Windows) > 0 {
+			fmt.Printf("🗓️  %d time windows from %d window definitions\n", len(ranges), len(conf.Windows))
+		} else if config.IsDateExpression(conf.FromDate) || config.IsDateExpression(conf.ToDate) {
+			fmt.Printf("📅 Resolved dates: %s (%s) to %s (%s)\n", ranges[0].From.Format(config.DateTimeLayout), conf.FromDate,
+				ranges[0].To.Format(config.DateTimeLayout), conf.ToDate)
+		}
+	}
+	units, validInstruments, err := planFetch(conf, index, kiteClient, now, appLogger)
+	if err != nil {
+		return err
+	}
 	if validInstruments == 0 {
 		return fmt.Errorf("no valid instruments found to process")
 	}
+	if len(units) == 0 {
+		fmt.Println("📭 No instrument has candles in the requested range")
+		return nil
+	}
+	if calendar.IsSessionOpen(now) && fetchesSession(units, now) {
+		if incompletePolicy(conf) == config.IncompleteFlag {
+			fmt.Println("⏳ Market is open: candles still forming are stored flagged is_complete=false until the next fetch")
+		} else {
+			fmt.Println("⏳ Market is open: candles still forming are dropped until the next fetch")
+		}
+	}
 
 	// User Confirmation
-	if !skipConfirm && !confirmPlan(conf, validInstruments, totalAPICalls) {
+	if !skipConfirm && !confirmPlan(conf, units) {
 		fmt.Println("❌ Operation cancelled by user")
 		return nil
 	}
 
-	fmt.Printf("📊 Fetching data for %d instruments...\n", validInstruments)
+	fmt.Printf("📊 Fetching data for %d %s...\n", len(units), unitsNoun(units))
+	recordFetchRun(dbStore, run)
 
 	// Data Fetching Loop
-	runFetchingLoop(conf, instrumentTokenMap, kiteClient, dbStore, from, to, appLogger)
+	err = runFetchingLoop(conf, kiteClient, dbStore, units, run, appLogger)
+	run.FinishedAt = time.Now().Truncate(time.Second)
+	run.Status = storage.RunCompleted
+	if err != nil {
+		run.Status = storage.RunFailed
+	}
+	if recordFetchRun(dbStore, run) {
+		fmt.Printf("🧾 Recorded fetch run %s (%s)\n", run.ID, run.Status)
+	}
+	return err
+}
 
-	fmt.Println("✅ Market data fetch completed successfully!")
-	return nil
+// newFetchRun starts the lineage record of a job: its run ID, the hash of its
+// configuration, the tool version and the Kite user of the session.
+func newFetchRun(conf *config.Config, kiteClient *kite.Client) (*storage.FetchRun, error) {
+	hash, err := conf.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash configuration: %v", err)
+	}
+	start := time.Now().Truncate(time.Second)
+	run := &storage.FetchRun{
+		ID:          storage.NewRunID(start),
+		Job:         conf.JobName,
+		Status:      storage.RunRunning,
+		StartedAt:   start,
+		ConfigHash:  hash,
+		ToolVersion: version,
+	}
+	if session, err := kiteClient.CachedSession(); err == nil && session != nil {
+		run.UserID = session.UserID
+	}
+	return run, nil
 }
 
-func calculateAPICalls(conf *config.Config, tokenMap map[string]int, from, to time.Time, logger *log.Logger) (int, int) {
-	totalAPICalls := 0
-	validInstruments := 0
+// recordFetchRun records the run in the run history of the store, if it keeps
+// one. A failure only warns: the candles themselves are stored.
+func recordFetchRun(store storage.Store, run *storage.FetchRun) bool {
+	recorder, ok := store.(storage.RunRecorder)
+	if !ok {
+		return false
+	}
+	if err := recorder.RecordRun(*run); err != nil {
+		fmt.Printf("⚠️  Failed to record fetch run %s: %v\n", run.ID, err)
+		return false
+	}
+	return true
+}
+
+// openFetchStore creates and initializes the store a job writes to: its single
+// store, or a storage.MultiStore over all of its storage targets. Every candle
+// written is stamped with runID.
+func openFetchStore(conf *config.Config, runID string, appLogger *log.Logger) (storage.Store, error) {
+	if !conf.HasTargets() {
+		effectiveType, storagePath := conf.EffectiveStorage()
+		storageType := storage.StorageType(effectiveType)
+
+		opts, err := storageOptions(conf)
+		if err != nil {
+			return nil, err
+		}
+		opts.RunID = runID
+		dbStore, err := storage.NewStore(storageType, storagePath, opts, appLogger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize %s store: %v", storageType, err)
+		}
+		if err := dbStore.Init(); err != nil {
+			dbStore.Close()
+			return nil, fmt.Errorf("failed to initialize %s storage: %v", storageType, err)
+		}
+		fmt.Printf("📦 Using %s storage: %s\n", storageType, storagePath)
+		return dbStore, nil
+	}
+
+	var targets []storage.Target
+	closeAll := func() {
+		for _, t := range targets {
+			t.Store.Close()
+		}
+	}
+	for _, tc := range conf.Targets() {
+		opts, err := storageOptions(tc)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("storage target %s: %v", tc.TargetName, err)
+		}
+		opts.RunID = runID
+		store, err := storage.NewStore(storage.StorageType(tc.StorageType), tc.StoragePath, opts, appLogger)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to initialize storage target %s: %v", tc.TargetName, err)
+		}
+		targets = append(targets, storage.Target{Name: tc.TargetName, Store: store, Policy: storage.FailurePolicy(tc.OnError)})
+	}
 
+	multi := storage.NewMultiStore(targets, appLogger)
+	if err := multi.Init(); err != nil {
+		multi.Close()
+		return nil, fmt.Errorf("failed to initialize storage: %v", err)
+	}
+	fmt.Printf("📦 Writing to %d storage targets:\n", len(targets))
+	for i, tc := range conf.Targets() {
+		status := ""
+		if stats := multi.Stats()[i]; stats.Disabled {
+			status = fmt.Sprintf(" ⚠️  disabled: %v", stats.LastErr)
+		}
+		fmt.Printf("   - %s: %s storage at %s (on error: %s)%s\n", tc.TargetName, tc.StorageType, tc.StoragePath, tc.OnError, status)
+	}
+	return multi, nil
+}
+
+// printTargetSummary prints the candles written to each storage target of a
+// storage.MultiStore, and the writes that failed.
+func printTargetSummary(store storage.Store) {
+	multi, ok := store.(*storage.MultiStore)
+	if !ok {
+		return
+	}
+	for _, stats := range multi.Stats() {
+		switch {
+		case stats.Disabled:
+			fmt.Printf("   ⚠️  %s: skipped, initialization failed: %v\n", stats.Name, stats.LastErr)
+		case stats.Failures > 0:
+			fmt.Printf("   ⚠️  %s: %d candles saved, %d failed writes (last error: %v)\n", stats.Name, stats.Inserted, stats.Failures, stats.LastErr)
+		default:
+			fmt.Printf("   📦 %s: %d candles saved\n", stats.Name, stats.Inserted)
+		}
+	}
+}
+
+// jobFieldPrefix returns the prefix used to report validation errors of a job.
+func jobFieldPrefix(conf *config.Config) string {
+	if conf.JobName == "" {
+		return ""
+	}
+	return fmt.Sprintf("jobs[%s].", conf.JobName)
+}
+
+// planChunks splits every time range into API-sized chunks for the interval.
+func planChunks(ranges []config.TimeRange, interval string) [][2]time.Time {
+	var chunks [][2]time.Time
+	for _, r := range ranges {
+		chunks = append(chunks, kite.GenerateDateChunks(r.From, r.To, interval)...)
+	}
+	return chunks
+}
+
+// fetchUnit is one instrument of a job with its effective settings: the
+// series it writes and the chunks to request.
+type fetchUnit struct {
+	symbol     string
+	token      int
+	series     storage.Series
+	continuous bool
+	oi         bool
+	custom     bool // the instrument overrides settings of the job
+	ranges     []config.TimeRange
+	chunks     [][2]time.Time
+}
+
+// planFetch resolves the instruments of a job into fetch units, one per
+// instrument and interval, applying the settings each instrument overrides.
+// Instruments missing from the instrument master are reported and skipped,
+// and instruments clamping from_date start at their first candle, found with
+// a daily request per 2000 days probed. It returns the units and the number
+// of instruments found.
+func planFetch(conf *config.Config, index *kite.InstrumentIndex, client *kite.Client, now time.Time, logger *log.Logger) ([]fetchUnit, int, error) {
 	if verbose {
 		logger.Println("📊 Calculating API calls needed...")
 	}
 
-	var invalidInstruments []string
-	for _, instrumentSymbol := range conf.Instruments {
-		if _, ok := tokenMap[instrumentSymbol]; !ok {
-			invalidInstruments = append(invalidInstruments, instrumentSymbol)
+	var units []fetchUnit
+	var invalidInstruments, empty []string
+	validInstruments, clamped := 0, 0
+	for _, entry := range conf.Instruments {
+		instrument, ok := index.Lookup(entry.Symbol)
+		if !ok {
+			invalidInstruments = append(invalidInstruments, entry.Symbol)
 			if verbose {
-				logger.Printf("⚠️  %s not found in instrument list. Will skip.", instrumentSymbol)
+				logger.Printf("⚠️  %s not found in instrument list. Will skip.", entry.Symbol)
 			}
 			continue
 		}
 		validInstruments++
-		chunks := kite.GenerateDateChunks(from, to, conf.Interval)
-		totalAPICalls += len(chunks)
-		if verbose {
-			logger.Printf("  \\_ %s: %d chunks needed", instrumentSymbol, len(chunks))
+
+		ic := conf.ForInstrument(entry)
+		continuous := ic.Continuous
+		if continuous && instrument.InstrumentType != "FUT" {
+			fmt.Printf("⚠️  continuous only applies to futures, ignored for %s\n", entry.Symbol)
+			continuous = false
+		}
+
+		// Dates such as listing_date resolve for each interval
+		var instrumentUnits []fetchUnit
+		for _, interval := range ic.Interval {
+			ranges, err := ic.ForInterval(interval).TimeRanges(now)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%s (%s): %v", entry.Symbol, interval, err)
+			}
+			instrumentUnits = append(instrumentUnits, fetchUnit{
+				symbol:     entry.Symbol,
+				token:      int(instrument.InstrumentToken),
+				series:     storage.Series{Exchange: instrument.Exchange, Symbol: instrument.Tradingsymbol, Interval: interval},
+				continuous: continuous,
+				oi:         ic.OI,
+				custom:     entry.HasOverrides(),
+				ranges:     ranges,
+			})
+		}
+
+		if ic.ClampsFromDate() {
+			if clamped == 0 {
+				fmt.Println("🔎 Finding the first candle of instruments clamping from_date...")
+			}
+			clamped++
+			// One probe covers the ranges of every interval
+			var from, to time.Time
+			for _, u := range instrumentUnits {
+				if len(u.ranges) == 0 {
+					continue
+				}
+				if first := u.ranges[0].From; from.IsZero() || first.Before(from) {
+					from = first
+				}
+				if last := u.ranges[len(u.ranges)-1].To; last.After(to) {
+					to = last
+				}
+			}
+			if from.IsZero() {
+				// No interval has a range to fetch
+				empty = append(empty, entry.Symbol)
+				continue
+			}
+			first, found, err := client.FirstCandle(int(instrument.InstrumentToken), from, to, continuous)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to find the first candle of %s: %v", entry.Symbol, err)
+			}
+			if !found {
+				empty = append(empty, entry.Symbol)
+				continue
+			}
+			for i := range instrumentUnits {
+				instrumentUnits[i].ranges = clampRanges(instrumentUnits[i].ranges, calendar.Date(first))
+			}
+			if verbose {
+				logger.Printf("  \\_ %s: first candle on %s", entry.Symbol, calendar.Date(first).Format("2006-01-02"))
+			}
+		}
+
+		for _, unit := range instrumentUnits {
+			if len(unit.ranges) == 0 {
+				// The first candle comes after the range of this interval
+				continue
+			}
+			unit.chunks = planChunks(unit.ranges, unit.series.Interval)
+			units = append(units, unit)
+			if verbose {
+				logger.Printf("  \\_ %s (%s): %d chunks needed", entry.Symbol, unit.series.Interval, len(unit.chunks))
+			}
 		}
 	}
 
 	if len(invalidInstruments) > 0 && !verbose {
-		fmt.Printf("⚠️  %d invalid instruments will be skipped\n", len(invalidInstruments))
+		fmt.Printf("⚠️  %d invalid instruments will be skipped: %s (run '%s validate' for suggestions)\n",
+			len(invalidInstruments), strings.Join(invalidInstruments, ", "), appName)
+	}
+	if len(empty) > 0 {
+		fmt.Printf("📭 %d instruments have no candles in the requested range and will be skipped: %s\n",
+			len(empty), strings.Join(empty, ", "))
+	}
+
+	return units, validInstruments, nil
+}
+
+// clampRanges moves the start of the time ranges forward to first, dropping
+// the ranges that end before it.
+func clampRanges(ranges []config.TimeRange, first time.Time) []config.TimeRange {
+	var clamped []config.TimeRange
+	for _, r := range ranges {
+		if r.To.Before(first) {
+			continue
+		}
+		if r.From.Before(first) {
+			r.From = first
+		}
+		clamped = append(clamped, r)
+	}
+	return clamped
+}
+
+// fetchesSession reports whether any unit fetches the session of now.
+func fetchesSession(units []fetchUnit, now time.Time) bool {
+	for _, u := range units {
+		if len(u.ranges) > 0 && u.ranges[len(u.ranges)-1].To.After(calendar.SessionOpen(now)) {
+			return true
+		}
+	}
+	return false
+}
+
+// unitIntervals returns the intervals of the units, in plan order.
+func unitIntervals(units []fetchUnit) []string {
+	var intervals []string
+	for _, u := range units {
+		if !slices.Contains(intervals, u.series.Interval) {
+			intervals = append(intervals, u.series.Interval)
+		}
+	}
+	return intervals
+}
+
+// unitsNoun names the units of a plan in progress messages: instruments, or
+// series when several intervals are fetched.
+func unitsNoun(units []fetchUnit) string {
+	if len(unitIntervals(units)) > 1 {
+		return "series"
 	}
+	return "instruments"
+}
 
-	return totalAPICalls, validInstruments
+// unitName names a unit in progress messages, with its interval when several
+// intervals are fetched.
+func unitName(unit fetchUnit, multiInterval bool) string {
+	if multiInterval {
+		return fmt.Sprintf("%s (%s)", unit.symbol, unit.series.Interval)
+	}
+	return unit.symbol
 }
 
-func confirmPlan(conf *config.Config, validInstruments, totalAPICalls int) bool {
+// confirmPlan shows the plan of a job with its API calls per interval and
+// asks once for confirmation.
+func confirmPlan(conf *config.Config, units []fetchUnit) bool {
+	totalAPICalls := 0
+	from, to := units[0].ranges[0].From, units[0].ranges[len(units[0].ranges)-1].To
+	intervals := unitIntervals(units)
+	estimates := make([]ui.IntervalEstimate, len(intervals))
+	for i, interval := range intervals {
+		estimates[i].Interval = interval
+	}
+	instruments, customInstruments := make(map[string]bool), make(map[string]bool)
+	windows := 0
+	for _, u := range units {
+		totalAPICalls += len(u.chunks)
+		instruments[u.symbol] = true
+		if u.custom {
+			customInstruments[u.symbol] = true
+		}
+		i := slices.Index(intervals, u.series.Interval)
+		estimates[i].Instruments++
+		estimates[i].APICalls += len(u.chunks)
+		if first := u.ranges[0].From; first.Before(from) {
+			from = first
+		}
+		if last := u.ranges[len(u.ranges)-1].To; last.After(to) {
+			to = last
+		}
+		if len(u.ranges) > windows {
+			windows = len(u.ranges)
+		}
+	}
 	estimatedTimeSeconds := float64(totalAPICalls) / float64(kite.RateLimitRequestsPerSecond)
 	estimatedMinutes := int(estimatedTimeSeconds / 60)
 	estimatedRemainingSeconds := int(estimatedTimeSeconds) % 60
 
+	daily, intraday := false, false
+	for _, interval := range intervals {
+		if kite.IsDailyOrLarger(interval) {
+			daily = true
+		} else {
+			intraday = true
+		}
+	}
 	var chunkExplanation, chunkSizeInfo string
-	if kite.IsDailyOrLarger(conf.Interval) {
+	switch {
+	case daily && intraday:
+		chunkSizeInfo = fmt.Sprintf("%d days per chunk for daily+, %d for intraday intervals", kite.DailyChunkDays, kite.IntradayMaxDays)
+		chunkExplanation = fmt.Sprintf("Zerodha allows multiple years per daily+ request, %d days per intraday request (~%d candles max)",
+			kite.IntradayMaxDays, MaxCandlesPerRequest)
+	case daily:
 		chunkSizeInfo = fmt.Sprintf("%d days per chunk", kite.DailyChunkDays)
 		chunkExplanation = "Daily+ intervals: Zerodha allows multiple years per request"
-	} else {
+	default:
 		chunkSizeInfo = fmt.Sprintf("%d days per chunk", kite.IntradayMaxDays)
 		chunkExplanation = fmt.Sprintf("Intraday intervals: Zerodha limit is %d days per request (~%d candles max)",
 			kite.IntradayMaxDays, MaxCandlesPerRequest)
 	}
 
 	plan := ui.FetchPlan{
-		ValidInstruments:          validInstruments,
-		FromDate:                  conf.FromDate,
-		ToDate:                    conf.ToDate,
-		Interval:                  conf.Interval,
+		ValidInstruments:          len(instruments),
+		CustomInstruments:         len(customInstruments),
+		Units:                     len(units),
+		FromDate:                  from.Format(config.DateTimeLayout),
+		ToDate:                    to.Format(config.DateTimeLayout),
+		Windows:                   windows,
+		Interval:                  strings.Join(intervals, ", "),
+		Intervals:                 estimates,
 		RateLimitPerSecond:        kite.RateLimitRequestsPerSecond,
 		ChunkExplanation:          chunkExplanation,
 		ChunkSizeInfo:             chunkSizeInfo,
@@ -359,47 +696,50 @@ func confirmPlan(conf *config.Config, validInstruments, totalAPICalls int) bool
 	return ui.ConfirmExecution(plan)
 }
 
-func runFetchingLoop(conf *config.Config, tokenMap map[string]int, client *kite.Client, store storage.Store, from, to time.Time, logger *log.Logger) {
-	totalInstruments := len(conf.Instruments)
+// runFetchingLoop fetches every chunk of every unit and writes it to the
+// store, adding the result of every unit to run. It stops early when a
+// storage target with the fail policy fails.
+func runFetchingLoop(conf *config.Config, client *kite.Client, store storage.Store, units []fetchUnit, run *storage.FetchRun, logger *log.Logger) error {
+	totalInstruments := len(units)
 	processedInstruments := 0
 	totalCandles := 0
+	noun, multiInterval := unitsNoun(units), len(unitIntervals(units)) > 1
 
-	for i, instrumentSymbol := range conf.Instruments {
-		token, ok := tokenMap[instrumentSymbol]
-		if !ok {
-			continue // Already logged in calculation step
-		}
+	for _, unit := range units {
+		instrumentSymbol, series, chunks := unitName(unit, multiInterval), unit.series, unit.chunks
 
 		processedInstruments++
 
 		if verbose {
-			fmt.Printf("📈 [%d/%d] Processing %s...\n", processedInstruments, len(conf.Instruments), instrumentSymbol)
-			logger.Printf("[%d/%d] %s - Processing", i+1, totalInstruments, instrumentSymbol)
+			fmt.Printf("📈 [%d/%d] Processing %s...\n", processedInstruments, totalInstruments, instrumentSymbol)
+			logger.Printf("[%d/%d] %s - Processing", processedInstruments, totalInstruments, instrumentSymbol)
 		} else {
 			// Show progress every 10% or for the last instrument
-			progress := (processedInstruments * 100) / len(conf.Instruments)
-			interval := len(conf.Instruments) / 10
+			progress := (processedInstruments * 100) / totalInstruments
+			interval := totalInstruments / 10
 			if interval < 1 {
 				interval = 1
 			}
-			if processedInstruments%interval == 0 || processedInstruments == len(conf.Instruments) {
-				fmt.Printf("📊 Progress: %d%% (%d/%d instruments)\n", progress, processedInstruments, len(conf.Instruments))
+			if processedInstruments%interval == 0 || processedInstruments == totalInstruments {
+				fmt.Printf("📊 Progress: %d%% (%d/%d %s)\n", progress, processedInstruments, totalInstruments, noun)
 			}
 		}
 
-		chunks := kite.GenerateDateChunks(from, to, conf.Interval)
 		var totalInserted int
+		result := storage.InstrumentResult{Series: series}
 
 		for chunkIdx, chunk := range chunks {
 			chunkFrom, chunkTo := chunk[0], chunk[1]
 
 			if verbose {
 				logger.Printf("  \\_ Chunk %d/%d: %s to %s", chunkIdx+1, len(chunks),
-					chunkFrom.Format("2006-01-02"), chunkTo.Format("2006-01-02"))
+					chunkFrom.Format(config.DateTimeLayout), chunkTo.Format(config.DateTimeLayout))
 			}
 
-			candles, err := client.GetHistoricalData(token, conf.Interval, chunkFrom, chunkTo)
+			candles, err := client.GetHistoricalData(unit.token, series.Interval, chunkFrom, chunkTo, unit.continuous, unit.oi)
 			if err != nil {
+				result.FailedChunks++
+				result.Error = err.Error()
 				if verbose {
 					logger.Printf("    \\_ API error: %v", err)
 					fmt.Printf("   ⚠️  API error for %s chunk %d/%d\n", instrumentSymbol, chunkIdx+1, len(chunks))
@@ -420,8 +760,23 @@ func runFetchingLoop(conf *config.Config, tokenMap map[string]int, client *kite.
 					candles[0].Date.Time.Format("2006-01-02 15:04:05"),
 					candles[len(candles)-1].Date.Time.Format("2006-01-02 15:04:05"))
 			}
+			result.Candles += len(candles)
 
-			inserted, err := store.StoreCandles(instrumentSymbol, candles)
+			inserted, err := storeChunk(conf, store, series, candles, logger)
+			if err != nil {
+				result.FailedChunks++
+				result.Error = err.Error()
+			}
+			var targetErr *storage.TargetError
+			if errors.As(err, &targetErr) {
+				// A target that must not fall behind failed: stop instead of diverging further
+				result.Stored = totalInserted + inserted
+				run.Results = append(run.Results, result)
+				fmt.Printf("❌ Storage target %s failed for %s chunk %d/%d\n", targetErr.Target, instrumentSymbol, chunkIdx+1, len(chunks))
+				fmt.Printf("🎯 Stopped: %d candles saved for %d %s\n", totalCandles+totalInserted+inserted, processedInstruments, noun)
+				printTargetSummary(store)
+				return err
+			}
 			if err != nil {
 				if verbose {
 					logger.Printf("    \\_ DB store error: %v", err)
@@ -440,9 +795,60 @@ func runFetchingLoop(conf *config.Config, tokenMap map[string]int, client *kite.
 			fmt.Printf("   ✅ Saved %d candles for %s\n", totalInserted, instrumentSymbol)
 		}
 		totalCandles += totalInserted
+		result.Stored = totalInserted
+		run.Results = append(run.Results, result)
+	}
+
+	fmt.Printf("🎯 Completed: %d candles saved for %d %s\n", totalCandles, processedInstruments, noun)
+	printTargetSummary(store)
+	return nil
+}
+
+// incompletePolicy returns what the job does with candles still forming.
+func incompletePolicy(conf *config.Config) string {
+	if conf.IncompleteCandles == "" {
+		return config.IncompleteDrop
 	}
+	return conf.IncompleteCandles
+}
 
-	fmt.Printf("🎯 Completed: %d candles saved for %d instruments\n", totalCandles, processedInstruments)
+// storeChunk writes the candles of a chunk that had closed by now, and the
+// ones still forming according to the incomplete_candles policy: flagged in a
+// store that supports it, dropped otherwise. It returns the count inserted.
+func storeChunk(conf *config.Config, store storage.Store, series storage.Series, candles []kiteconnect.HistoricalData, logger *log.Logger) (int, error) {
+	now := time.Now()
+	complete := candles
+	// Candles are in timestamp order, so the ones still forming are at the end
+	for len(complete) > 0 && !kite.IsCandleComplete(complete[len(complete)-1].Date.Time, series.Interval, now) {
+		complete = complete[:len(complete)-1]
+	}
+	forming := candles[len(complete):]
+
+	inserted := 0
+	if len(complete) > 0 {
+		n, err := store.StoreCandles(series, complete)
+		if err != nil {
+			return n, err
+		}
+		inserted = n
+	}
+	if len(forming) == 0 {
+		return inserted, nil
+	}
+	flagger, ok := store.(storage.IncompleteStorer)
+	if incompletePolicy(conf) != config.IncompleteFlag || !ok {
+		if verbose {
+			logger.Printf("    \\_ Dropped %d candles still forming from %s", len(forming),
+				forming[0].Date.Time.Format(config.DateTimeLayout))
+		}
+		return inserted, nil
+	}
+	n, err := flagger.StoreIncompleteCandles(series, forming)
+	if verbose && err == nil {
+		logger.Printf("    \\_ Flagged %d candles still forming from %s", len(forming),
+			forming[0].Date.Time.Format(config.DateTimeLayout))
+	}
+	return inserted + n, err
 }
 
 func init() {
@@ -451,18 +857,15 @@ func init() {
 	fetchCmd.AddCommand(fetchDataCmd)
 
 	// Fetch instruments command flags
-	fetchInstrumentsCmd.Flags().StringVar(&apiKey, "api-key", "", "Zerodha API key")
-	fetchInstrumentsCmd.Flags().StringVar(&apiSecret, "api-secret", "", "Zerodha API secret")
-
 	// Fetch data command flags
 	fetchDataCmd.Flags().StringVarP(&dataConfigFile, "file", "f", "", "config file path")
-	fetchDataCmd.Flags().StringSliceVarP(&instruments, "instruments", "i", []string{}, "comma-separated list of instruments (e.g. SBIN,RELIANCE)")
-	fetchDataCmd.Flags().StringVarP(&fromDate, "from", "", "", "start date (YYYY-MM-DD)")
-	fetchDataCmd.Flags().StringVarP(&toDate, "to", "", "", "end date (YYYY-MM-DD)")
-	fetchDataCmd.Flags().StringVar(&interval, "interval", "", "data interval (minute, 5minute, day, etc.)")
-	fetchDataCmd.Flags().StringVar(&storageType, "storage-type", "", "storage type (duckdb, sqlite, json, csv)")
+	fetchDataCmd.Flags().StringSliceVarP(&instruments, "instruments", "i", []string{}, "comma-separated list of instruments (e.g. SBIN,BSE:RELIANCE)")
+	fetchDataCmd.Flags().StringVarP(&fromDate, "from", "", "", "start date or IST timestamp (YYYY-MM-DD, \"YYYY-MM-DD HH:MM\", -30d, start_of_month, ...)")
+	fetchDataCmd.Flags().StringVarP(&toDate, "to", "", "", "end date or IST timestamp (YYYY-MM-DD, \"YYYY-MM-DD HH:MM\", today, last_trading_day, ...)")
+	fetchDataCmd.Flags().StringVar(&interval, "interval", "", "data interval, or a comma-separated list (minute, 5minute, day, etc.)")
+	fetchDataCmd.Flags().StringVar(&storageType, "storage-type", "", "storage type (duckdb, sqlite, json, jsonl, csv, parquet)")
 	fetchDataCmd.Flags().StringVar(&storagePath, "storage-path", "", "storage path (file or directory)")
 	fetchDataCmd.Flags().BoolVarP(&skipConfirm, "yes", "y", false, "skip confirmation prompt")
-	fetchDataCmd.Flags().StringVar(&apiKey, "api-key", "", "Zerodha API key")
-	fetchDataCmd.Flags().StringVar(&apiSecret, "api-secret", "", "Zerodha API secret")
+	fetchDataCmd.Flags().StringSliceVar(&jobNames, "job", []string{}, "run only the named job(s) from the config")
+	fetchDataCmd.Flags().BoolVar(&allJobs, "all-jobs", false, "run every job defined in the config")
 }
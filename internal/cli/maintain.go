@@ -0,0 +1,371 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"zerodha-connect/internal/config"
+	"zerodha-connect/internal/logger"
+	"zerodha-connect/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Storage maintain command flags
+	maintainJob         string
+	maintainStorageType string
+	maintainStoragePath string
+	maintainDryRun      bool
+	maintainInstruments []string
+	maintainInterval    string
+	maintainFrom        string
+	maintainTo          string
+	maintainKeep        string
+)
+
+// retentionPattern matches the --keep retention window, e.g. 90d, 12w, 6m or 2y.
+var retentionPattern = regexp.MustCompile(`^\d+[dwmy]$`)
+
+// storageMaintainCmd represents the storage maintain command
+var storageMaintainCmd = &cobra.Command{
+	Use:   "maintain",
+	Short: "Deduplicate, delete, prune and vacuum stored candles",
+	Long: `Maintenance operations on the store the config points at, or on the one
+given with --storage-type and --storage-path.
+
+Every operation accepts --dry-run, which only reports how many candles it
+would affect and leaves the store untouched.
+
+Examples:
+  # How many duplicates would be removed?
+  zerodha-connect storage maintain dedupe --dry-run
+
+  # Drop a partial day fetched during market hours
+  zerodha-connect storage maintain delete -i SBIN --interval minute --from 2024-01-05 --to 2024-01-05
+
+  # Keep one year of minute candles
+  zerodha-connect storage maintain prune --interval minute --keep 1y
+
+  # Release the space of deleted rows
+  zerodha-connect storage maintain vacuum`,
+}
+
+// maintainDedupeCmd represents the storage maintain dedupe command
+var maintainDedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Remove duplicate candles, keeping the latest fetched one",
+	Long: `Remove candles stored more than once for the same timestamp, keeping the
+most recently written one.
+
+CSV, JSON and JSON Lines files gain duplicates whenever a range is fetched
+again; DuckDB databases of earlier releases and Parquet partitions with
+pending part files can hold them too. SQLite's primary key rules them out.`,
+	RunE: runMaintainDedupe,
+}
+
+// maintainDeleteCmd represents the storage maintain delete command
+var maintainDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete the candles of instruments, an interval or a date range",
+	Long: `Delete the stored candles matching the selected instruments, interval and
+--from/--to range (inclusive, IST). At least one of them must be given.
+--from and --to accept the same dates, timestamps and date expressions as the
+config file; a date-only --to covers that whole day.`,
+	RunE: runMaintainDelete,
+}
+
+// maintainPruneCmd represents the storage maintain prune command
+var maintainPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete candles older than a retention window",
+	Long: `Delete the stored candles before the start of the retention window given
+with --keep, counted back from today (IST): 90d, 12w, 6m or 2y.`,
+	RunE: runMaintainPrune,
+}
+
+// maintainVacuumCmd represents the storage maintain vacuum command
+var maintainVacuumCmd = &cobra.Command{
+	Use:   "vacuum",
+	Short: "Reclaim space: VACUUM/CHECKPOINT databases, rewrite files",
+	Long: `Reclaim the space of deleted rows. SQLite is vacuumed and its write-ahead
+log truncated, DuckDB is checkpointed, CSV, JSON and JSON Lines files are
+rewritten sorted by timestamp (dropping partial rows left by interrupted
+writes), and pending Parquet part files are merged into their partitions.`,
+	RunE: runMaintainVacuum,
+}
+
+// maintenanceTarget is the store a storage maintain command works on.
+type maintenanceTarget struct {
+	storageType string
+	storagePath string
+	store       storage.Store
+	reader      storage.Reader
+	maintainer  storage.Maintainer
+}
+
+// openMaintenanceTarget opens the selected store. It is only initialized,
+// which may migrate or record its timezone, when the operation is not a dry run.
+func openMaintenanceTarget() (*maintenanceTarget, error) {
+	flags := credentialFlags()
+	flags.StorageType = maintainStorageType
+	flags.StoragePath = maintainStoragePath
+	conf, err := loadConfig(configFile, true, flags)
+	if err != nil {
+		return nil, err
+	}
+	job, err := storageJob(conf, maintainJob, maintainStorageType, maintainStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	storageType, storagePath := job.EffectiveStorage()
+
+	appLogger := logger.NewSilent()
+	if verbose {
+		appLogger = logger.New(job.LogFile)
+	}
+	if !isValidStorageType(storageType) {
+		return nil, &storage.UnknownTypeError{Name: storage.StorageType(storageType)}
+	}
+	if _, err := os.Stat(storagePath); err != nil {
+		return nil, fmt.Errorf("no %s data at %s: %v", storageType, storagePath, err)
+	}
+	// Rewritten files are written in the configured compression
+	opts, err := storageOptions(job)
+	if err != nil {
+		return nil, err
+	}
+	store, err := storage.NewStore(storage.StorageType(storageType), storagePath, opts, appLogger)
+	if err != nil {
+		return nil, err
+	}
+	reader, isReader := store.(storage.Reader)
+	maintainer, isMaintainer := store.(storage.Maintainer)
+	if !isReader || !isMaintainer {
+		store.Close()
+		return nil, fmt.Errorf("%s storage does not support maintenance", storageType)
+	}
+	if !maintainDryRun {
+		if err := store.Init(); err != nil {
+			store.Close()
+			return nil, fmt.Errorf("failed to initialize %s storage: %v", storageType, err)
+		}
+	}
+	return &maintenanceTarget{storageType: storageType, storagePath: storagePath, store: store, reader: reader, maintainer: maintainer}, nil
+}
+
+// selectSeries returns the stored series matching --instruments and --interval.
+func (t *maintenanceTarget) selectSeries() ([]storage.Series, error) {
+	all, err := t.reader.ListSeries()
+	if err != nil {
+		return nil, err
+	}
+	selected := filterSeries(all, maintainInstruments, maintainInterval)
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no matching series in %s", t.storagePath)
+	}
+	return selected, nil
+}
+
+// deleteRange deletes [from, to] from every selected series and reports the counts.
+func (t *maintenanceTarget) deleteRange(from, to time.Time) error {
+	selected, err := t.selectSeries()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for i, s := range selected {
+		n, err := t.maintainer.DeleteRange(s, from, to, maintainDryRun)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s, err)
+		}
+		total += n
+		fmt.Printf("   [%d/%d] %s: %d candles\n", i+1, len(selected), s, n)
+	}
+	if maintainDryRun {
+		fmt.Printf("🔍 Dry run: would delete %d candles from %d series\n", total, len(selected))
+	} else {
+		fmt.Printf("✅ Deleted %d candles from %d series\n", total, len(selected))
+	}
+	return nil
+}
+
+func runMaintainDedupe(cmd *cobra.Command, args []string) error {
+	target, err := openMaintenanceTarget()
+	if err != nil {
+		return err
+	}
+	defer target.store.Close()
+
+	selected, err := target.selectSeries()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🧹 Deduplicating %d series in %s (%s)\n", len(selected), target.storagePath, target.storageType)
+	var total int64
+	for i, s := range selected {
+		n, err := target.maintainer.Dedupe(s, maintainDryRun)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s, err)
+		}
+		total += n
+		fmt.Printf("   [%d/%d] %s: %d duplicate candles\n", i+1, len(selected), s, n)
+	}
+	if maintainDryRun {
+		fmt.Printf("🔍 Dry run: would remove %d duplicate candles\n", total)
+	} else {
+		fmt.Printf("✅ Removed %d duplicate candles\n", total)
+	}
+	return nil
+}
+
+func runMaintainDelete(cmd *cobra.Command, args []string) error {
+	if len(maintainInstruments) == 0 && maintainInterval == "" && maintainFrom == "" && maintainTo == "" {
+		return fmt.Errorf("select what to delete with --instruments, --interval, --from or --to")
+	}
+	now := time.Now()
+	var from, to time.Time
+	var err error
+	if maintainFrom != "" {
+		if from, err = config.ResolveTime(maintainFrom, now, maintainInterval, false); err != nil {
+			return fmt.Errorf("--from (%s): %v", maintainFrom, err)
+		}
+	}
+	if maintainTo != "" {
+		if to, err = config.ResolveTime(maintainTo, now, maintainInterval, true); err != nil {
+			return fmt.Errorf("--to (%s): %v", maintainTo, err)
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return fmt.Errorf("--from must not be after --to")
+	}
+
+	target, err := openMaintenanceTarget()
+	if err != nil {
+		return err
+	}
+	defer target.store.Close()
+
+	span := "all candles"
+	switch {
+	case !from.IsZero() && !to.IsZero():
+		span = fmt.Sprintf("candles from %s to %s", from.Format(config.DateTimeLayout), to.Format(config.DateTimeLayout))
+	case !from.IsZero():
+		span = fmt.Sprintf("candles from %s", from.Format(config.DateTimeLayout))
+	case !to.IsZero():
+		span = fmt.Sprintf("candles up to %s", to.Format(config.DateTimeLayout))
+	}
+	fmt.Printf("🗑️  Deleting %s in %s (%s)\n", span, target.storagePath, target.storageType)
+	return target.deleteRange(from, to)
+}
+
+func runMaintainPrune(cmd *cobra.Command, args []string) error {
+	if !retentionPattern.MatchString(maintainKeep) {
+		return fmt.Errorf("--keep must be a retention window like 90d, 12w, 6m or 2y")
+	}
+	cutoff, err := config.ResolveDate("-"+maintainKeep, time.Now(), maintainInterval)
+	if err != nil {
+		return fmt.Errorf("--keep (%s): %v", maintainKeep, err)
+	}
+
+	target, err := openMaintenanceTarget()
+	if err != nil {
+		return err
+	}
+	defer target.store.Close()
+
+	fmt.Printf("✂️  Pruning candles before %s (keeping %s) in %s (%s)\n",
+		cutoff.Format(config.DateLayout), maintainKeep, target.storagePath, target.storageType)
+	return target.deleteRange(time.Time{}, cutoff.Add(-time.Nanosecond))
+}
+
+func runMaintainVacuum(cmd *cobra.Command, args []string) error {
+	target, err := openMaintenanceTarget()
+	if err != nil {
+		return err
+	}
+	defer target.store.Close()
+
+	before := storageSize(target.storagePath)
+	fmt.Printf("♻️  Vacuuming %s (%s)\n", target.storagePath, target.storageType)
+	rows, err := target.maintainer.Vacuum(maintainDryRun)
+	if err != nil {
+		return err
+	}
+	if maintainDryRun {
+		fmt.Printf("🔍 Dry run: would rewrite %d candles (%s on disk)\n", rows, formatSize(before))
+		return nil
+	}
+	fmt.Printf("✅ Vacuumed %d candles: %s → %s\n", rows, formatSize(before), formatSize(storageSize(target.storagePath)))
+	return nil
+}
+
+// storageSize returns the bytes used by a database file and its write-ahead
+// log, or by all files below a storage directory.
+func storageSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if !info.IsDir() {
+		size := info.Size()
+		for _, suffix := range []string{"-wal", ".wal"} {
+			if wal, err := os.Stat(path + suffix); err == nil {
+				size += wal.Size()
+			}
+		}
+		return size
+	}
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if fi, err := d.Info(); err == nil {
+				size += fi.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// formatSize formats a byte count as B, KB, MB or GB.
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value, suffix := float64(bytes)/unit, "KB"
+	for _, next := range []string{"MB", "GB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
+
+func init() {
+	storageCmd.AddCommand(storageMaintainCmd)
+	storageMaintainCmd.AddCommand(maintainDedupeCmd)
+	storageMaintainCmd.AddCommand(maintainDeleteCmd)
+	storageMaintainCmd.AddCommand(maintainPruneCmd)
+	storageMaintainCmd.AddCommand(maintainVacuumCmd)
+
+	storageMaintainCmd.PersistentFlags().StringVar(&maintainJob, "job", "", "use the storage of the named job from the config")
+	storageMaintainCmd.PersistentFlags().StringVar(&maintainStorageType, "storage-type", "", "storage type (overrides config)")
+	storageMaintainCmd.PersistentFlags().StringVar(&maintainStoragePath, "storage-path", "", "storage path (overrides config)")
+	storageMaintainCmd.PersistentFlags().BoolVar(&maintainDryRun, "dry-run", false, "only report how many candles would be affected")
+
+	for _, cmd := range []*cobra.Command{maintainDedupeCmd, maintainDeleteCmd, maintainPruneCmd} {
+		cmd.Flags().StringSliceVarP(&maintainInstruments, "instruments", "i", []string{}, "only these instruments (SYMBOL or EXCHANGE:SYMBOL)")
+		cmd.Flags().StringVar(&maintainInterval, "interval", "", "only this interval (minute, 5minute, day, etc.)")
+	}
+	maintainDeleteCmd.Flags().StringVar(&maintainFrom, "from", "", "delete candles from this date or IST timestamp")
+	maintainDeleteCmd.Flags().StringVar(&maintainTo, "to", "", "delete candles up to this date or IST timestamp")
+	maintainPruneCmd.Flags().StringVar(&maintainKeep, "keep", "", "retention window to keep (90d, 12w, 6m, 2y)")
+	maintainPruneCmd.MarkFlagRequired("keep")
+}
@@ -5,10 +5,8 @@ import (
 	"os"
 	"strings"
 
-	"zerodha-connect/internal/config"
 	"zerodha-connect/internal/kite"
 	"zerodha-connect/internal/logger"
-	"zerodha-connect/internal/ui"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
@@ -27,7 +25,8 @@ This command fetches comprehensive user profile information including:
 - Order types available
 - User meta information
 
-API credentials must be provided via config file or command line flags.
+API credentials can be provided via config file, ZC_API_KEY/ZC_API_SECRET
+environment variables or the --api-key/--api-secret flags.
 
 Examples:
   # Fetch profile using config file
@@ -43,16 +42,12 @@ Examples:
 
 func runProfile(cmd *cobra.Command, args []string) error {
 	// Load configuration
-	conf, err := config.Load(configFile)
+	conf, err := loadConfig(configFile, false, credentialFlags())
 	if err != nil {
-		return fmt.Errorf("failed to read config file '%s': %v", configFile, err)
+		return err
 	}
-
-	// Validate API credentials
-	if conf.APIKey == "" || conf.APISecret == "" {
-		return fmt.Errorf("API credentials required. Please provide them in the config file:\n" +
-			"  • api_key: Your Zerodha API key\n" +
-			"  • api_secret: Your Zerodha API secret")
+	if err := requireCredentials(conf); err != nil {
+		return err
 	}
 
 	// Initialize logger
@@ -67,26 +62,8 @@ func runProfile(cmd *cobra.Command, args []string) error {
 	// Initialize Kite client with the config file path
 	kiteClient := kite.NewClientWithConfigPath(conf, appLogger, configFile)
 
-	// Use the new authentication method with token validation
-	err = kiteClient.AuthenticateWithTokenValidation()
-	if err != nil {
-		// Check if it's an authentication error with expired token
-		if authErr, ok := err.(*kite.AuthenticationError); ok && authErr.Type == kite.AuthErrorTokenExpired {
-			// Ask user if they want to start auth process
-			if !ui.ConfirmAuthRestart() {
-				fmt.Println("❌ Authentication cancelled by user")
-				return nil
-			}
-
-			// Clear the expired token and start fresh auth flow
-			conf.RequestToken = ""
-			err = kiteClient.Authenticate()
-			if err != nil {
-				return fmt.Errorf("authentication failed: %v", err)
-			}
-		} else {
-			return fmt.Errorf("authentication failed: %v", err)
-		}
+	if err := requireSession(kiteClient); err != nil {
+		return err
 	}
 
 	// Fetch user profile
@@ -0,0 +1,481 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+	"zerodha-connect/internal/config"
+	"zerodha-connect/internal/kite"
+	"zerodha-connect/internal/logger"
+	"zerodha-connect/internal/storage"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Query command flags
+	queryInstrument  string
+	queryInterval    string
+	queryFrom        string
+	queryTo          string
+	queryFormat      string
+	queryTail        int
+	queryColumns     []string
+	querySummary     bool
+	queryJob         string
+	queryStorageType string
+	queryStoragePath string
+	queryTimezone    string
+)
+
+// Output formats of the query command.
+var queryFormats = []string{"table", "csv", "jsonl", "markdown"}
+
+// Columns available in candle and daily summary rows. The lineage columns of
+// candles are only printed when requested with --columns.
+var (
+	candleColumns  = []string{"timestamp", "open", "high", "low", "close", "volume", "oi"}
+	lineageColumns = []string{"fetched_at", "run_id", "is_complete"}
+	summaryColumns = []string{"date", "open", "high", "low", "close", "volume", "candles"}
+)
+
+// queryCmd represents the query command
+var queryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Print stored candles",
+	Long: `Read candles back from the storage backend the config points at and print
+them as a table, CSV, JSON lines or Markdown.
+
+The instrument is a symbol or EXCHANGE:SYMBOL. When the storage holds the
+symbol at several intervals or exchanges, pick one with --interval or the
+EXCHANGE: prefix. --from and --to accept the same dates, timestamps and date
+expressions as the config file.
+
+Timestamps are printed in IST whatever the storage timezone; --timezone
+renders them in any IANA zone (UTC, America/New_York, ...) instead.
+
+Examples:
+  # Last 20 minute candles of SBIN
+  zerodha-connect query --instrument SBIN --interval minute --tail 20
+
+  # One day as CSV, only timestamp and close
+  zerodha-connect query -i NSE:SBIN --interval minute --from 2024-01-05 --to 2024-01-05 \
+    --format csv --columns timestamp,close
+
+  # Daily open/high/low/close/volume built from minute candles, as Markdown
+  zerodha-connect query -i SBIN --interval minute --from -30d --summary --format markdown
+
+  # Export to CSV with UTC timestamps
+  zerodha-connect query -i SBIN --interval day --format csv --timezone UTC > sbin.csv
+
+  # Which fetch run wrote each candle
+  zerodha-connect query -i SBIN --interval minute --tail 5 --columns timestamp,close,fetched_at,run_id
+
+  # Read a different store than the config's
+  zerodha-connect query -i SBIN --storage-type csv --storage-path data/csv`,
+	RunE: runQuery,
+}
+
+func runQuery(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(queryFormats, queryFormat) {
+		return fmt.Errorf("unknown format %q (use one of: %s)", queryFormat, strings.Join(queryFormats, ", "))
+	}
+	columns := candleColumns
+	available := append(append([]string(nil), candleColumns...), lineageColumns...)
+	if querySummary {
+		columns, available = summaryColumns, summaryColumns
+	}
+	if len(queryColumns) > 0 {
+		for _, column := range queryColumns {
+			if !slices.Contains(available, column) {
+				return fmt.Errorf("unknown column %q (available: %s)", column, strings.Join(available, ", "))
+			}
+		}
+		columns = queryColumns
+	}
+
+	// Locate the storage
+	flags := credentialFlags()
+	flags.StorageType = queryStorageType
+	flags.StoragePath = queryStoragePath
+	conf, err := loadConfig(configFile, true, flags)
+	if err != nil {
+		return err
+	}
+	job, err := storageJob(conf, queryJob, queryStorageType, queryStoragePath)
+	if err != nil {
+		return err
+	}
+	storageType, storagePath := job.EffectiveStorage()
+
+	appLogger := logger.NewSilent()
+	if verbose {
+		appLogger = logger.New(job.LogFile)
+	}
+	reader, err := storage.OpenReader(storage.StorageType(storageType), storagePath, appLogger)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	series, err := findSeries(reader, queryInstrument, queryInterval)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var from, to time.Time
+	if queryFrom != "" {
+		if from, err = config.ResolveTime(queryFrom, now, series.Interval, false); err != nil {
+			return fmt.Errorf("--from (%s): %v", queryFrom, err)
+		}
+	}
+	if queryTo != "" {
+		if to, err = config.ResolveTime(queryTo, now, series.Interval, true); err != nil {
+			return fmt.Errorf("--to (%s): %v", queryTo, err)
+		}
+	}
+
+	location, err := loadLocation(queryTimezone)
+	if err != nil {
+		return err
+	}
+	out := newQueryWriter(queryFormat, cmd.OutOrStdout(), columns, location)
+	emit := out.Row
+	var tail *rowTail
+	if queryTail > 0 {
+		tail = &rowTail{size: queryTail}
+		emit = tail.Add
+	}
+
+	var day *dailySummary
+	err = reader.ReadRange(series, from, to, func(c storage.Candle) error {
+		if !querySummary {
+			return emit(candleRow(c))
+		}
+		date := calendar.Date(c.Timestamp)
+		if day != nil && !day.date.Equal(date) {
+			if err := emit(day.row()); err != nil {
+				return err
+			}
+			day = nil
+		}
+		if day == nil {
+			day = &dailySummary{date: date, open: c.Open, high: c.High, low: c.Low}
+		}
+		day.add(c)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if day != nil {
+		if err := emit(day.row()); err != nil {
+			return err
+		}
+	}
+	if tail != nil {
+		for _, row := range tail.Rows() {
+			if err := out.Row(row); err != nil {
+				return err
+			}
+		}
+	}
+	return out.Flush()
+}
+
+// findSeries picks the stored series of an instrument, narrowed by exchange
+// and interval when given.
+func findSeries(reader storage.Reader, instrument, interval string) (storage.Series, error) {
+	if instrument == "" {
+		return storage.Series{}, fmt.Errorf("--instrument is required")
+	}
+	exchange, symbol := kite.SplitSymbol(instrument)
+
+	all, err := reader.ListSeries()
+	if err != nil {
+		return storage.Series{}, err
+	}
+	var bySymbol, matches []storage.Series
+	for _, s := range all {
+		if s.Symbol != symbol {
+			continue
+		}
+		bySymbol = append(bySymbol, s)
+		if (exchange == "" || s.Exchange == exchange) && (interval == "" || s.Interval == interval) {
+			matches = append(matches, s)
+		}
+	}
+
+	switch {
+	case len(matches) == 1:
+		return matches[0], nil
+	case len(bySymbol) == 0:
+		return storage.Series{}, fmt.Errorf("no stored data for %s", instrument)
+	case len(matches) == 0:
+		return storage.Series{}, fmt.Errorf("no stored data for %s at the requested exchange/interval; available: %s",
+			instrument, joinSeries(bySymbol))
+	default:
+		return storage.Series{}, fmt.Errorf("%s is stored as several series, choose one with --interval or EXCHANGE:SYMBOL: %s",
+			instrument, joinSeries(matches))
+	}
+}
+
+// filterSeries returns the series of the given instruments (SYMBOL or
+// EXCHANGE:SYMBOL) and interval; empty selectors match every series.
+func filterSeries(all []storage.Series, instruments []string, interval string) []storage.Series {
+	var selected []storage.Series
+	for _, s := range all {
+		if len(instruments) > 0 && !slices.Contains(instruments, s.Symbol) &&
+			!slices.Contains(instruments, s.Exchange+":"+s.Symbol) {
+			continue
+		}
+		if interval != "" && s.Interval != interval {
+			continue
+		}
+		selected = append(selected, s)
+	}
+	return selected
+}
+
+func joinSeries(series []storage.Series) string {
+	names := make([]string, len(series))
+	for i, s := range series {
+		names[i] = s.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// queryRow holds the values of one output row by column name.
+type queryRow map[string]interface{}
+
+func candleRow(c storage.Candle) queryRow {
+	row := queryRow{
+		"timestamp": c.Timestamp,
+		"open":      c.Open,
+		"high":      c.High,
+		"low":       c.Low,
+		"close":     c.Close,
+		"volume":    c.Volume,
+		"oi":        c.OI,
+	}
+	// Candles written before lineage was recorded have none
+	if !c.FetchedAt.IsZero() {
+		row["fetched_at"] = c.FetchedAt
+	}
+	if c.RunID != "" {
+		row["run_id"] = c.RunID
+	}
+	if c.Incomplete || c.RunID != "" {
+		row["is_complete"] = !c.Incomplete
+	}
+	return row
+}
+
+// dailySummary aggregates the candles of one trading day.
+type dailySummary struct {
+	date                   time.Time
+	open, high, low, close float64
+	volume                 int64
+	candles                int64
+}
+
+func (d *dailySummary) add(c storage.Candle) {
+	if c.High > d.high {
+		d.high = c.High
+	}
+	if c.Low < d.low {
+		d.low = c.Low
+	}
+	d.close = c.Close
+	d.volume += c.Volume
+	d.candles++
+}
+
+func (d *dailySummary) row() queryRow {
+	return queryRow{
+		"date":    d.date.Format(config.DateLayout),
+		"open":    d.open,
+		"high":    d.high,
+		"low":     d.low,
+		"close":   d.close,
+		"volume":  d.volume,
+		"candles": d.candles,
+	}
+}
+
+// rowTail keeps the last size rows it was given.
+type rowTail struct {
+	size int
+	rows []queryRow
+}
+
+func (t *rowTail) Add(row queryRow) error {
+	t.rows = append(t.rows, row)
+	if len(t.rows) > t.size {
+		t.rows = t.rows[1:]
+	}
+	return nil
+}
+
+func (t *rowTail) Rows() []queryRow {
+	return t.rows
+}
+
+// loadLocation resolves the --timezone of the query output. Asia/Kolkata (or
+// IST) does not need the system time zone database.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" || strings.EqualFold(name, "IST") || strings.EqualFold(name, string(storage.TimezoneIST)) {
+		return calendar.IST, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q: %v", name, err)
+	}
+	return location, nil
+}
+
+// formatValue renders a row value as text, with timestamps in location.
+func formatValue(v interface{}, location *time.Location) string {
+	switch value := v.(type) {
+	case time.Time:
+		return value.In(location).Format(config.DateTimeLayout)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// queryWriter renders rows in one of the query output formats.
+type queryWriter struct {
+	format   string
+	out      io.Writer
+	columns  []string
+	location *time.Location
+	csv      *csv.Writer
+	table    *tablewriter.Table
+	started  bool
+}
+
+func newQueryWriter(format string, out io.Writer, columns []string, location *time.Location) *queryWriter {
+	w := &queryWriter{format: format, out: out, columns: columns, location: location}
+	switch format {
+	case "csv":
+		w.csv = csv.NewWriter(out)
+	case "table":
+		w.table = tablewriter.NewWriter(out)
+		w.table.SetHeader(columns)
+		w.table.SetBorder(true)
+		w.table.SetAutoFormatHeaders(false)
+		colors := make([]tablewriter.Colors, len(columns))
+		for i := range colors {
+			colors[i] = tablewriter.Colors{tablewriter.Bold, tablewriter.FgHiBlueColor}
+		}
+		w.table.SetHeaderColor(colors...)
+	}
+	return w
+}
+
+func (w *queryWriter) values(row queryRow) []string {
+	values := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		values[i] = formatValue(row[column], w.location)
+	}
+	return values
+}
+
+// Row writes one row, emitting the header first where the format has one.
+func (w *queryWriter) Row(row queryRow) error {
+	first := !w.started
+	w.started = true
+
+	switch w.format {
+	case "table":
+		w.table.Append(w.values(row))
+	case "csv":
+		if first {
+			if err := w.csv.Write(w.columns); err != nil {
+				return err
+			}
+		}
+		return w.csv.Write(w.values(row))
+	case "markdown":
+		if first {
+			separators := make([]string, len(w.columns))
+			for i := range separators {
+				separators[i] = "---"
+			}
+			fmt.Fprintf(w.out, "| %s |\n|%s|\n", strings.Join(w.columns, " | "), strings.Join(separators, "|"))
+		}
+		fmt.Fprintf(w.out, "| %s |\n", strings.Join(w.values(row), " | "))
+	case "jsonl":
+		var b strings.Builder
+		b.WriteString("{")
+		for i, column := range w.columns {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			value := row[column]
+			if t, ok := value.(time.Time); ok {
+				value = t.In(w.location).Format(time.RFC3339)
+			}
+			key, _ := json.Marshal(column)
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			b.Write(key)
+			b.WriteString(":")
+			b.Write(encoded)
+		}
+		b.WriteString("}\n")
+		_, err := io.WriteString(w.out, b.String())
+		return err
+	}
+	return nil
+}
+
+// Flush renders buffered output.
+func (w *queryWriter) Flush() error {
+	switch w.format {
+	case "table":
+		if !w.started {
+			fmt.Fprintln(os.Stderr, "No candles in the requested range")
+			return nil
+		}
+		w.table.Render()
+	case "csv":
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
+
+func init() {
+	queryCmd.Flags().StringVarP(&queryInstrument, "instrument", "i", "", "instrument to read (SYMBOL or EXCHANGE:SYMBOL)")
+	queryCmd.Flags().StringVar(&queryInterval, "interval", "", "interval of the stored series (minute, day, ...)")
+	queryCmd.Flags().StringVar(&queryFrom, "from", "", "start date or IST timestamp (YYYY-MM-DD, \"YYYY-MM-DD HH:MM\", -30d, ...)")
+	queryCmd.Flags().StringVar(&queryTo, "to", "", "end date or IST timestamp (YYYY-MM-DD, \"YYYY-MM-DD HH:MM\", today, ...)")
+	queryCmd.Flags().StringVar(&queryFormat, "format", "table", "output format ("+strings.Join(queryFormats, ", ")+")")
+	queryCmd.Flags().IntVar(&queryTail, "tail", 0, "only print the last N rows")
+	queryCmd.Flags().StringSliceVar(&queryColumns, "columns", nil, "comma-separated columns to print (default: all but fetched_at, run_id and is_complete)")
+	queryCmd.Flags().BoolVar(&querySummary, "summary", false, "print one row per day (open, high, low, close, volume, candles)")
+	queryCmd.Flags().StringVar(&queryJob, "job", "", "read the storage of the named job from the config")
+	queryCmd.Flags().StringVar(&queryStorageType, "storage-type", "", "storage type to read (overrides config)")
+	queryCmd.Flags().StringVar(&queryStoragePath, "storage-path", "", "storage path to read (overrides config)")
+	queryCmd.Flags().StringVar(&queryTimezone, "timezone", "Asia/Kolkata", "timezone to print timestamps in (any IANA name, e.g. UTC)")
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 
+	"zerodha-connect/internal/config"
+
 	"github.com/spf13/cobra"
 )
 
@@ -16,6 +18,8 @@ const (
 var (
 	configFile string
 	verbose    bool
+	apiKey     string
+	apiSecret  string
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -29,13 +33,15 @@ from the Zerodha Kite API with support for multiple storage backends:
 
 • DuckDB - Fast analytical database (default)
 • SQLite - Universal database format  
-• JSON - Human-readable format (one file per instrument)
+• JSON Lines - Append-only text files (one file per instrument)
+• JSON - Pretty-printed export format (one file per instrument)
 • CSV - Excel-compatible format (one file per instrument)
+• Parquet - Hive-partitioned files for DuckDB, Polars and Spark
 
 Features:
 - Rate-limited API calls respecting Zerodha limits
 - Configurable date chunking for optimal performance
-- Authentication flow with token caching
+- Browser login with a cached daily session (see "auth")
 - Comprehensive logging and error handling
 - Multiple storage options for different use cases`, appName, appDescription),
 	Version: version,
@@ -56,10 +62,16 @@ func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config.yaml", "config file path")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose logging")
+	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", "", "Zerodha API key (overrides "+config.EnvPrefix+"API_KEY and config file)")
+	rootCmd.PersistentFlags().StringVar(&apiSecret, "api-secret", "", "Zerodha API secret (overrides "+config.EnvPrefix+"API_SECRET and config file)")
 
 	// Add subcommands
+	rootCmd.AddCommand(authCmd)
 	rootCmd.AddCommand(fetchCmd)
 	rootCmd.AddCommand(validateCmd)
 	rootCmd.AddCommand(storageCmd)
 	rootCmd.AddCommand(profileCmd)
+	rootCmd.AddCommand(queryCmd)
+	rootCmd.AddCommand(convertCmd)
+	rootCmd.AddCommand(configCmd)
 }
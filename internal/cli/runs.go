@@ -0,0 +1,268 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+	"zerodha-connect/internal/config"
+	"zerodha-connect/internal/logger"
+	"zerodha-connect/internal/storage"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Storage runs command flags
+	runsJob         string
+	runsStorageType string
+	runsStoragePath string
+	runsLimit       int
+	runsFormat      string
+)
+
+// Output formats of the storage runs command.
+var runsFormats = []string{"table", "json"}
+
+// storageRunsCmd represents the storage runs command
+var storageRunsCmd = &cobra.Command{
+	Use:   "runs [RUN_ID]",
+	Short: "List the fetch runs that wrote the store",
+	Long: `List the fetch runs recorded in the store the config points at, most recent
+first: when each ran, its status, the job, the tool version, the Kite user and
+the hash of the configuration it used, with the candles it fetched and stored.
+
+Given a run ID (or a unique prefix of one), print the result of every
+instrument of that run instead. Candles carry the ID of the run that wrote
+them; see the fetched_at and run_id columns of the query command.
+
+Databases record runs in the fetch_runs and fetch_run_results tables; file
+stores in a _fetch_runs.jsonl manifest in the storage directory.
+
+Examples:
+  # The last 20 runs
+  zerodha-connect storage runs
+
+  # Per-instrument results of one run
+  zerodha-connect storage runs 20240105T091500-3f9a1c
+
+  # All runs of another store as JSON
+  zerodha-connect storage runs --storage-type csv --storage-path data/csv --limit 0 --format json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runStorageRuns,
+}
+
+func runStorageRuns(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(runsFormats, runsFormat) {
+		return fmt.Errorf("unknown format %q (use one of: %s)", runsFormat, strings.Join(runsFormats, ", "))
+	}
+
+	flags := credentialFlags()
+	flags.StorageType = runsStorageType
+	flags.StoragePath = runsStoragePath
+	conf, err := loadConfig(configFile, true, flags)
+	if err != nil {
+		return err
+	}
+	job, err := storageJob(conf, runsJob, runsStorageType, runsStoragePath)
+	if err != nil {
+		return err
+	}
+	storageType, storagePath := job.EffectiveStorage()
+
+	appLogger := logger.NewSilent()
+	if verbose {
+		appLogger = logger.New(job.LogFile)
+	}
+	reader, err := storage.OpenReader(storage.StorageType(storageType), storagePath, appLogger)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	recorder, ok := reader.(storage.RunRecorder)
+	if !ok {
+		return fmt.Errorf("%s storage does not record fetch runs", storageType)
+	}
+	runs, err := recorder.FetchRuns()
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if len(args) == 1 {
+		run, err := findRun(runs, args[0])
+		if err != nil {
+			return err
+		}
+		if runsFormat == "json" {
+			return writeRunsJSON(out, run)
+		}
+		writeRunResults(out, run)
+		return nil
+	}
+
+	// Most recent first
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+	if runsLimit > 0 && len(runs) > runsLimit {
+		runs = runs[:runsLimit]
+	}
+	if runsFormat == "json" {
+		return writeRunsJSON(out, runs)
+	}
+	if len(runs) == 0 {
+		fmt.Fprintf(out, "📭 No fetch runs recorded in %s\n", storagePath)
+		return nil
+	}
+	writeRunsTable(out, storagePath, runs)
+	return nil
+}
+
+// findRun returns the run with an ID or a unique prefix of one.
+func findRun(runs []storage.FetchRun, id string) (storage.FetchRun, error) {
+	var matches []storage.FetchRun
+	for _, run := range runs {
+		if run.ID == id {
+			return run, nil
+		}
+		if strings.HasPrefix(run.ID, id) {
+			matches = append(matches, run)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return storage.FetchRun{}, fmt.Errorf("no fetch run %s", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return storage.FetchRun{}, fmt.Errorf("run ID prefix %s matches %d runs", id, len(matches))
+	}
+}
+
+func writeRunsJSON(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// runTotals sums the results of a run.
+func runTotals(run storage.FetchRun) (candles, stored, failedChunks int) {
+	for _, r := range run.Results {
+		candles += r.Candles
+		stored += r.Stored
+		failedChunks += r.FailedChunks
+	}
+	return candles, stored, failedChunks
+}
+
+// runDuration formats how long a run took, or "-" while it has not finished.
+func runDuration(run storage.FetchRun) string {
+	if run.FinishedAt.IsZero() {
+		return "-"
+	}
+	return run.FinishedAt.Sub(run.StartedAt).Round(time.Second).String()
+}
+
+// valueOr returns value, or fallback when it is empty.
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// shortHash abbreviates a config hash for display.
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func newRunsTable(out io.Writer, columns []string) *tablewriter.Table {
+	table := tablewriter.NewWriter(out)
+	table.SetHeader(columns)
+	table.SetBorder(true)
+	table.SetAutoFormatHeaders(false)
+	colors := make([]tablewriter.Colors, len(columns))
+	for i := range colors {
+		colors[i] = tablewriter.Colors{tablewriter.Bold, tablewriter.FgHiBlueColor}
+	}
+	table.SetHeaderColor(colors...)
+	return table
+}
+
+// writeRunsTable prints one row per run.
+func writeRunsTable(out io.Writer, storagePath string, runs []storage.FetchRun) {
+	fmt.Fprintf(out, "🧾 Fetch runs of %s\n", storagePath)
+	table := newRunsTable(out, []string{"run", "job", "status", "started", "duration", "instruments", "candles", "stored", "failed chunks", "user", "version", "config"})
+	for _, run := range runs {
+		candles, stored, failedChunks := runTotals(run)
+		table.Append([]string{
+			run.ID,
+			valueOr(run.Job, "-"),
+			run.Status,
+			run.StartedAt.In(calendar.IST).Format(config.DateTimeLayout),
+			runDuration(run),
+			fmt.Sprintf("%d", len(run.Results)),
+			fmt.Sprintf("%d", candles),
+			fmt.Sprintf("%d", stored),
+			fmt.Sprintf("%d", failedChunks),
+			valueOr(run.UserID, "-"),
+			valueOr(run.ToolVersion, "-"),
+			shortHash(run.ConfigHash),
+		})
+	}
+	table.Render()
+}
+
+// writeRunResults prints a run and the result of each of its instruments.
+func writeRunResults(out io.Writer, run storage.FetchRun) {
+	fmt.Fprintf(out, "🧾 Fetch run %s (%s)\n", run.ID, run.Status)
+	if run.Job != "" {
+		fmt.Fprintf(out, "   Job:      %s\n", run.Job)
+	}
+	fmt.Fprintf(out, "   Started:  %s\n", run.StartedAt.In(calendar.IST).Format(config.DateTimeLayout))
+	if !run.FinishedAt.IsZero() {
+		fmt.Fprintf(out, "   Finished: %s (%s)\n", run.FinishedAt.In(calendar.IST).Format(config.DateTimeLayout), runDuration(run))
+	}
+	fmt.Fprintf(out, "   User:     %s\n", valueOr(run.UserID, "-"))
+	fmt.Fprintf(out, "   Version:  %s\n", valueOr(run.ToolVersion, "-"))
+	fmt.Fprintf(out, "   Config:   %s\n", valueOr(run.ConfigHash, "-"))
+
+	if len(run.Results) == 0 {
+		fmt.Fprintln(out, "📭 No instrument results recorded")
+		return
+	}
+	table := newRunsTable(out, []string{"instrument", "interval", "candles", "stored", "failed chunks", "error"})
+	for _, r := range run.Results {
+		table.Append([]string{
+			storage.Series{Exchange: r.Series.Exchange, Symbol: r.Series.Symbol}.String(),
+			r.Series.Interval,
+			fmt.Sprintf("%d", r.Candles),
+			fmt.Sprintf("%d", r.Stored),
+			fmt.Sprintf("%d", r.FailedChunks),
+			r.Error,
+		})
+	}
+	table.Render()
+	candles, stored, failedChunks := runTotals(run)
+	fmt.Fprintf(out, "📦 %d instruments, %d candles fetched, %d stored, %d failed chunks\n", len(run.Results), candles, stored, failedChunks)
+}
+
+func init() {
+	storageCmd.AddCommand(storageRunsCmd)
+
+	storageRunsCmd.Flags().StringVar(&runsJob, "job", "", "list the runs of the storage of the named job from the config")
+	storageRunsCmd.Flags().StringVar(&runsStorageType, "storage-type", "", "storage type to inspect (overrides config)")
+	storageRunsCmd.Flags().StringVar(&runsStoragePath, "storage-path", "", "storage path to inspect (overrides config)")
+	storageRunsCmd.Flags().IntVar(&runsLimit, "limit", 20, "number of most recent runs to list (0 = all)")
+	storageRunsCmd.Flags().StringVar(&runsFormat, "format", "table", "output format ("+strings.Join(runsFormats, ", ")+")")
+}
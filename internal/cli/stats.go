@@ -0,0 +1,459 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+	"zerodha-connect/internal/config"
+	"zerodha-connect/internal/logger"
+	"zerodha-connect/internal/storage"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Storage stats command flags
+	statsJob         string
+	statsStorageType string
+	statsStoragePath string
+	statsInstruments []string
+	statsInterval    string
+	statsFormat      string
+	statsOutput      string
+)
+
+// Output formats of the storage stats command.
+var statsFormats = []string{"table", "json", "html"}
+
+// storageStatsCmd represents the storage stats command
+var storageStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Report the stored candles and trading day coverage of every series",
+	Long: `Inspect the store the config points at and report, for every instrument
+and interval, the number of candles, the first and last timestamp, the trading
+days holding candles against the trading days between them, the size on disk
+and when the series was last written.
+
+The last write is the latest fetched_at stamped on the candles by a fetch
+run. For series written before runs were recorded, the file backends (CSV,
+JSON, JSON Lines and Parquet) fall back to the modification time of the
+series' files, which also give their size. SQLite and DuckDB keep every series
+in one database file, whose size is reported in the totals instead.
+
+The report is printed as a table, as JSON, or as an HTML heatmap of the
+trading days covered per month, a single self-contained file to share.
+
+Examples:
+  # Coverage of the configured store
+  zerodha-connect storage stats
+
+  # Minute series of two instruments as JSON
+  zerodha-connect storage stats -i SBIN,NSE:RELIANCE --interval minute --format json
+
+  # Coverage heatmap of another store
+  zerodha-connect storage stats --storage-type csv --storage-path data/csv --format html --output coverage.html`,
+	RunE: runStorageStats,
+}
+
+// seriesStats is the storage stats report of one series.
+type seriesStats struct {
+	Exchange     string     `json:"exchange"`
+	Symbol       string     `json:"symbol"`
+	Interval     string     `json:"interval"`
+	Rows         int64      `json:"rows"`
+	First        time.Time  `json:"first"`
+	Last         time.Time  `json:"last"`
+	TradingDays  int        `json:"trading_days"`
+	ExpectedDays *int       `json:"expected_days"` // nil outside the years of the holiday list
+	SizeBytes    *int64     `json:"size_bytes,omitempty"`
+	LastFetch    *time.Time `json:"last_fetch,omitempty"`
+
+	// Candles per IST trading day, keyed by date
+	days map[string]int64
+}
+
+// Coverage returns the share of expected trading days holding candles, e.g.
+// "98.5%", or "?" when the expected days are unknown.
+func (s *seriesStats) Coverage() string {
+	switch {
+	case s.ExpectedDays == nil:
+		return "?"
+	case *s.ExpectedDays == 0:
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(s.TradingDays)/float64(*s.ExpectedDays))
+}
+
+// statsReport is the storage stats report of a store.
+type statsReport struct {
+	StorageType string         `json:"storage_type"`
+	StoragePath string         `json:"storage_path"`
+	SizeBytes   int64          `json:"size_bytes"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Series      []*seriesStats `json:"series"`
+}
+
+// collectSeriesStats reads a series once to count its candles per trading day.
+func collectSeriesStats(reader storage.Reader, series storage.Series) (*seriesStats, error) {
+	cov, err := reader.Coverage(series)
+	if err != nil {
+		return nil, err
+	}
+	stats := &seriesStats{
+		Exchange: series.Exchange,
+		Symbol:   series.Symbol,
+		Interval: series.Interval,
+		Rows:     cov.Rows,
+		First:    cov.First,
+		Last:     cov.Last,
+		days:     make(map[string]int64),
+	}
+	if !cov.LastFetched.IsZero() {
+		lastFetched := cov.LastFetched
+		stats.LastFetch = &lastFetched
+	}
+	err = reader.ReadRange(series, time.Time{}, time.Time{}, func(c storage.Candle) error {
+		if calendar.IsTradingDay(c.Timestamp) {
+			stats.days[calendar.Date(c.Timestamp).Format(config.DateLayout)]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.TradingDays = len(stats.days)
+	// The trading days of years outside the holiday list are unknown
+	switch {
+	case cov.Rows == 0:
+		stats.ExpectedDays = new(int)
+	case calendar.HolidaysKnown(cov.First, cov.Last):
+		expected := calendar.TradingDays(cov.First, cov.Last)
+		stats.ExpectedDays = &expected
+	}
+
+	if filer, ok := reader.(storage.SeriesFiler); ok {
+		usage, err := storage.SeriesUsage(filer, series)
+		if err != nil {
+			return nil, err
+		}
+		stats.SizeBytes = &usage.Size
+		if stats.LastFetch == nil && !usage.Modified.IsZero() {
+			modified := usage.Modified.In(calendar.IST).Truncate(time.Second)
+			stats.LastFetch = &modified
+		}
+	}
+	return stats, nil
+}
+
+func runStorageStats(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(statsFormats, statsFormat) {
+		return fmt.Errorf("unknown format %q (use one of: %s)", statsFormat, strings.Join(statsFormats, ", "))
+	}
+
+	flags := credentialFlags()
+	flags.StorageType = statsStorageType
+	flags.StoragePath = statsStoragePath
+	conf, err := loadConfig(configFile, true, flags)
+	if err != nil {
+		return err
+	}
+	job, err := storageJob(conf, statsJob, statsStorageType, statsStoragePath)
+	if err != nil {
+		return err
+	}
+	storageType, storagePath := job.EffectiveStorage()
+
+	appLogger := logger.NewSilent()
+	if verbose {
+		appLogger = logger.New(job.LogFile)
+	}
+	reader, err := storage.OpenReader(storage.StorageType(storageType), storagePath, appLogger)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	all, err := reader.ListSeries()
+	if err != nil {
+		return err
+	}
+	selected := filterSeries(all, statsInstruments, statsInterval)
+	if len(selected) == 0 {
+		return fmt.Errorf("no matching series in %s", storagePath)
+	}
+
+	report := &statsReport{
+		StorageType: storageType,
+		StoragePath: storagePath,
+		SizeBytes:   storageSize(storagePath),
+		GeneratedAt: time.Now().In(calendar.IST).Truncate(time.Second),
+	}
+	for _, s := range selected {
+		stats, err := collectSeriesStats(reader, s)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s, err)
+		}
+		report.Series = append(report.Series, stats)
+	}
+
+	out := cmd.OutOrStdout()
+	if statsOutput != "" {
+		file, err := os.Create(statsOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", statsOutput, err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	switch statsFormat {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	case "html":
+		err = writeStatsHTML(out, report)
+	default:
+		err = writeStatsTable(out, report)
+	}
+	if err != nil {
+		return err
+	}
+	if statsOutput != "" {
+		fmt.Printf("✅ Wrote %s report of %d series to %s\n", statsFormat, len(report.Series), statsOutput)
+	}
+	return nil
+}
+
+// writeStatsTable prints the report as a table followed by the totals.
+func writeStatsTable(out io.Writer, report *statsReport) error {
+	fmt.Fprintf(out, "📊 Storage stats of %s (%s)\n", report.StoragePath, report.StorageType)
+
+	columns := []string{"instrument", "interval", "rows", "first", "last", "days", "expected", "coverage", "size", "last fetch"}
+	table := tablewriter.NewWriter(out)
+	table.SetHeader(columns)
+	table.SetBorder(true)
+	table.SetAutoFormatHeaders(false)
+	colors := make([]tablewriter.Colors, len(columns))
+	for i := range colors {
+		colors[i] = tablewriter.Colors{tablewriter.Bold, tablewriter.FgHiBlueColor}
+	}
+	table.SetHeaderColor(colors...)
+
+	var rows int64
+	for _, s := range report.Series {
+		rows += s.Rows
+		size, lastFetch := "-", "-"
+		if s.SizeBytes != nil {
+			size = formatSize(*s.SizeBytes)
+		}
+		if s.LastFetch != nil {
+			lastFetch = s.LastFetch.Format(config.DateTimeLayout)
+		}
+		first, last, expected := "-", "-", "?"
+		if s.ExpectedDays != nil {
+			expected = fmt.Sprintf("%d", *s.ExpectedDays)
+		}
+		if s.Rows > 0 {
+			first, last = s.First.Format(config.DateTimeLayout), s.Last.Format(config.DateTimeLayout)
+		}
+		table.Append([]string{
+			storage.Series{Exchange: s.Exchange, Symbol: s.Symbol}.String(),
+			s.Interval,
+			fmt.Sprintf("%d", s.Rows),
+			first,
+			last,
+			fmt.Sprintf("%d", s.TradingDays),
+			expected,
+			s.Coverage(),
+			size,
+			lastFetch,
+		})
+	}
+	table.Render()
+
+	for _, s := range report.Series {
+		if s.ExpectedDays == nil {
+			fmt.Fprintln(out, "⚠️  ? marks series reaching beyond the years of the NSE holiday list, whose trading days are unknown")
+			break
+		}
+	}
+	fmt.Fprintf(out, "📦 %d series, %d candles, %s on disk\n", len(report.Series), rows, formatSize(report.SizeBytes))
+	return nil
+}
+
+// heatmapMonth is one column of the coverage heatmap.
+type heatmapMonth struct {
+	Label string
+	From  time.Time
+	To    time.Time
+}
+
+// heatmapCell is the coverage of one series in one month.
+type heatmapCell struct {
+	Class string
+	Title string
+	Text  string
+}
+
+// heatmapRow is one series of the coverage heatmap.
+type heatmapRow struct {
+	Name     string
+	Interval string
+	Coverage string
+	Cells    []heatmapCell
+}
+
+// heatmapClass buckets the share of covered trading days of a month into the
+// colour classes of the heatmap.
+func heatmapClass(covered, expected int) string {
+	switch {
+	case expected == 0:
+		return "none"
+	case covered == 0:
+		return "c0"
+	case covered >= expected:
+		return "c4"
+	case covered*100 >= expected*95:
+		return "c3"
+	case covered*100 >= expected*80:
+		return "c2"
+	default:
+		return "c1"
+	}
+}
+
+// writeStatsHTML renders the report as a heatmap of the trading days covered
+// per series and month, between the first and last candle of the whole store.
+func writeStatsHTML(out io.Writer, report *statsReport) error {
+	var first, last time.Time
+	for _, s := range report.Series {
+		if s.Rows == 0 {
+			continue
+		}
+		if first.IsZero() || s.First.Before(first) {
+			first = s.First
+		}
+		if s.Last.After(last) {
+			last = s.Last
+		}
+	}
+
+	var months []heatmapMonth
+	if !first.IsZero() {
+		start := calendar.Date(first)
+		end := calendar.Date(last)
+		for m := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, calendar.IST); !m.After(end); m = m.AddDate(0, 1, 0) {
+			from, to := m, m.AddDate(0, 1, -1)
+			if from.Before(start) {
+				from = start
+			}
+			if to.After(end) {
+				to = end
+			}
+			months = append(months, heatmapMonth{Label: m.Format("Jan 2006"), From: from, To: to})
+		}
+	}
+
+	rows := make([]heatmapRow, len(report.Series))
+	for i, s := range report.Series {
+		row := heatmapRow{
+			Name:     storage.Series{Exchange: s.Exchange, Symbol: s.Symbol}.String(),
+			Interval: s.Interval,
+			Coverage: s.Coverage(),
+		}
+		for _, m := range months {
+			covered := 0
+			for d := m.From; !d.After(m.To); d = d.AddDate(0, 0, 1) {
+				if s.days[d.Format(config.DateLayout)] > 0 {
+					covered++
+				}
+			}
+			if !calendar.HolidaysKnown(m.From, m.To) {
+				row.Cells = append(row.Cells, heatmapCell{
+					Class: "unknown",
+					Title: fmt.Sprintf("%s %s: %d days with candles, trading days unknown", row.Name, m.Label, covered),
+					Text:  fmt.Sprintf("%d", covered),
+				})
+				continue
+			}
+			expected := calendar.TradingDays(m.From, m.To)
+			cell := heatmapCell{
+				Class: heatmapClass(covered, expected),
+				Title: fmt.Sprintf("%s %s: %d of %d trading days", row.Name, m.Label, covered, expected),
+			}
+			if expected > 0 {
+				cell.Text = fmt.Sprintf("%d", covered)
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		rows[i] = row
+	}
+
+	return statsTemplate.Execute(out, map[string]interface{}{
+		"Report": report,
+		"Months": months,
+		"Rows":   rows,
+		"Size":   formatSize(report.SizeBytes),
+		"Time":   report.GeneratedAt.Format(config.DateTimeLayout),
+	})
+}
+
+// statsTemplate is the self-contained HTML page of the coverage heatmap.
+var statsTemplate = template.Must(template.New("stats").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Coverage of {{.Report.StoragePath}}</title>
+<style>
+  body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 24px; color: #24292f; }
+  h1 { font-size: 20px; margin-bottom: 4px; }
+  p.meta { color: #57606a; margin-top: 0; }
+  table { border-collapse: collapse; font-size: 12px; }
+  th, td { padding: 4px 6px; text-align: center; }
+  th.month { writing-mode: vertical-rl; transform: rotate(180deg); font-weight: normal; color: #57606a; }
+  td.name { text-align: left; white-space: nowrap; font-weight: 600; }
+  td.cell { min-width: 18px; border: 1px solid #fff; color: #24292f; }
+  .none { background: #f6f8fa; }
+  .c0 { background: #ff8182; }
+  .c1 { background: #ffd8b5; }
+  .c2 { background: #fff8c5; }
+  .c3 { background: #aceebb; }
+  .c4 { background: #4ac26b; }
+  .unknown { background: #ddf4ff; }
+  .legend span { display: inline-block; padding: 2px 8px; margin-right: 4px; }
+</style>
+</head>
+<body>
+<h1>📊 Coverage of {{.Report.StoragePath}} ({{.Report.StorageType}})</h1>
+<p class="meta">{{len .Rows}} series, {{.Size}} on disk, generated {{.Time}} IST. Each cell counts the trading days of the month holding candles.</p>
+<p class="legend">
+  <span class="c4">all days</span><span class="c3">&ge; 95%</span><span class="c2">&ge; 80%</span><span class="c1">&lt; 80%</span><span class="c0">no candles</span><span class="none">no trading days</span><span class="unknown">trading days unknown</span>
+</p>
+<table>
+<tr><th>instrument</th><th>interval</th><th>coverage</th>{{range .Months}}<th class="month">{{.Label}}</th>{{end}}</tr>
+{{range .Rows}}<tr><td class="name">{{.Name}}</td><td>{{.Interval}}</td><td>{{.Coverage}}</td>{{range .Cells}}<td class="cell {{.Class}}" title="{{.Title}}">{{.Text}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func init() {
+	storageCmd.AddCommand(storageStatsCmd)
+
+	storageStatsCmd.Flags().StringVar(&statsJob, "job", "", "report on the storage of the named job from the config")
+	storageStatsCmd.Flags().StringVar(&statsStorageType, "storage-type", "", "storage type to inspect (overrides config)")
+	storageStatsCmd.Flags().StringVar(&statsStoragePath, "storage-path", "", "storage path to inspect (overrides config)")
+	storageStatsCmd.Flags().StringSliceVarP(&statsInstruments, "instruments", "i", []string{}, "only these instruments (SYMBOL or EXCHANGE:SYMBOL)")
+	storageStatsCmd.Flags().StringVar(&statsInterval, "interval", "", "only this interval (minute, 5minute, day, etc.)")
+	storageStatsCmd.Flags().StringVar(&statsFormat, "format", "table", "output format ("+strings.Join(statsFormats, ", ")+")")
+	storageStatsCmd.Flags().StringVarP(&statsOutput, "output", "o", "", "write the report to this file instead of stdout")
+}
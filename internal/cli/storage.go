@@ -2,58 +2,358 @@ package cli
 
 import (
 	"fmt"
+	"os"
+	"slices"
+	"sort"
 	"strings"
 
+	"zerodha-connect/internal/config"
+	"zerodha-connect/internal/logger"
+	"zerodha-connect/internal/storage"
+
 	"github.com/spf13/cobra"
 )
 
+var (
+	// Storage compact command flags
+	compactJob         string
+	compactStorageType string
+	compactStoragePath string
+	compactInstruments []string
+
+	// Storage timezone command flags
+	timezoneJob         string
+	timezoneStorageType string
+	timezoneStoragePath string
+	timezoneTo          string
+)
+
 // storageCmd represents the storage command
 var storageCmd = &cobra.Command{
 	Use:   "storage",
-	Short: "Information about storage backends",
+	Short: "Information about storage backends and storage maintenance",
 	Long: `Display information about available storage backends and their use cases.
 
 This command helps you choose the right storage backend for your needs.`,
 	RunE: runStorage,
 }
 
+// storageCompactCmd represents the storage compact command
+var storageCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Sort stored files and drop duplicate candles",
+	Long: `Rewrite every stored series sorted by timestamp, keeping one candle per
+timestamp. Where a timestamp was written more than once, the most recently
+appended candle is kept.
+
+JSON Lines files only ever grow: refetching a range appends its candles again.
+Run this after such refetches, or periodically, to keep the files small and
+ordered. Each file is replaced atomically, so an interrupted compaction leaves
+either the old or the new file.
+
+Examples:
+  # Compact the store the config points at
+  zerodha-connect storage compact
+
+  # Compact some instruments of another store
+  zerodha-connect storage compact --storage-type jsonl --storage-path data/jsonl -i SBIN,NSE:RELIANCE`,
+	RunE: runStorageCompact,
+}
+
+// storageTimezoneCmd represents the storage timezone command
+var storageTimezoneCmd = &cobra.Command{
+	Use:   "timezone",
+	Short: "Show or convert the timezone stored timestamps are in",
+	Long: `Show the storage timezone recorded for a store, or rewrite its timestamps
+in place for another one with --to.
+
+Every store records the zone its timestamps are written in: CSV files and
+DuckDB hold wall-clock time of that zone, JSON and JSON Lines files carry its
+UTC offset. Data written before the zone was recorded is treated as IST for
+CSV, JSON and JSON Lines and as UTC for DuckDB. SQLite and Parquet always
+store UTC.
+
+Conversion keeps every candle at the same instant. File stores are rewritten
+next to the originals and swapped in once all are converted; DuckDB converts
+in a single transaction. Set storage_timezone in the config to the new zone
+afterwards.
+
+Examples:
+  # Show the zone of the store the config points at
+  zerodha-connect storage timezone
+
+  # Convert a CSV store from IST to UTC wall time
+  zerodha-connect storage timezone --storage-type csv --storage-path data/csv --to UTC`,
+	RunE: runStorageTimezone,
+}
+
+// storageOptions returns the backend options set in a job config.
+func storageOptions(conf *config.Config) (storage.Options, error) {
+	compression, err := storage.ParseCompression(conf.Compression)
+	if err != nil {
+		return storage.Options{}, err
+	}
+	timezone, err := storage.ParseTimezone(conf.StorageTimezone)
+	if err != nil {
+		return storage.Options{}, err
+	}
+	return storage.Options{Compression: compression, FlushRows: conf.FlushRows, PathTemplate: conf.PathTemplate,
+		Timezone: timezone}, nil
+}
+
+// storageJob returns the config of the store a command reads or maintains:
+// the selected job, or, when --storage-type or --storage-path point at a store
+// and no job is named, the config with those flags applied whatever jobs it
+// defines.
+func storageJob(conf *config.Config, job, storageType, storagePath string) (*config.Config, error) {
+	if job == "" && (storageType != "" || storagePath != "") {
+		return conf, nil
+	}
+	return conf.SelectJob(job)
+}
+
 func runStorage(cmd *cobra.Command, args []string) error {
 	fmt.Println("📦 Available Storage Backends")
 	fmt.Println(strings.Repeat("=", 50))
 
-	fmt.Println("\n🚀 DuckDB (default)")
-	fmt.Println("  - Best for: Analytical queries, time series analysis")
-	fmt.Println("  - Format: Single database file (.duckdb)")
-	fmt.Println("  - Pros: Fast aggregations, SQL queries, columnar storage")
-	fmt.Println("  - Cons: Requires DuckDB to query")
-	fmt.Println("  - Example: storage_type: \"duckdb\", storage_path: \"market_data.duckdb\"")
-
-	fmt.Println("\n💾 SQLite")
-	fmt.Println("  - Best for: Universal compatibility, small to medium datasets")
-	fmt.Println("  - Format: Single database file (.sqlite)")
-	fmt.Println("  - Pros: Widely supported, portable, SQL queries")
-	fmt.Println("  - Cons: Slower for large analytical workloads")
-	fmt.Println("  - Example: storage_type: \"sqlite\", storage_path: \"market_data.sqlite\"")
-
-	fmt.Println("\n📄 JSON")
-	fmt.Println("  - Best for: Human-readable data, debugging, small datasets")
-	fmt.Println("  - Format: One JSON file per instrument")
-	fmt.Println("  - Pros: Human-readable, easy to inspect, no database required")
-	fmt.Println("  - Cons: Large file sizes, slower queries")
-	fmt.Println("  - Example: storage_type: \"json\", storage_path: \"./data/json/\"")
-
-	fmt.Println("\n📊 CSV")
-	fmt.Println("  - Best for: Excel compatibility, data analysis tools")
-	fmt.Println("  - Format: One CSV file per instrument")
-	fmt.Println("  - Pros: Excel/spreadsheet compatible, widely supported")
-	fmt.Println("  - Cons: No data types, larger files, manual schema")
-	fmt.Println("  - Example: storage_type: \"csv\", storage_path: \"./data/csv/\"")
+	// The default backend first, then the others by name
+	backends := storage.Backends()
+	sort.SliceStable(backends, func(i, j int) bool {
+		return backends[i].Name == config.DefaultStorageType && backends[j].Name != config.DefaultStorageType
+	})
+	for _, b := range backends {
+		showBackend(b)
+	}
+
+	fmt.Printf("\n🗜️  Compression (%s)\n", backendTitles(func(s storage.Schema) bool { return s.Compression }))
+	fmt.Println("  - Set compression: \"gzip\" or \"zstd\" to write SYMBOL.csv.gz, SYMBOL.jsonl.zst, ...")
+	fmt.Println("  - Appends add a compressed member; compressed and plain files are read alike")
+
+	fmt.Printf("\n📁 Path templates (%s)\n", backendTitles(func(s storage.Schema) bool { return s.PathTemplate }))
+	fmt.Printf("  - Default: %s; set path_template: \"{exchange}/{interval}/{symbol}/{year}\" for one file per year\n",
+		storage.DefaultPathTemplate)
+	fmt.Println("  - Placeholders: {exchange}, {interval}, {symbol}, {year}, {month}; NIFTY 50 is written as NIFTY%2050")
+	fmt.Println("  - The template is recorded with the data; copy a store into another layout with 'convert --to-path-template'")
+
+	fmt.Println("\n🕒 Timezones")
+	fmt.Printf("  - Set storage_timezone: \"UTC\" or \"Asia/Kolkata\" (%s); %s store UTC\n",
+		backendTitles(func(s storage.Schema) bool { return s.SupportsTimezone(storage.TimezoneIST) }),
+		backendTitles(func(s storage.Schema) bool { return !s.SupportsTimezone(storage.TimezoneIST) }))
+	fmt.Println("  - The zone is recorded with the data; convert a store with 'storage timezone --to UTC'")
 
 	fmt.Println("\n💡 Recommendations:")
 	fmt.Println("  - For backtesting/analysis: DuckDB")
+	fmt.Println("  - For research notebooks and data lakes: Parquet")
 	fmt.Println("  - For universal compatibility: SQLite")
 	fmt.Println("  - For Excel analysis: CSV")
-	fmt.Println("  - For inspection/debugging: JSON")
+	fmt.Println("  - For plain text files: JSON Lines (with zstd compression for large histories)")
+	fmt.Println("  - For inspection/debugging: JSON (e.g. zerodha-connect convert --to-type json)")
+
+	return nil
+}
+
+// showBackend prints the description and settings of a storage backend.
+func showBackend(b storage.Backend) {
+	title := b.Description.Title
+	if title == "" {
+		title = "📦 " + string(b.Name)
+	}
+	if b.Name == config.DefaultStorageType {
+		title += " (default)"
+	}
+	fmt.Printf("\n%s\n", title)
+	for _, line := range [][2]string{
+		{"Best for", b.Description.BestFor},
+		{"Format", b.Description.Format},
+		{"Pros", b.Description.Pros},
+		{"Cons", b.Description.Cons},
+	} {
+		if line[1] != "" {
+			fmt.Printf("  - %s: %s\n", line[0], line[1])
+		}
+	}
+
+	settings := []string{"storage_timezone: UTC"}
+	if b.Schema.SupportsTimezone(storage.TimezoneIST) {
+		settings[0] = "storage_timezone: UTC or Asia/Kolkata"
+	}
+	if b.Schema.Compression {
+		settings = append(settings, "compression")
+	}
+	if b.Schema.PathTemplate {
+		settings = append(settings, "path_template")
+	}
+	if b.Schema.FlushRows {
+		settings = append(settings, "flush_rows")
+	}
+	fmt.Printf("  - Settings: %s\n", strings.Join(settings, ", "))
+	fmt.Printf("  - Example: storage_type: \"%s\", storage_path: \"%s\"\n", b.Name, b.Schema.DefaultPath)
+}
+
+// backendTitles lists the names of the registered backends whose schema
+// matches, e.g. "CSV, JSON, JSON Lines".
+func backendTitles(match func(storage.Schema) bool) string {
+	var titles []string
+	for _, b := range storage.Backends() {
+		if !match(b.Schema) {
+			continue
+		}
+		// Titles start with an emoji
+		title := string(b.Name)
+		if _, name, ok := strings.Cut(b.Description.Title, " "); ok {
+			title = name
+		}
+		titles = append(titles, title)
+	}
+	return strings.Join(titles, ", ")
+}
+
+func runStorageCompact(cmd *cobra.Command, args []string) error {
+	flags := credentialFlags()
+	flags.StorageType = compactStorageType
+	flags.StoragePath = compactStoragePath
+	conf, err := loadConfig(configFile, true, flags)
+	if err != nil {
+		return err
+	}
+	job, err := storageJob(conf, compactJob, compactStorageType, compactStoragePath)
+	if err != nil {
+		return err
+	}
+	storageType, storagePath := job.EffectiveStorage()
+
+	appLogger := logger.NewSilent()
+	if verbose {
+		appLogger = logger.New(job.LogFile)
+	}
+	if !isValidStorageType(storageType) {
+		return &storage.UnknownTypeError{Name: storage.StorageType(storageType)}
+	}
+	if _, err := os.Stat(storagePath); err != nil {
+		return fmt.Errorf("no %s data at %s: %v", storageType, storagePath, err)
+	}
+	// Compacted files are written in the configured compression
+	opts, err := storageOptions(job)
+	if err != nil {
+		return err
+	}
+	store, err := storage.NewStore(storage.StorageType(storageType), storagePath, opts, appLogger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	reader, isReader := store.(storage.Reader)
+	compactor, isCompactor := store.(storage.Compactor)
+	if !isReader || !isCompactor {
+		return fmt.Errorf("%s storage does not need compaction", storageType)
+	}
+
+	all, err := reader.ListSeries()
+	if err != nil {
+		return err
+	}
+	var selected []storage.Series
+	for _, s := range all {
+		if len(compactInstruments) == 0 || slices.Contains(compactInstruments, s.Symbol) ||
+			slices.Contains(compactInstruments, s.Exchange+":"+s.Symbol) {
+			selected = append(selected, s)
+		}
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no matching series in %s", storagePath)
+	}
+
+	fmt.Printf("🗜️  Compacting %d series in %s (%s)\n", len(selected), storagePath, storageType)
+	var totalBefore, totalAfter int64
+	for i, s := range selected {
+		before, after, err := compactor.CompactSeries(s)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s, err)
+		}
+		totalBefore += before
+		totalAfter += after
+		fmt.Printf("   [%d/%d] %s: %d -> %d candles\n", i+1, len(selected), s, before, after)
+	}
 
+	fmt.Printf("✅ Compacted %d series, removed %d duplicate candles\n", len(selected), totalBefore-totalAfter)
 	return nil
 }
+
+func runStorageTimezone(cmd *cobra.Command, args []string) error {
+	flags := credentialFlags()
+	flags.StorageType = timezoneStorageType
+	flags.StoragePath = timezoneStoragePath
+	conf, err := loadConfig(configFile, true, flags)
+	if err != nil {
+		return err
+	}
+	job, err := storageJob(conf, timezoneJob, timezoneStorageType, timezoneStoragePath)
+	if err != nil {
+		return err
+	}
+	storageType, storagePath := job.EffectiveStorage()
+
+	to, err := storage.ParseTimezone(timezoneTo)
+	if err != nil {
+		return err
+	}
+
+	appLogger := logger.NewSilent()
+	if verbose {
+		appLogger = logger.New(job.LogFile)
+	}
+	if !isValidStorageType(storageType) {
+		return &storage.UnknownTypeError{Name: storage.StorageType(storageType)}
+	}
+	if _, err := os.Stat(storagePath); err != nil {
+		return fmt.Errorf("no %s data at %s: %v", storageType, storagePath, err)
+	}
+	store, err := storage.NewStore(storage.StorageType(storageType), storagePath, storage.Options{}, appLogger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	converter, ok := store.(storage.TimezoneConverter)
+	if !ok {
+		return fmt.Errorf("%s storage does not record a timezone", storageType)
+	}
+	from, err := converter.StoredTimezone()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🕒 %s (%s) stores timestamps in %s\n", storagePath, storageType, from)
+	if to == "" {
+		return nil
+	}
+	if to == from {
+		fmt.Printf("✅ Already in %s, nothing to convert\n", to)
+		return nil
+	}
+
+	fmt.Printf("🔄 Converting timestamps from %s to %s...\n", from, to)
+	if err := converter.ConvertTimezone(to); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Converted %s to %s\n", storagePath, to)
+	if job.StorageTimezone != "" && !strings.EqualFold(job.StorageTimezone, string(to)) {
+		fmt.Printf("💡 Set storage_timezone: %q in the config before the next fetch\n", string(to))
+	}
+	return nil
+}
+
+func init() {
+	storageCmd.AddCommand(storageCompactCmd)
+	storageCmd.AddCommand(storageTimezoneCmd)
+
+	storageCompactCmd.Flags().StringVar(&compactJob, "job", "", "compact the storage of the named job from the config")
+	storageCompactCmd.Flags().StringVar(&compactStorageType, "storage-type", "", "storage type to compact (overrides config)")
+	storageCompactCmd.Flags().StringVar(&compactStoragePath, "storage-path", "", "storage path to compact (overrides config)")
+	storageCompactCmd.Flags().StringSliceVarP(&compactInstruments, "instruments", "i", []string{}, "only compact these instruments (SYMBOL or EXCHANGE:SYMBOL)")
+
+	storageTimezoneCmd.Flags().StringVar(&timezoneJob, "job", "", "use the storage of the named job from the config")
+	storageTimezoneCmd.Flags().StringVar(&timezoneStorageType, "storage-type", "", "storage type (overrides config)")
+	storageTimezoneCmd.Flags().StringVar(&timezoneStoragePath, "storage-path", "", "storage path (overrides config)")
+	storageTimezoneCmd.Flags().StringVar(&timezoneTo, "to", "", "convert the stored timestamps to this timezone (UTC or Asia/Kolkata)")
+}
@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"slices"
 	"strings"
 	"time"
 
 	"zerodha-connect/internal/config"
 	"zerodha-connect/internal/kite"
 	"zerodha-connect/internal/storage"
+	"zerodha-connect/internal/ui"
 
 	"github.com/spf13/cobra"
 )
@@ -34,21 +37,51 @@ Examples:
   zerodha-connect validate
 
   # Validate specific config file
-  zerodha-connect validate --config my-config.yaml`,
+  zerodha-connect validate --config my-config.yaml
+
+  # Review suggested corrections for unknown symbols and write them to the config
+  zerodha-connect validate --fix
+
+Configs with a jobs section are validated job by job, with errors reported
+as jobs[name].field.
+
+Instruments are checked against the instrument master. Symbols that are not
+found are listed with suggestions for wrong case, a wrong or missing exchange,
+expired derivative contracts and near misses.`,
 	RunE: runValidate,
 }
 
+// fixInstruments enables interactive correction of unknown instruments.
+var fixInstruments bool
+
+// instrumentIssue is a configured symbol missing from the instrument master.
+type instrumentIssue struct {
+	symbol      string
+	suggestions []kite.Suggestion
+}
+
 func runValidate(cmd *cobra.Command, args []string) error {
 	fmt.Printf("🔍 Validating: %s\n\n", configFile)
 
 	// Load configuration
-	conf, err := config.Load(configFile)
+	conf, err := config.Resolve(configFile, false, credentialFlags())
+	if err != nil {
+		return fmt.Errorf("❌ Config file error: %v", err)
+	}
+	warnOutdatedConfig(conf, configFile)
+
+	jobs, err := conf.SelectJobs(nil, true)
 	if err != nil {
 		return fmt.Errorf("❌ Config file error: %v", err)
 	}
 
 	// Perform field-by-field validation report
-	showFieldValidationReport(conf)
+	for _, job := range jobs {
+		if job.JobName != "" {
+			fmt.Printf("📂 Job: %s\n", job.JobName)
+		}
+		showFieldValidationReport(job)
+	}
 
 	// Perform comprehensive validation
 	validation := conf.ValidateComplete()
@@ -67,44 +100,92 @@ func runValidate(cmd *cobra.Command, args []string) error {
 	tempLogger := log.New(io.Discard, "", 0)
 
 	// Test storage
-	if err := testStorage(conf, tempLogger); err != nil {
-		fmt.Printf("   ❌ Storage: %v\n", err)
-		return fmt.Errorf("storage test failed")
+	for _, job := range jobs {
+		if err := testStorage(job, tempLogger); err != nil {
+			fmt.Printf("   ❌ Storage%s: %v\n", jobSuffix(job), err)
+			return fmt.Errorf("storage test failed")
+		}
+		fmt.Printf("   ✅ Storage%s: Ready\n", jobSuffix(job))
 	}
-	fmt.Println("   ✅ Storage: Ready")
 
 	// Test API
-	if err := testAPI(conf, tempLogger, configFile); err != nil {
+	kiteClient := kite.NewClientWithConfigPath(conf, tempLogger, configFile)
+	if err := requireSession(kiteClient); err != nil {
 		fmt.Printf("   ❌ API: %v\n", err)
 		return fmt.Errorf("API test failed")
 	}
 	fmt.Println("   ✅ API: Connected")
 
 	// Test instruments
-	validCount, totalCount, err := testInstruments(conf, tempLogger, configFile)
+	instrumentList, err := kite.GetInstruments(kiteClient.GetKiteConnectClient(), tempLogger)
 	if err != nil {
-		fmt.Printf("   ❌ Instruments: %v\n", err)
+		fmt.Println("   ❌ Instruments: API fetch failed")
 		return fmt.Errorf("instrument test failed")
 	}
-	fmt.Printf("   ✅ Instruments: %d/%d valid\n", validCount, totalCount)
+	index := kite.NewInstrumentIndex(instrumentList)
+
+	var issues []instrumentIssue
+	reported := make(map[string]bool)
+	for _, job := range jobs {
+		validCount, jobIssues := testInstruments(job, index)
+		status := "✅"
+		if len(jobIssues) > 0 {
+			status = "⚠️ "
+		}
+		if validCount == 0 {
+			status = "❌"
+		}
+		fmt.Printf("   %s Instruments%s: %d/%d found\n", status, jobSuffix(job), validCount, len(job.Instruments))
+		for _, issue := range jobIssues {
+			showInstrumentIssue(issue)
+			if !reported[issue.symbol] {
+				reported[issue.symbol] = true
+				issues = append(issues, issue)
+			}
+		}
+		if validCount == 0 {
+			return fmt.Errorf("instrument test failed: no valid symbols found")
+		}
+	}
+
+	if len(issues) > 0 {
+		if fixInstruments {
+			if err := applyInstrumentFixes(issues); err != nil {
+				return err
+			}
+		} else {
+			fmt.Printf("   💡 Run '%s validate --fix' to review and apply the suggestions\n", appName)
+		}
+	}
 
 	// Show execution estimate
-	showExecutionEstimate(conf)
+	for _, job := range jobs {
+		showExecutionEstimate(job)
+	}
 
 	fmt.Println("\n🎉 All validations passed!")
 	fmt.Println("   Ready to fetch data")
 	return nil
 }
 
+// jobSuffix labels per-job output lines for multi-job configs.
+func jobSuffix(conf *config.Config) string {
+	if conf.JobName == "" {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", conf.JobName)
+}
+
 func showFieldValidationReport(conf *config.Config) {
 	fmt.Println("📋 Configuration Check:")
 
 	// Check if we have a valid date range first
+	now := time.Now()
+	from, fromOK := resolveDate(conf, conf.FromDate, now, false)
+	to, toOK := resolveDate(conf, conf.ToDate, now, true)
 	var dateRangeValid bool
 	var dateRangeError string
-	if isValidDate(conf.FromDate) && isValidDate(conf.ToDate) {
-		from, _ := time.Parse("2006-01-02", conf.FromDate)
-		to, _ := time.Parse("2006-01-02", conf.ToDate)
+	if fromOK && toOK {
 		dateRangeValid = from.Before(to)
 		if !dateRangeValid {
 			dateRangeError = "from_date must be before to_date"
@@ -114,32 +195,72 @@ func showFieldValidationReport(conf *config.Config) {
 	// Required fields - show date fields as invalid if range is invalid
 	checkField("API Key", conf.APIKey != "", conf.APIKey != "")
 	checkField("API Secret", conf.APISecret != "", conf.APISecret != "")
-	checkField("Instruments", len(conf.Instruments) > 0, fmt.Sprintf("%d symbols", len(conf.Instruments)))
+	custom := 0
+	for _, instrument := range conf.Instruments {
+		if instrument.HasOverrides() {
+			custom++
+		}
+	}
+	instrumentsNote := fmt.Sprintf("%d symbols", len(conf.Instruments))
+	if custom > 0 {
+		instrumentsNote += fmt.Sprintf(", %d with their own settings", custom)
+	}
+	checkField("Instruments", len(conf.Instruments) > 0, instrumentsNote)
 
 	// Date validation with range check
-	fromDateValid := isValidDate(conf.FromDate) && (dateRangeValid || conf.ToDate == "")
-	toDateValid := isValidDate(conf.ToDate) && (dateRangeValid || conf.FromDate == "")
+	if len(conf.Windows) > 0 {
+		ranges, err := conf.TimeRanges(now)
+		checkField("Windows", err == nil, fmt.Sprintf("%d definitions, %d time ranges", len(conf.Windows), len(ranges)))
+	} else {
+		fromDateValid := fromOK && (dateRangeValid || conf.ToDate == "")
+		toDateValid := toOK && (dateRangeValid || conf.FromDate == "")
 
-	checkFieldWithNote("From Date", fromDateValid, conf.FromDate, dateRangeError)
-	checkFieldWithNote("To Date", toDateValid, conf.ToDate, dateRangeError)
-	checkField("Interval", isValidInterval(conf.Interval), conf.Interval)
+		checkFieldWithNote("From Date", fromDateValid, describeDate(conf.FromDate, from, fromOK), dateRangeError)
+		checkFieldWithNote("To Date", toDateValid, describeDate(conf.ToDate, to, toOK), dateRangeError)
+	}
+	checkField("Interval", isValidIntervals(conf.Interval), conf.Interval.String())
 
 	// Optional fields
 	storageType := conf.StorageType
 	if storageType == "" {
 		storageType = "duckdb (default)"
 	}
-	checkField("Storage Type", isValidStorageType(conf.StorageType), storageType)
+	if conf.HasTargets() {
+		var names []string
+		targetsValid := true
+		for _, t := range conf.StorageTargets {
+			names = append(names, fmt.Sprintf("%s (%s)", t.DisplayName(), t.StorageType))
+			targetsValid = targetsValid && t.StorageType != "" && isValidStorageType(t.StorageType)
+		}
+		checkField("Storage Targets", targetsValid, strings.Join(names, ", "))
+	} else {
+		checkField("Storage Type", isValidStorageType(conf.StorageType), storageType)
+	}
 
 	// Date range check
-	if isValidDate(conf.FromDate) && isValidDate(conf.ToDate) {
-		from, _ := time.Parse("2006-01-02", conf.FromDate)
-		to, _ := time.Parse("2006-01-02", conf.ToDate)
-		days := int(to.Sub(from).Hours() / 24)
+	if fromOK && toOK && len(conf.Windows) == 0 {
+		days := int(math.Ceil(to.Sub(from).Hours() / 24))
 		checkField("Date Range", from.Before(to), fmt.Sprintf("%d days", days))
 	}
 }
 
+// resolveDate resolves a date expression of the config, reporting whether it is valid.
+func resolveDate(conf *config.Config, expr string, now time.Time, endOfDay bool) (time.Time, bool) {
+	if expr == "" {
+		return time.Time{}, false
+	}
+	d, err := config.ResolveTime(expr, now, conf.Interval.First(), endOfDay)
+	return d, err == nil
+}
+
+// describeDate shows a date value, adding the resolved date for symbolic expressions.
+func describeDate(expr string, resolved time.Time, ok bool) string {
+	if ok && config.IsDateExpression(expr) {
+		return fmt.Sprintf("%s → %s", expr, resolved.Format(config.DateLayout))
+	}
+	return expr
+}
+
 func checkField(name string, isValid bool, value interface{}) {
 	checkFieldWithNote(name, isValid, value, "")
 }
@@ -179,28 +300,25 @@ func checkFieldWithNote(name string, isValid bool, value interface{}, note strin
 }
 
 func testStorage(conf *config.Config, logger *log.Logger) error {
-	storageType := storage.StorageType(conf.StorageType)
-	if storageType == "" {
-		storageType = storage.StorageTypeDuckDB
-	}
-	storagePath := conf.StoragePath
-	if storagePath == "" && conf.DuckDBPath != "" {
-		storagePath = conf.DuckDBPath
-	}
-	if storagePath == "" {
-		switch storageType {
-		case storage.StorageTypeJSON:
-			storagePath = "data/json"
-		case storage.StorageTypeCSV:
-			storagePath = "data/csv"
-		case storage.StorageTypeSQLite:
-			storagePath = "market_data.sqlite"
-		default:
-			storagePath = "market_data.duckdb"
+	for _, tc := range conf.Targets() {
+		if err := testStore(tc, logger); err != nil {
+			if tc.TargetName != "" {
+				return fmt.Errorf("target %s: %v", tc.TargetName, err)
+			}
+			return err
 		}
 	}
+	return nil
+}
 
-	store, err := storage.NewStore(storageType, storagePath, logger)
+// testStore checks that the single store of a config can be set up.
+func testStore(conf *config.Config, logger *log.Logger) error {
+	storageType, storagePath := conf.EffectiveStorage()
+	opts, err := storageOptions(conf)
+	if err != nil {
+		return err
+	}
+	store, err := storage.NewStore(storage.StorageType(storageType), storagePath, opts, logger)
 	if err != nil {
 		return fmt.Errorf("initialization failed")
 	}
@@ -212,58 +330,99 @@ func testStorage(conf *config.Config, logger *log.Logger) error {
 	return nil
 }
 
-func testAPI(conf *config.Config, logger *log.Logger, configPath string) error {
-	kiteClient := kite.NewClientWithConfigPath(conf, logger, configPath)
-	if err := kiteClient.Authenticate(); err != nil {
-		return fmt.Errorf("authentication failed")
+// testInstruments resolves the configured instruments against the instrument
+// master and returns the number found along with suggestions for the rest.
+func testInstruments(conf *config.Config, index *kite.InstrumentIndex) (int, []instrumentIssue) {
+	now := time.Now()
+	validCount := 0
+	var issues []instrumentIssue
+	for _, symbol := range conf.Symbols() {
+		if _, ok := index.Lookup(symbol); ok {
+			validCount++
+			continue
+		}
+		issues = append(issues, instrumentIssue{
+			symbol:      symbol,
+			suggestions: index.Suggest(symbol, now, 3),
+		})
 	}
-	return nil
+	return validCount, issues
 }
 
-func testInstruments(conf *config.Config, logger *log.Logger, configPath string) (int, int, error) {
-	kiteClient := kite.NewClientWithConfigPath(conf, logger, configPath)
-	if err := kiteClient.Authenticate(); err != nil {
-		return 0, 0, err
+// showInstrumentIssue prints a symbol that was not found and its suggestions.
+func showInstrumentIssue(issue instrumentIssue) {
+	if len(issue.suggestions) == 0 {
+		fmt.Printf("      ❓ %s: not found, no similar symbols\n", issue.symbol)
+		return
 	}
-
-	instruments, err := kite.GetInstruments(kiteClient.GetKiteConnectClient(), logger)
-	if err != nil {
-		return 0, 0, fmt.Errorf("API fetch failed")
-	}
-
-	// Validate requested instruments
-	instrumentTokenMap := make(map[string]int)
-	for _, instr := range instruments {
-		instrumentTokenMap[instr.Tradingsymbol] = int(instr.InstrumentToken)
+	fmt.Printf("      ❓ %s: not found, did you mean:\n", issue.symbol)
+	for _, s := range issue.suggestions {
+		fmt.Printf("         → %s (%s)\n", s.Symbol, s.Reason)
 	}
+}
 
-	validCount := 0
-	for _, symbol := range conf.Instruments {
-		if _, exists := instrumentTokenMap[symbol]; exists {
-			validCount++
+// applyInstrumentFixes asks which suggestion to use for every unknown symbol
+// and rewrites the instrument lists of the config file accordingly.
+func applyInstrumentFixes(issues []instrumentIssue) error {
+	replacements := make(map[string]string)
+	for _, issue := range issues {
+		if len(issue.suggestions) == 0 {
+			continue
+		}
+		options := make([]string, len(issue.suggestions))
+		for i, s := range issue.suggestions {
+			options[i] = fmt.Sprintf("%s (%s)", s.Symbol, s.Reason)
+		}
+		if choice := ui.ChooseReplacement(issue.symbol, options); choice >= 0 {
+			replacements[issue.symbol] = issue.suggestions[choice].Symbol
 		}
 	}
-
-	if validCount == 0 {
-		return 0, len(conf.Instruments), fmt.Errorf("no valid symbols found")
+	if len(replacements) == 0 {
+		fmt.Println("\n   No changes made")
+		return nil
 	}
 
-	return validCount, len(conf.Instruments), nil
+	changed, err := config.ReplaceInstruments(configFile, replacements)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %v", configFile, err)
+	}
+	if changed == 0 {
+		fmt.Printf("\n   ⚠️  None of the symbols are listed in %s (set via flags or environment?)\n", configFile)
+		return nil
+	}
+	fmt.Printf("\n   ✅ Updated %d instrument(s) in %s\n", changed, configFile)
+	return nil
 }
 
 func showExecutionEstimate(conf *config.Config) {
-	from, _ := time.Parse("2006-01-02", conf.FromDate)
-	to, _ := time.Parse("2006-01-02", conf.ToDate)
-
-	// Rough estimate based on valid instruments
-	chunks := kite.GenerateDateChunks(from, to, conf.Interval)
-	totalAPICalls := len(chunks) * len(conf.Instruments) // Approximate
+	// Rough estimate based on the configured instruments, before clamping;
+	// dates are already validated
+	totalAPICalls := 0
+	var intervals []string
+	intervalCalls := make(map[string]int)
+	for _, instrument := range conf.Instruments {
+		ic := conf.ForInstrument(instrument)
+		for _, interval := range ic.Interval {
+			ranges, _ := ic.ForInterval(interval).TimeRanges(time.Now())
+			calls := len(planChunks(ranges, interval))
+			totalAPICalls += calls
+			if !slices.Contains(intervals, interval) {
+				intervals = append(intervals, interval)
+			}
+			intervalCalls[interval] += calls
+		}
+	}
 
 	estimatedTimeSeconds := float64(totalAPICalls) / float64(kite.RateLimitRequestsPerSecond)
 	estimatedMinutes := int(estimatedTimeSeconds / 60)
 
-	fmt.Println("\n⏱️  Execution Estimate:")
+	fmt.Printf("\n⏱️  Execution Estimate%s:\n", jobSuffix(conf))
 	fmt.Printf("   📊 API Calls: ~%d\n", totalAPICalls)
+	if len(intervals) > 1 {
+		for _, interval := range intervals {
+			fmt.Printf("      • %s: ~%d\n", interval, intervalCalls[interval])
+		}
+	}
 	if estimatedMinutes > 0 {
 		fmt.Printf("   ⏳ Time: ~%d minutes\n", estimatedMinutes)
 	} else {
@@ -271,30 +430,24 @@ func showExecutionEstimate(conf *config.Config) {
 	}
 }
 
-func isValidDate(date string) bool {
-	_, err := time.Parse("2006-01-02", date)
-	return err == nil
-}
-
-func isValidInterval(interval string) bool {
+func isValidIntervals(intervals config.Intervals) bool {
 	validIntervals := []string{"minute", "3minute", "5minute", "10minute", "15minute", "30minute", "60minute", "day"}
-	for _, valid := range validIntervals {
-		if interval == valid {
-			return true
+	for _, interval := range intervals {
+		if !slices.Contains(validIntervals, interval) {
+			return false
 		}
 	}
-	return false
+	return len(intervals) > 0
 }
 
 func isValidStorageType(storageType string) bool {
 	if storageType == "" {
 		return true // Default is valid
 	}
-	validTypes := []string{"duckdb", "sqlite", "json", "csv"}
-	for _, valid := range validTypes {
-		if storageType == valid {
-			return true
-		}
-	}
-	return false
+	_, ok := storage.Lookup(storage.StorageType(storageType))
+	return ok
+}
+
+func init() {
+	validateCmd.Flags().BoolVar(&fixInstruments, "fix", false, "interactively replace unknown instruments with suggested symbols")
 }
@@ -1,30 +1,66 @@
 package config
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"time"
 
+	"zerodha-connect/internal/storage"
+
 	"gopkg.in/yaml.v3"
 )
 
 // Config holds all the configuration for the application.
 type Config struct {
-	APIKey       string   `yaml:"api_key"`
-	APISecret    string   `yaml:"api_secret"`
-	RequestToken string   `yaml:"request_token"`
-	Instruments  []string `yaml:"instruments"`
-	FromDate     string   `yaml:"from_date"`
-	ToDate       string   `yaml:"to_date"`
-	Interval     string   `yaml:"interval"`
-	StorageType  string   `yaml:"storage_type"` // "duckdb", "sqlite", "json", "csv"
-	StoragePath  string   `yaml:"storage_path"` // Path to database file or directory for files
-	LogFile      string   `yaml:"log_file"`
-
-	// Deprecated: Use StoragePath instead
-	DuckDBPath string `yaml:"duckdb_path,omitempty"`
+	Version         int          `yaml:"version"`
+	APIKey          string       `yaml:"api_key"`
+	APISecret       string       `yaml:"api_secret"`
+	RequestToken    string       `yaml:"request_token"`
+	Instruments     []Instrument `yaml:"instruments"` // Symbols, or mappings overriding settings per instrument
+	FromDate        string       `yaml:"from_date"`
+	ToDate          string       `yaml:"to_date"`
+	Interval        Intervals    `yaml:"interval"`                   // One interval, or a list fetched in the same run
+	OI              bool         `yaml:"oi,omitempty"`               // Request open interest (F&O instruments)
+	Continuous      bool         `yaml:"continuous,omitempty"`       // Request continuous data across expiries (futures)
+	ClampFromDate   bool         `yaml:"clamp_from_date,omitempty"`  // Move from_date to the first candle of each instrument
+	StorageType     string       `yaml:"storage_type"`               // A registered backend: "duckdb", "sqlite", "json", "jsonl", "csv", "parquet", ...
+	StoragePath     string       `yaml:"storage_path"`               // Path to database file or directory for files
+	Compression     string       `yaml:"compression,omitempty"`      // "none", "gzip", "zstd" (csv, json and jsonl files)
+	PathTemplate    string       `yaml:"path_template,omitempty"`    // Layout of csv, json and jsonl files, e.g. "{exchange}/{interval}/{symbol}/{year}"
+	FlushRows       int          `yaml:"flush_rows,omitempty"`       // Rows DuckDB stages before merging them (0 = default)
+	StorageTimezone string       `yaml:"storage_timezone,omitempty"` // "UTC" or "Asia/Kolkata" (csv, json, jsonl and duckdb)
+	LogFile         string       `yaml:"log_file"`
+	Holidays        []string     `yaml:"holidays,omitempty"` // Extra exchange holidays (YYYY-MM-DD)
+	Windows         []Window     `yaml:"windows,omitempty"`  // Sparse date windows instead of from_date..to_date
+
+	// IncompleteCandles is what a fetch during the session does with candles still forming: "drop" (default) or "flag".
+	IncompleteCandles string `yaml:"incomplete_candles,omitempty"`
+
+	// StorageTargets lists stores every chunk is written to, replacing the single store above.
+	StorageTargets []StorageTarget `yaml:"storage_targets,omitempty"`
+
+	// Jobs lists named fetches sharing the fields above as defaults.
+	Jobs []Job `yaml:"jobs,omitempty"`
+
+	// JobName is set on configs returned by ForJob.
+	JobName string `yaml:"-"`
+
+	// TargetName and OnError are set on configs returned by Targets.
+	TargetName string `yaml:"-"`
+	OnError    string `yaml:"-"`
+
+	// MigratedFrom is the version of the file when Load had to migrate it, with a note per change.
+	MigratedFrom   int      `yaml:"-"`
+	MigrationNotes []string `yaml:"-"`
+
+	overrides []Overrides
 }
 
 // ValidationError represents a configuration validation error
@@ -70,19 +106,89 @@ func (r *ValidationResult) Error() string {
 	return strings.Join(messages, "; ")
 }
 
-// Load reads the configuration from a YAML file.
+// Load reads the configuration from a YAML file. Older config versions are
+// migrated in memory, unknown keys are rejected, and ${VAR} and file:
+// references in values are expanded. Environment overrides and defaults are
+// not applied; use Resolve for the effective configuration.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
 	var conf Config
-	if err := yaml.Unmarshal(data, &conf); err != nil {
+	if len(doc.Content) == 0 {
+		return &conf, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: top level must be a mapping", path)
+	}
+
+	from, notes, err := migrate(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if problems := checkKeys(root, reflect.TypeOf(conf), ""); len(problems) > 0 {
+		return nil, fmt.Errorf("%s:\n  • %s", path, strings.Join(problems, "\n  • "))
+	}
+	if err := interpolate(root, filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := root.Decode(&conf); err != nil {
 		return nil, err
 	}
+	if from != CurrentVersion {
+		conf.MigratedFrom = from
+		conf.MigrationNotes = notes
+	}
 	return &conf, nil
 }
 
+// MigrateFile upgrades a config file to CurrentVersion, keeping comments and
+// unexpanded references. Unless dryRun is set, the original file is kept as
+// path.bak and the migrated document is written in its place. The migrated
+// document is returned along with the original version and migration notes.
+func MigrateFile(path string, dryRun bool) ([]byte, int, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, 0, nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, 0, nil, fmt.Errorf("%s: top level must be a mapping", path)
+	}
+
+	from, notes, err := migrate(doc.Content[0])
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if problems := checkKeys(doc.Content[0], reflect.TypeOf(Config{}), ""); len(problems) > 0 {
+		return nil, from, notes, fmt.Errorf("%s:\n  • %s", path, strings.Join(problems, "\n  • "))
+	}
+	out, err := encodeDocument(&doc)
+	if err != nil {
+		return nil, from, notes, err
+	}
+	if dryRun || from == CurrentVersion {
+		return out, from, notes, nil
+	}
+
+	if err := os.WriteFile(path+".bak", data, 0644); err != nil {
+		return nil, from, notes, fmt.Errorf("failed to write backup: %v", err)
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		return nil, from, notes, err
+	}
+	return out, from, notes, nil
+}
+
 // Save writes the configuration to a YAML file.
 func Save(path string, conf *Config) error {
 	data, err := yaml.Marshal(conf)
@@ -92,121 +198,379 @@ func Save(path string, conf *Config) error {
 	return os.WriteFile(path, data, 0644)
 }
 
+// Hash returns the SHA-256 of the effective configuration as YAML, without
+// credentials, identifying the settings a fetch run used.
+func (c *Config) Hash() (string, error) {
+	hc := *c
+	hc.APIKey, hc.APISecret, hc.RequestToken = "", "", ""
+	data, err := yaml.Marshal(&hc)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// UpdateFile edits the raw YAML document of a config file in place. Comments
+// and unexpanded ${VAR} or file: references are preserved.
+func UpdateFile(path string, edit func(root *yaml.Node) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: top level must be a mapping", path)
+	}
+	if err := edit(doc.Content[0]); err != nil {
+		return err
+	}
+	out, err := encodeDocument(&doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+// ReplaceInstruments rewrites entries of the top-level and per-job instrument
+// lists of a config file and returns the number of entries changed.
+func ReplaceInstruments(path string, replacements map[string]string) (int, error) {
+	changed := 0
+	replace := func(list *yaml.Node) {
+		if list == nil || list.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, item := range list.Content {
+			if item.Kind == yaml.MappingNode {
+				// An instrument with overrides
+				item = mappingValue(item, "symbol")
+			}
+			if item == nil || item.Kind != yaml.ScalarNode {
+				continue
+			}
+			if replacement, ok := replacements[item.Value]; ok {
+				item.Value = replacement
+				changed++
+			}
+		}
+	}
+	err := UpdateFile(path, func(root *yaml.Node) error {
+		replace(mappingValue(root, "instruments"))
+		if jobs := mappingValue(root, "jobs"); jobs != nil {
+			for _, job := range jobs.Content {
+				replace(mappingValue(job, "instruments"))
+			}
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// encodeDocument marshals a YAML document with the two-space indentation
+// used by the example config.
+func encodeDocument(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RemoveKey deletes a top-level key from a YAML mapping node.
+func RemoveKey(mapping *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Merge appends the errors of another result, prefixing their field names.
+func (r *ValidationResult) Merge(other *ValidationResult, prefix string) {
+	for _, err := range other.Errors {
+		err.Field = prefix + err.Field
+		r.Errors = append(r.Errors, err)
+	}
+}
+
 // ValidateBasic performs basic validation of required fields and formats
 func (c *Config) ValidateBasic() *ValidationResult {
-	result := &ValidationResult{}
+	result := c.validateCredentials()
+	for _, holiday := range c.Holidays {
+		if _, err := time.Parse(DateLayout, holiday); err != nil {
+			result.AddError("holidays", holiday, "must be in YYYY-MM-DD format")
+		}
+	}
+	if c.HasJobs() {
+		c.validateJobs(result, (*Config).validateFetch)
+		return result
+	}
+	result.Merge(c.validateFetch(), "")
+	return result
+}
 
-	// Required fields
+// validateCredentials checks the fields shared by every job.
+func (c *Config) validateCredentials() *ValidationResult {
+	result := &ValidationResult{}
 	if c.APIKey == "" {
 		result.AddError("api_key", "", "is required")
 	}
 	if c.APISecret == "" {
 		result.AddError("api_secret", "", "is required")
 	}
+	return result
+}
+
+// validateJobs checks job names and runs check against every job, reporting
+// errors under a "jobs[name]." prefix.
+func (c *Config) validateJobs(result *ValidationResult, check func(*Config) *ValidationResult) {
+	seen := make(map[string]bool)
+	for i, job := range c.Jobs {
+		if strings.TrimSpace(job.Name) == "" {
+			result.AddError(fmt.Sprintf("jobs[%d].name", i), "", "is required")
+			continue
+		}
+		if seen[job.Name] {
+			result.AddError(fmt.Sprintf("jobs[%d].name", i), job.Name, "duplicate job name")
+			continue
+		}
+		seen[job.Name] = true
+
+		jc, err := c.ForJob(job.Name)
+		if err != nil {
+			result.AddError(fmt.Sprintf("jobs[%s]", job.Name), "", err.Error())
+			continue
+		}
+		result.Merge(check(jc), fmt.Sprintf("jobs[%s].", job.Name))
+	}
+}
+
+// validateFetch checks the fields describing a single fetch.
+func (c *Config) validateFetch() *ValidationResult {
+	result := &ValidationResult{}
+
+	// Required fields
 	if len(c.Instruments) == 0 {
 		result.AddError("instruments", "", "at least one instrument must be specified")
 	}
-	if c.FromDate == "" {
-		result.AddError("from_date", "", "is required")
+	// The job's dates apply unless every instrument has its own
+	usesJobRange := len(c.Instruments) == 0
+	for _, instrument := range c.Instruments {
+		usesJobRange = usesJobRange || instrument.FromDate == "" || instrument.ToDate == ""
 	}
-	if c.ToDate == "" {
-		result.AddError("to_date", "", "is required")
+	if len(c.Windows) == 0 && usesJobRange {
+		if c.FromDate == "" {
+			result.AddError("from_date", "", "is required")
+		}
+		if c.ToDate == "" {
+			result.AddError("to_date", "", "is required")
+		}
 	}
-	if c.Interval == "" {
+	if len(c.Interval) == 0 {
 		result.AddError("interval", "", "is required")
 	}
 
-	// Date format validation
-	if c.FromDate != "" {
-		if _, err := time.Parse("2006-01-02", c.FromDate); err != nil {
-			result.AddError("from_date", c.FromDate, "must be in YYYY-MM-DD format")
+	// Windows replace the continuous date range
+	now := time.Now()
+	if len(c.Windows) > 0 {
+		if _, err := c.TimeRanges(now); err != nil {
+			result.AddError("windows", "", err.Error())
 		}
+	} else if usesJobRange {
+		c.validateDateRange(result, now)
 	}
-	if c.ToDate != "" {
-		if _, err := time.Parse("2006-01-02", c.ToDate); err != nil {
-			result.AddError("to_date", c.ToDate, "must be in YYYY-MM-DD format")
-		}
+
+	// Interval validation
+	validateIntervals(result, "interval", c.Interval)
+
+	// Incomplete candle policy validation
+	if c.IncompleteCandles != "" && c.IncompleteCandles != IncompleteDrop && c.IncompleteCandles != IncompleteFlag {
+		result.AddError("incomplete_candles", c.IncompleteCandles, fmt.Sprintf("must be one of: %s, %s", IncompleteDrop, IncompleteFlag))
 	}
 
-	// Date range validation
-	if c.FromDate != "" && c.ToDate != "" {
-		from, err1 := time.Parse("2006-01-02", c.FromDate)
-		to, err2 := time.Parse("2006-01-02", c.ToDate)
-		if err1 == nil && err2 == nil {
-			if !from.Before(to) {
-				result.AddError("date_range", fmt.Sprintf("%s to %s", c.FromDate, c.ToDate), "from_date must be before to_date")
-			}
-		}
+	if c.HasTargets() {
+		c.validateTargets(result)
+	} else {
+		result.Merge(c.validateStorageFields(), "")
 	}
 
-	// Interval validation
-	validIntervals := []string{"minute", "3minute", "5minute", "10minute", "15minute", "30minute", "60minute", "day"}
-	if c.Interval != "" {
-		intervalValid := false
-		for _, valid := range validIntervals {
-			if c.Interval == valid {
-				intervalValid = true
-				break
-			}
+	// Instrument validation (basic format check; symbols are checked against
+	// the instrument master by the validate command)
+	for _, instrument := range c.Instruments {
+		if strings.TrimSpace(instrument.Symbol) == "" {
+			result.AddError("instruments", instrument.Symbol, "empty instrument symbol found")
+		}
+		if exchange, symbol, ok := strings.Cut(instrument.Symbol, ":"); ok && (strings.TrimSpace(exchange) == "" || strings.TrimSpace(symbol) == "") {
+			result.AddError("instruments", instrument.Symbol, "must be SYMBOL or EXCHANGE:SYMBOL")
 		}
-		if !intervalValid {
-			result.AddError("interval", c.Interval, fmt.Sprintf("must be one of: %s", strings.Join(validIntervals, ", ")))
+		if instrument.HasOverrides() {
+			result.Merge(c.validateInstrument(instrument, now), fmt.Sprintf("instruments[%s].", instrument.Symbol))
 		}
 	}
 
-	// Storage type validation
-	if c.StorageType != "" {
-		validStorageTypes := []string{"duckdb", "sqlite", "json", "csv"}
-		storageTypeValid := false
-		for _, valid := range validStorageTypes {
-			if c.StorageType == valid {
-				storageTypeValid = true
-				break
-			}
+	return result
+}
+
+// validIntervals lists the candle intervals Kite serves.
+var validIntervals = []string{"minute", "3minute", "5minute", "10minute", "15minute", "30minute", "60minute", "day"}
+
+// validateIntervals checks that every interval of a list is one Kite serves,
+// and is listed once.
+func validateIntervals(result *ValidationResult, field string, intervals Intervals) {
+	seen := make(map[string]bool, len(intervals))
+	for _, interval := range intervals {
+		if !slices.Contains(validIntervals, interval) {
+			result.AddError(field, interval, fmt.Sprintf("must be one of: %s", strings.Join(validIntervals, ", ")))
+		} else if seen[interval] {
+			result.AddError(field, interval, "is listed more than once")
 		}
-		if !storageTypeValid {
-			result.AddError("storage_type", c.StorageType, fmt.Sprintf("must be one of: %s", strings.Join(validStorageTypes, ", ")))
+		seen[interval] = true
+	}
+}
+
+// validateInstrument checks the settings an instrument overrides, as they
+// combine with the job's.
+func (c *Config) validateInstrument(instrument Instrument, now time.Time) *ValidationResult {
+	result := &ValidationResult{}
+	ic := c.ForInstrument(instrument)
+	validateIntervals(result, "interval", instrument.Interval)
+	if instrument.FromDate != "" || instrument.ToDate != "" {
+		if ic.FromDate == "" {
+			result.AddError("from_date", "", "is required when to_date is overridden and the job uses windows")
+		} else if ic.ToDate == "" {
+			result.AddError("to_date", "", "is required when from_date is overridden and the job uses windows")
+		} else {
+			ic.validateDateRange(result, now)
 		}
 	}
+	return result
+}
 
-	// Instrument validation (basic format check)
-	for _, instrument := range c.Instruments {
-		if strings.TrimSpace(instrument) == "" {
-			result.AddError("instruments", instrument, "empty instrument symbol found")
+// validateStorageFields checks the fields describing the store to write.
+func (c *Config) validateStorageFields() *ValidationResult {
+	result := &ValidationResult{}
+
+	// Storage type validation against the registered backends
+	storageType, _ := c.EffectiveStorage()
+	backend, known := storage.Lookup(storage.StorageType(storageType))
+	if !known {
+		result.AddError("storage_type", storageType, fmt.Sprintf("must be one of: %s", strings.Join(storage.Names(), ", ")))
+	}
+
+	// Compression validation
+	if c.Compression != "" {
+		compression, err := storage.ParseCompression(c.Compression)
+		if err != nil {
+			result.AddError("compression", c.Compression, "must be one of: none, gzip, zstd")
+		} else if compression != storage.CompressionNone && known && !backend.Schema.Compression {
+			result.AddError("compression", c.Compression, fmt.Sprintf("only applies to %s storage, not %s",
+				backendsWith(func(s storage.Schema) bool { return s.Compression }), storageType))
+		}
+	}
+
+	// Path template validation
+	if c.PathTemplate != "" {
+		if err := storage.ValidatePathTemplate(c.PathTemplate); err != nil {
+			result.AddError("path_template", c.PathTemplate, err.Error())
+		} else if known && !backend.Schema.PathTemplate {
+			result.AddError("path_template", c.PathTemplate, fmt.Sprintf("only applies to %s storage, not %s",
+				backendsWith(func(s storage.Schema) bool { return s.PathTemplate }), storageType))
 		}
-		if len(instrument) > 20 {
-			result.AddError("instruments", instrument, "instrument symbol too long (max 20 characters)")
+	}
+
+	if c.FlushRows < 0 {
+		result.AddError("flush_rows", fmt.Sprintf("%d", c.FlushRows), "must not be negative")
+	}
+
+	// Storage timezone validation
+	if c.StorageTimezone != "" {
+		zone, err := storage.ParseTimezone(c.StorageTimezone)
+		if err != nil {
+			result.AddError("storage_timezone", c.StorageTimezone, "must be one of: UTC, Asia/Kolkata")
+		} else if known && !backend.Schema.SupportsTimezone(zone) {
+			result.AddError("storage_timezone", c.StorageTimezone, fmt.Sprintf("%s stores UTC timestamps; only UTC applies", storageType))
 		}
 	}
 
 	return result
 }
 
+// validateDateRange checks from_date and to_date and that they form a range.
+func (c *Config) validateDateRange(result *ValidationResult, now time.Time) {
+	// Date format validation
+	from, fromErr := ResolveTime(c.FromDate, now, c.Interval.First(), false)
+	if c.FromDate != "" && fromErr != nil {
+		result.AddError("from_date", c.FromDate, fromErr.Error())
+	}
+	to, toErr := ResolveTime(c.ToDate, now, c.Interval.First(), true)
+	if c.ToDate != "" && toErr != nil {
+		result.AddError("to_date", c.ToDate, toErr.Error())
+	}
+
+	// Date range validation
+	if c.FromDate != "" && c.ToDate != "" && fromErr == nil && toErr == nil {
+		if !from.Before(to) {
+			value := fmt.Sprintf("%s to %s", c.FromDate, c.ToDate)
+			if IsDateExpression(c.FromDate) || IsDateExpression(c.ToDate) {
+				value += fmt.Sprintf(" = %s to %s", from.Format(DateTimeLayout), to.Format(DateTimeLayout))
+			}
+			result.AddError("date_range", value, "from_date must be before to_date")
+		}
+	}
+}
+
 // ValidateStorage performs storage-specific validation
 func (c *Config) ValidateStorage() *ValidationResult {
-	result := &ValidationResult{}
-
-	// Determine storage type and path
-	storageType := c.StorageType
-	storagePath := c.StoragePath
+	if c.HasJobs() {
+		result := &ValidationResult{}
+		c.validateJobs(result, (*Config).validateStorage)
+		return result
+	}
+	return c.validateStorage()
+}
 
-	// Handle backward compatibility
-	if storagePath == "" && c.DuckDBPath != "" {
-		storagePath = c.DuckDBPath
-		if storageType == "" {
-			storageType = "duckdb"
+func (c *Config) validateStorage() *ValidationResult {
+	result := &ValidationResult{}
+	for _, tc := range c.Targets() {
+		prefix := ""
+		if tc.TargetName != "" {
+			prefix = fmt.Sprintf("storage_targets[%s].", tc.TargetName)
 		}
+		result.Merge(tc.validateStoragePath(), prefix)
 	}
 
-	// Set defaults if not specified
-	if storageType == "" {
-		storageType = "duckdb"
+	// Validate log file path
+	if c.LogFile != "" {
+		logDir := filepath.Dir(c.LogFile)
+		if logDir != "." {
+			if err := os.MkdirAll(logDir, 0755); err != nil {
+				result.AddError("log_file", c.LogFile, fmt.Sprintf("cannot create log directory: %v", err))
+			}
+		}
 	}
 
+	return result
+}
+
+// validateStoragePath checks that the store of the config can be written.
+func (c *Config) validateStoragePath() *ValidationResult {
+	result := &ValidationResult{}
+	storageType, storagePath := c.EffectiveStorage()
+
 	// Validate storage path
-	if storagePath != "" {
-		switch storageType {
-		case "duckdb", "sqlite":
+	backend, known := storage.Lookup(storage.StorageType(storageType))
+	if storagePath != "" && known {
+		if !backend.Schema.Directory {
 			// For database files, check if parent directory exists or can be created
 			dir := filepath.Dir(storagePath)
 			if dir != "." {
@@ -223,8 +587,7 @@ func (c *Config) ValidateStorage() *ValidationResult {
 					f.Close()
 				}
 			}
-
-		case "json", "csv":
+		} else {
 			// For file-based storage, ensure it's a directory
 			if err := os.MkdirAll(storagePath, 0755); err != nil {
 				result.AddError("storage_path", storagePath, fmt.Sprintf("cannot create directory: %v", err))
@@ -232,17 +595,18 @@ func (c *Config) ValidateStorage() *ValidationResult {
 		}
 	}
 
-	// Validate log file path
-	if c.LogFile != "" {
-		logDir := filepath.Dir(c.LogFile)
-		if logDir != "." {
-			if err := os.MkdirAll(logDir, 0755); err != nil {
-				result.AddError("log_file", c.LogFile, fmt.Sprintf("cannot create log directory: %v", err))
-			}
+	return result
+}
+
+// backendsWith lists the registered storage types whose schema matches.
+func backendsWith(match func(storage.Schema) bool) string {
+	var names []string
+	for _, b := range storage.Backends() {
+		if match(b.Schema) {
+			names = append(names, string(b.Name))
 		}
 	}
-
-	return result
+	return strings.Join(names, ", ")
 }
 
 // ValidateComplete performs comprehensive validation including basic and storage validation
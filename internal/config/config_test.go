@@ -0,0 +1,28 @@
+package config
+
+import "testing"
+
+func TestValidateCompression(t *testing.T) {
+	tests := []struct {
+		storageType string
+		compression string
+		valid       bool
+	}{
+		{"csv", "none", true},
+		{"csv", "gzip", true},
+		{"csv", "gz", true},
+		{"jsonl", "zstd", true},
+		{"jsonl", "zst", true},
+		{"json", "GZIP", true},
+		{"csv", "lz4", false},
+		{"duckdb", "gzip", false},
+		{"duckdb", "none", true},
+	}
+	for _, tt := range tests {
+		conf := &Config{StorageType: tt.storageType, Compression: tt.compression}
+		result := conf.validateStorageFields()
+		if result.HasErrors() == tt.valid {
+			t.Errorf("%s storage with compression %q: errors %q, want valid %v", tt.storageType, tt.compression, result.Error(), tt.valid)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+// DateLayout is the layout of literal dates in config files and flags.
+const DateLayout = "2006-01-02"
+
+// DateTimeLayout is the layout used to display resolved timestamps.
+const DateTimeLayout = "2006-01-02 15:04:05"
+
+// dateTimeLayouts are the accepted layouts of literal timestamps, interpreted in IST
+// unless they carry an offset.
+var dateTimeLayouts = []string{
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+}
+
+// Earliest dates for which Kite serves historical candles. The listing_date
+// expression resolves to these until the planner narrows it per instrument.
+var (
+	earliestDailyHistory    = time.Date(2000, 1, 1, 0, 0, 0, 0, calendar.IST)
+	earliestIntradayHistory = time.Date(2015, 1, 1, 0, 0, 0, 0, calendar.IST)
+)
+
+// DateExpressions lists the symbolic date expressions accepted besides YYYY-MM-DD
+// and relative offsets such as -30d, -2w, -6m and -1y.
+var DateExpressions = []string{"today", "yesterday", "start_of_week", "start_of_month", "start_of_year", "last_trading_day", "listing_date"}
+
+var relativeDatePattern = regexp.MustCompile(`^([+-]\d+)([dwmy])$`)
+
+// IsDateExpression reports whether value is symbolic or relative rather than a literal date or timestamp.
+func IsDateExpression(value string) bool {
+	value = strings.TrimSpace(value)
+	if _, err := time.Parse(DateLayout, value); err == nil {
+		return false
+	}
+	_, ok := parseDateTime(value)
+	return !ok
+}
+
+// parseDateTime parses a literal timestamp in IST.
+func parseDateTime(value string) (time.Time, bool) {
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, calendar.IST); err == nil {
+			return t.In(calendar.IST), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ResolveTime resolves a literal timestamp or a date expression. Values
+// without a time of day resolve to the start of the day, or to its last
+// second when endOfDay is set, so that a to_date includes the whole day.
+func ResolveTime(expr string, now time.Time, interval string, endOfDay bool) (time.Time, error) {
+	if t, ok := parseDateTime(strings.TrimSpace(expr)); ok {
+		return t, nil
+	}
+	d, err := ResolveDate(expr, now, interval)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%v, or a timestamp like \"2024-01-05 09:15\"", err)
+	}
+	if endOfDay {
+		return d.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return d, nil
+}
+
+// ResolveDate resolves a literal or symbolic date expression to midnight IST
+// of the day it refers to, relative to now. The interval is only consulted by
+// listing_date, which is not the listing date of an instrument but the
+// earliest date Kite serves candles of the interval for; the fetch planner
+// clamps it to each instrument's first candle.
+func ResolveDate(expr string, now time.Time, interval string) (time.Time, error) {
+	value := strings.ToLower(strings.TrimSpace(expr))
+	today := calendar.Date(now)
+
+	if d, err := time.ParseInLocation(DateLayout, value, calendar.IST); err == nil {
+		return d, nil
+	}
+
+	switch value {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "start_of_week":
+		offset := (int(today.Weekday()) + 6) % 7 // Monday is the first day of the week
+		return today.AddDate(0, 0, -offset), nil
+	case "start_of_month":
+		return time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, calendar.IST), nil
+	case "start_of_year":
+		return time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, calendar.IST), nil
+	case "last_trading_day":
+		return calendar.LastTradingDay(now), nil
+	case "listing_date":
+		if interval == "day" {
+			return earliestDailyHistory, nil
+		}
+		return earliestIntradayHistory, nil
+	}
+
+	if m := relativeDatePattern.FindStringSubmatch(value); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid offset %q", expr)
+		}
+		switch m[2] {
+		case "d":
+			return today.AddDate(0, 0, n), nil
+		case "w":
+			return today.AddDate(0, 0, 7*n), nil
+		case "m":
+			return addMonths(today, n), nil
+		case "y":
+			return addMonths(today, 12*n), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("must be YYYY-MM-DD, a relative offset like -30d/-2w/-6m/-1y, or one of: %s",
+		strings.Join(DateExpressions, ", "))
+}
+
+// addMonths moves a date by n months, keeping the day of the month unless the
+// target month is shorter: Mar 31 -1m is Feb 29 (or 28), not Mar 2.
+func addMonths(d time.Time, n int) time.Time {
+	first := time.Date(d.Year(), d.Month()+time.Month(n), 1, 0, 0, 0, 0, d.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(d.Day(), lastDay)-1)
+}
+
+// DateRange resolves from_date and to_date relative to now. A date-only
+// to_date covers that whole day. With several intervals, listing_date
+// resolves for the first; see ForInterval.
+func (c *Config) DateRange(now time.Time) (time.Time, time.Time, error) {
+	from, err := ResolveTime(c.FromDate, now, c.Interval.First(), false)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("from_date (%s): %v", c.FromDate, err)
+	}
+	to, err := ResolveTime(c.ToDate, now, c.Interval.First(), true)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("to_date (%s): %v", c.ToDate, err)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Instrument is an entry of an instruments list: either a bare symbol, or a
+// mapping with the symbol and the job settings it overrides for that
+// instrument alone:
+//
+//	instruments:
+//	  - "SBIN"
+//	  - symbol: "NIFTY 50"
+//	    from_date: "2015-01-01"
+//	  - symbol: "NFO:NIFTY24DECFUT"
+//	    interval: "minute"
+//	    oi: true
+//
+// Fields left empty inherit the value of the job.
+type Instrument struct {
+	Symbol        string    `yaml:"symbol"`
+	FromDate      string    `yaml:"from_date,omitempty"`
+	ToDate        string    `yaml:"to_date,omitempty"`
+	Interval      Intervals `yaml:"interval,omitempty"`
+	OI            *bool     `yaml:"oi,omitempty"`
+	Continuous    *bool     `yaml:"continuous,omitempty"`
+	ClampFromDate *bool     `yaml:"clamp_from_date,omitempty"`
+}
+
+// UnmarshalYAML accepts a bare symbol as well as a mapping.
+func (i *Instrument) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*i = Instrument{Symbol: node.Value}
+		return nil
+	}
+	type plain Instrument
+	if err := node.Decode((*plain)(i)); err != nil {
+		return err
+	}
+	if i.Symbol == "" {
+		return fmt.Errorf("line %d: instrument without symbol", node.Line)
+	}
+	return nil
+}
+
+// MarshalYAML writes an instrument without overrides as a bare symbol.
+func (i Instrument) MarshalYAML() (interface{}, error) {
+	if !i.HasOverrides() {
+		return i.Symbol, nil
+	}
+	type plain Instrument
+	return plain(i), nil
+}
+
+// HasOverrides reports whether the instrument overrides any job setting.
+func (i Instrument) HasOverrides() bool {
+	return i.FromDate != "" || i.ToDate != "" || len(i.Interval) > 0 ||
+		i.OI != nil || i.Continuous != nil || i.ClampFromDate != nil
+}
+
+// InstrumentsOf turns a list of symbols, e.g. from a flag, into instruments
+// without overrides.
+func InstrumentsOf(symbols []string) []Instrument {
+	instruments := make([]Instrument, len(symbols))
+	for i, symbol := range symbols {
+		instruments[i] = Instrument{Symbol: symbol}
+	}
+	return instruments
+}
+
+// Symbols returns the symbols of the configured instruments.
+func (c *Config) Symbols() []string {
+	symbols := make([]string, len(c.Instruments))
+	for i, instrument := range c.Instruments {
+		symbols[i] = instrument.Symbol
+	}
+	return symbols
+}
+
+// ForInstrument returns the effective configuration of one instrument of the
+// config: the config itself with the instrument's overrides applied. An
+// instrument with its own from_date or to_date fetches that range instead of
+// the windows of the job.
+func (c *Config) ForInstrument(instrument Instrument) *Config {
+	ic := *c
+	ic.Instruments = []Instrument{instrument}
+	if instrument.FromDate != "" || instrument.ToDate != "" {
+		ic.Windows = nil
+	}
+	if instrument.FromDate != "" {
+		ic.FromDate = instrument.FromDate
+	}
+	if instrument.ToDate != "" {
+		ic.ToDate = instrument.ToDate
+	}
+	if len(instrument.Interval) > 0 {
+		ic.Interval = instrument.Interval
+	}
+	if instrument.OI != nil {
+		ic.OI = *instrument.OI
+	}
+	if instrument.Continuous != nil {
+		ic.Continuous = *instrument.Continuous
+	}
+	if instrument.ClampFromDate != nil {
+		ic.ClampFromDate = *instrument.ClampFromDate
+	}
+	return &ic
+}
+
+// ClampsFromDate reports whether the planner should move from_date forward
+// to the first candle the instrument has: when asked to, or when from_date is
+// listing_date.
+func (c *Config) ClampsFromDate() bool {
+	return c.ClampFromDate || (len(c.Windows) == 0 && strings.ToLower(strings.TrimSpace(c.FromDate)) == "listing_date")
+}
@@ -0,0 +1,22 @@
+package config
+
+import "testing"
+
+func TestClampsFromDate(t *testing.T) {
+	tests := []struct {
+		conf Config
+		want bool
+	}{
+		{Config{FromDate: "listing_date"}, true},
+		{Config{FromDate: " Listing_Date "}, true},
+		{Config{FromDate: "2024-01-01"}, false},
+		{Config{FromDate: "2024-01-01", ClampFromDate: true}, true},
+		{Config{FromDate: "listing_date", Windows: []Window{{Dates: []string{"2024-01-02"}}}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.conf.ClampsFromDate(); got != tt.want {
+			t.Errorf("ClampsFromDate of from_date %q, clamp %v, %d windows = %v, want %v",
+				tt.conf.FromDate, tt.conf.ClampFromDate, len(tt.conf.Windows), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Intervals is the interval setting of a job or instrument: a single interval,
+// or a list of intervals fetched in the same run:
+//
+//	interval: "day"
+//	interval: ["minute", "15minute", "day"]
+type Intervals []string
+
+// UnmarshalYAML accepts a single interval as well as a list.
+func (i *Intervals) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*i = Intervals{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*i = list
+	return nil
+}
+
+// MarshalYAML writes a single interval as a scalar.
+func (i Intervals) MarshalYAML() (interface{}, error) {
+	if len(i) == 1 {
+		return i[0], nil
+	}
+	return []string(i), nil
+}
+
+// String lists the intervals, e.g. "minute, day".
+func (i Intervals) String() string {
+	return strings.Join(i, ", ")
+}
+
+// First returns the first interval, or "" if there is none.
+func (i Intervals) First() string {
+	if len(i) == 0 {
+		return ""
+	}
+	return i[0]
+}
+
+// ParseIntervals splits a comma-separated list of intervals, e.g. from a flag.
+// An empty value yields no intervals.
+func ParseIntervals(value string) Intervals {
+	var intervals Intervals
+	for _, interval := range strings.Split(value, ",") {
+		if interval = strings.TrimSpace(interval); interval != "" {
+			intervals = append(intervals, interval)
+		}
+	}
+	return intervals
+}
+
+// ForInterval returns the configuration of one interval of the config: the
+// config itself fetching only that interval. Dates such as listing_date
+// resolve for that interval.
+func (c *Config) ForInterval(interval string) *Config {
+	ic := *c
+	ic.Interval = Intervals{interval}
+	return &ic
+}
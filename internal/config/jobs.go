@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Job is a named fetch defined in the jobs section of a config file. Fields
+// left empty inherit the top-level value, so the top-level fields act as the
+// shared defaults for every job.
+type Job struct {
+	Name            string       `yaml:"name"`
+	Instruments     []Instrument `yaml:"instruments,omitempty"`
+	FromDate        string       `yaml:"from_date,omitempty"`
+	ToDate          string       `yaml:"to_date,omitempty"`
+	Interval        Intervals    `yaml:"interval,omitempty"`
+	StorageType     string       `yaml:"storage_type,omitempty"`
+	StoragePath     string       `yaml:"storage_path,omitempty"`
+	Compression     string       `yaml:"compression,omitempty"`
+	PathTemplate    string       `yaml:"path_template,omitempty"`
+	FlushRows       int          `yaml:"flush_rows,omitempty"`
+	StorageTimezone string       `yaml:"storage_timezone,omitempty"`
+	LogFile         string       `yaml:"log_file,omitempty"`
+	Windows         []Window     `yaml:"windows,omitempty"`
+
+	OI                *bool  `yaml:"oi,omitempty"`
+	Continuous        *bool  `yaml:"continuous,omitempty"`
+	ClampFromDate     *bool  `yaml:"clamp_from_date,omitempty"`
+	IncompleteCandles string `yaml:"incomplete_candles,omitempty"`
+
+	StorageTargets []StorageTarget `yaml:"storage_targets,omitempty"`
+}
+
+// HasJobs reports whether the config defines named jobs.
+func (c *Config) HasJobs() bool {
+	return len(c.Jobs) > 0
+}
+
+// JobNames returns the names of all configured jobs in file order.
+func (c *Config) JobNames() []string {
+	names := make([]string, 0, len(c.Jobs))
+	for _, job := range c.Jobs {
+		names = append(names, job.Name)
+	}
+	return names
+}
+
+// ForJob returns the effective single-fetch configuration for the named job:
+// top-level defaults, then the job's own fields, then environment and flag
+// overrides, then built-in defaults.
+func (c *Config) ForJob(name string) (*Config, error) {
+	for _, job := range c.Jobs {
+		if job.Name != name {
+			continue
+		}
+
+		jc := *c
+		jc.Jobs = nil
+		jc.JobName = job.Name
+		if len(job.Instruments) > 0 {
+			jc.Instruments = job.Instruments
+		}
+		if job.FromDate != "" {
+			jc.FromDate = job.FromDate
+		}
+		if job.ToDate != "" {
+			jc.ToDate = job.ToDate
+		}
+		if len(job.Interval) > 0 {
+			jc.Interval = job.Interval
+		}
+		if len(job.StorageTargets) > 0 {
+			jc.StorageTargets = job.StorageTargets
+		} else if job.StorageType != "" || job.StoragePath != "" {
+			// A job writing to a single store does not inherit the shared targets
+			jc.StorageTargets = nil
+		}
+		if job.StorageType != "" {
+			jc.StorageType = job.StorageType
+			// A job switching backend must not inherit a path meant for another type
+			if job.StoragePath == "" && c.StorageType != job.StorageType {
+				jc.StoragePath = ""
+			}
+		}
+		if job.StoragePath != "" {
+			jc.StoragePath = job.StoragePath
+		}
+		if job.Compression != "" {
+			jc.Compression = job.Compression
+		}
+		if job.PathTemplate != "" {
+			jc.PathTemplate = job.PathTemplate
+		}
+		if job.FlushRows != 0 {
+			jc.FlushRows = job.FlushRows
+		}
+		if job.StorageTimezone != "" {
+			jc.StorageTimezone = job.StorageTimezone
+		}
+		if job.LogFile != "" {
+			jc.LogFile = job.LogFile
+		}
+		if len(job.Windows) > 0 {
+			jc.Windows = job.Windows
+		}
+		if job.OI != nil {
+			jc.OI = *job.OI
+		}
+		if job.Continuous != nil {
+			jc.Continuous = *job.Continuous
+		}
+		if job.ClampFromDate != nil {
+			jc.ClampFromDate = *job.ClampFromDate
+		}
+		if job.IncompleteCandles != "" {
+			jc.IncompleteCandles = job.IncompleteCandles
+		}
+
+		for _, o := range c.overrides {
+			jc.ApplyOverrides(o)
+		}
+		jc.ApplyDefaults()
+		return &jc, nil
+	}
+	return nil, fmt.Errorf("job %q not found (available: %s)", name, strings.Join(c.JobNames(), ", "))
+}
+
+// SelectJobs returns the effective configurations to run. Configs without a
+// jobs section yield themselves as a single unnamed job. When jobs are defined,
+// either specific names or all must be requested unless there is exactly one.
+func (c *Config) SelectJobs(names []string, all bool) ([]*Config, error) {
+	if !c.HasJobs() {
+		if len(names) > 0 {
+			return nil, fmt.Errorf("config does not define any jobs")
+		}
+		return []*Config{c}, nil
+	}
+
+	if all {
+		names = c.JobNames()
+	} else if len(names) == 0 {
+		if len(c.Jobs) != 1 {
+			return nil, fmt.Errorf("config defines %d jobs, select one with --job or use --all-jobs (available: %s)",
+				len(c.Jobs), strings.Join(c.JobNames(), ", "))
+		}
+		names = c.JobNames()
+	}
+
+	var selected []*Config
+	for _, name := range names {
+		jc, err := c.ForJob(name)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, jc)
+	}
+	return selected, nil
+}
+
+// SelectJob returns the effective configuration of a single job for commands
+// working on one store: the named job, or the only job when name is empty.
+// Configs without a jobs section yield themselves.
+func (c *Config) SelectJob(name string) (*Config, error) {
+	if name != "" {
+		if !c.HasJobs() {
+			return nil, fmt.Errorf("config does not define any jobs")
+		}
+		return c.ForJob(name)
+	}
+	if !c.HasJobs() {
+		return c, nil
+	}
+	if len(c.Jobs) != 1 {
+		return nil, fmt.Errorf("config defines %d jobs, select one with --job (available: %s)",
+			len(c.Jobs), strings.Join(c.JobNames(), ", "))
+	}
+	return c.ForJob(c.Jobs[0].Name)
+}
+
+// DisplayName returns the job name, or "default" for single-job configs.
+func (c *Config) DisplayName() string {
+	if c.JobName == "" {
+		return "default"
+	}
+	return c.JobName
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"zerodha-connect/internal/fuzzy"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config schema version written by this release.
+//
+// Version history:
+//
+//	1: unversioned files; storage configured through duckdb_path, unused access_token key
+//	2: version field; storage configured through storage_type and storage_path
+const CurrentVersion = 2
+
+// migration upgrades a raw config document from one version to the next.
+type migration struct {
+	from  int
+	apply func(root *yaml.Node) []string
+}
+
+var migrations = []migration{
+	{from: 1, apply: migrateV1},
+}
+
+// migrate upgrades the document to CurrentVersion and returns the version it
+// started at together with a note for every change made.
+func migrate(root *yaml.Node) (int, []string, error) {
+	version := 1
+	if node := mappingValue(root, "version"); node != nil {
+		v, err := strconv.Atoi(node.Value)
+		if err != nil || v < 1 {
+			return 0, nil, fmt.Errorf("version (%s): must be a positive integer", node.Value)
+		}
+		version = v
+	}
+	if version > CurrentVersion {
+		return version, nil, fmt.Errorf("config version %d is newer than supported version %d; please upgrade %s",
+			version, CurrentVersion, "zerodha-connect")
+	}
+
+	from := version
+	var notes []string
+	for _, m := range migrations {
+		if m.from == version {
+			notes = append(notes, m.apply(root)...)
+			version++
+		}
+	}
+	if from != CurrentVersion {
+		setMappingValue(root, "version", strconv.Itoa(CurrentVersion), true)
+	}
+	return from, notes, nil
+}
+
+// migrateV1 drops the access_token key, which was documented but never read,
+// and replaces the deprecated duckdb_path key with storage_type and storage_path.
+func migrateV1(root *yaml.Node) []string {
+	var notes []string
+	if RemoveKey(root, "access_token") {
+		notes = append(notes, "removed unused access_token (tokens are stored by 'auth login')")
+	}
+	return append(notes, migrateDuckDBPath(root)...)
+}
+
+func migrateDuckDBPath(root *yaml.Node) []string {
+	legacy := mappingValue(root, "duckdb_path")
+	if legacy == nil {
+		return nil
+	}
+	RemoveKey(root, "duckdb_path")
+
+	if path := mappingValue(root, "storage_path"); path != nil && path.Value != "" {
+		return []string{fmt.Sprintf("removed duckdb_path (%s), storage_path (%s) takes precedence", legacy.Value, path.Value)}
+	}
+	notes := []string{fmt.Sprintf("moved duckdb_path (%s) to storage_path", legacy.Value)}
+	setMappingValue(root, "storage_path", legacy.Value, false)
+	if typ := mappingValue(root, "storage_type"); typ == nil || typ.Value == "" {
+		setMappingValue(root, "storage_type", "duckdb", false)
+		notes = append(notes, "set storage_type to duckdb")
+	}
+	return notes
+}
+
+// mappingValue returns the value node of key in a mapping node.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets key to a scalar value, appending the key (or
+// prepending it when first is set) if it does not exist yet.
+func setMappingValue(mapping *yaml.Node, key, value string, first bool) {
+	if node := mappingValue(mapping, key); node != nil {
+		node.Kind, node.Tag, node.Value, node.Content = yaml.ScalarNode, "", value, nil
+		return
+	}
+	pair := []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: key},
+		{Kind: yaml.ScalarNode, Value: value},
+	}
+	if first {
+		mapping.Content = append(pair, mapping.Content...)
+	} else {
+		mapping.Content = append(mapping.Content, pair...)
+	}
+}
+
+// checkKeys reports keys of the document that do not correspond to a field of
+// the target type, with suggestions for likely misspellings.
+func checkKeys(node *yaml.Node, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var problems []string
+	switch {
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := yamlFields(t)
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				msg := fmt.Sprintf("unknown key %q at line %d", path+key.Value, key.Line)
+				if suggestions := fuzzy.Closest(key.Value, names, 1); len(suggestions) > 0 {
+					msg += fmt.Sprintf(", did you mean %q?", path+suggestions[0])
+				}
+				problems = append(problems, msg)
+				continue
+			}
+			problems = append(problems, checkKeys(value, fieldType, path+key.Value+".")...)
+		}
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		base := strings.TrimSuffix(path, ".")
+		for i, item := range node.Content {
+			problems = append(problems, checkKeys(item, t.Elem(), fmt.Sprintf("%s[%d].", base, i))...)
+		}
+	}
+	return problems
+}
+
+// yamlFields maps the YAML keys of a struct type to their field types,
+// following inlined structs.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			for k, v := range yamlFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// copyFixture copies a file of testdata into a temporary directory, so that
+// migrations can rewrite it.
+func copyFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMigrateFile(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		from     int
+		notes    []string
+		contains []string
+		missing  []string
+	}{
+		{
+			fixture: "v1.yaml",
+			from:    1,
+			notes: []string{
+				"removed unused access_token (tokens are stored by 'auth login')",
+				"moved duckdb_path (data/market.duckdb) to storage_path",
+				"set storage_type to duckdb",
+			},
+			contains: []string{"version: 2\n", "storage_path: data/market.duckdb", "storage_type: duckdb", "# Unversioned config"},
+			missing:  []string{"access_token", "duckdb_path"},
+		},
+		{
+			fixture:  "v1_storage_path.yaml",
+			from:     1,
+			notes:    []string{"removed duckdb_path (old.duckdb), storage_path (market.sqlite) takes precedence"},
+			contains: []string{"version: 2\n", "storage_type: \"sqlite\"", "storage_path: \"market.sqlite\""},
+			missing:  []string{"duckdb_path", "old.duckdb"},
+		},
+		{
+			fixture:  "v2.yaml",
+			from:     CurrentVersion,
+			contains: []string{"version: 2\n", "storage_path: \"market.duckdb\""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			path := copyFixture(t, tt.fixture)
+			original, _ := os.ReadFile(path)
+
+			out, from, notes, err := MigrateFile(path, false)
+			if err != nil {
+				t.Fatalf("MigrateFile: %v", err)
+			}
+			if from != tt.from {
+				t.Errorf("from = %d, want %d", from, tt.from)
+			}
+			if !slices.Equal(notes, tt.notes) {
+				t.Errorf("notes = %q, want %q", notes, tt.notes)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(string(out), s) {
+					t.Errorf("migrated document lacks %q:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.missing {
+				if strings.Contains(string(out), s) {
+					t.Errorf("migrated document still has %q:\n%s", s, out)
+				}
+			}
+
+			written, _ := os.ReadFile(path)
+			backup, backupErr := os.ReadFile(path + ".bak")
+			if tt.from == CurrentVersion {
+				if string(written) != string(original) {
+					t.Errorf("current config was rewritten:\n%s", written)
+				}
+				if backupErr == nil {
+					t.Error("current config was backed up")
+				}
+				return
+			}
+			if string(written) != string(out) {
+				t.Errorf("file holds\n%s\nwant the migrated document\n%s", written, out)
+			}
+			if string(backup) != string(original) {
+				t.Errorf("backup holds\n%s\nwant the original\n%s", backup, original)
+			}
+		})
+	}
+}
+
+func TestMigrateFileDryRun(t *testing.T) {
+	path := copyFixture(t, "v1.yaml")
+	original, _ := os.ReadFile(path)
+
+	if _, from, _, err := MigrateFile(path, true); err != nil || from != 1 {
+		t.Fatalf("MigrateFile = %d, %v, want 1, nil", from, err)
+	}
+	if written, _ := os.ReadFile(path); string(written) != string(original) {
+		t.Errorf("dry run rewrote the file:\n%s", written)
+	}
+	if _, err := os.Stat(path + ".bak"); err == nil {
+		t.Error("dry run wrote a backup")
+	}
+}
+
+func TestLoadMigratesInMemory(t *testing.T) {
+	path := copyFixture(t, "v1.yaml")
+	original, _ := os.ReadFile(path)
+
+	conf, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if conf.StorageType != "duckdb" || conf.StoragePath != "data/market.duckdb" {
+		t.Errorf("storage = %s %s, want duckdb data/market.duckdb", conf.StorageType, conf.StoragePath)
+	}
+	if conf.Version != CurrentVersion || conf.MigratedFrom != 1 || len(conf.MigrationNotes) != 3 {
+		t.Errorf("version %d migrated from %d with notes %q", conf.Version, conf.MigratedFrom, conf.MigrationNotes)
+	}
+	if written, _ := os.ReadFile(path); string(written) != string(original) {
+		t.Errorf("Load rewrote the file:\n%s", written)
+	}
+
+	conf, err = Load(copyFixture(t, "v2.yaml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if conf.MigratedFrom != 0 || conf.MigrationNotes != nil {
+		t.Errorf("current config migrated from %d with notes %q", conf.MigratedFrom, conf.MigrationNotes)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	_, err := Load(copyFixture(t, "unknown_keys.yaml"))
+	if err == nil {
+		t.Fatal("Load accepted unknown keys")
+	}
+	for _, want := range []string{
+		`unknown key "intrval" at line 2, did you mean "interval"?`,
+		`unknown key "instruments[0].from_dat" at line 5, did you mean "instruments[0].from_date"?`,
+		`unknown key "jobs[0].instrumets" at line 8, did you mean "jobs[0].instruments"?`,
+		`unknown key "jobs[0].storage_targets[0].storage_pth" at line 12, did you mean "jobs[0].storage_targets[0].storage_path"?`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %s:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadRejectsNewerVersion(t *testing.T) {
+	_, err := Load(copyFixture(t, "future.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "config version 99 is newer than supported version 2") {
+		t.Errorf("Load = %v, want a newer version error", err)
+	}
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+	"zerodha-connect/internal/storage"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of environment variables that override config values.
+const EnvPrefix = "ZC_"
+
+// filePrefix marks a config value that should be read from a file, e.g. "file:/run/secrets/api_key".
+const filePrefix = "file:"
+
+// Default values applied when neither the config file, the environment nor flags set a field.
+const (
+	DefaultStorageType = "duckdb"
+	DefaultLogFile     = "kite_fetcher.log"
+)
+
+// Policies for candles still forming when a fetch runs during the session.
+const (
+	IncompleteDrop = "drop" // leave them out; the next fetch stores them once final
+	IncompleteFlag = "flag" // store them flagged is_complete=false until the next fetch replaces them
+)
+
+// Overrides holds config values supplied from outside the config file, such as
+// environment variables or command line flags. Empty fields are left untouched.
+type Overrides struct {
+	APIKey      string
+	APISecret   string
+	Instruments []string
+	FromDate    string
+	ToDate      string
+	Interval    string
+	StorageType string
+	StoragePath string
+	LogFile     string
+}
+
+// OverridesFromEnv reads overrides from ZC_* environment variables.
+func OverridesFromEnv() Overrides {
+	o := Overrides{
+		APIKey:      os.Getenv(EnvPrefix + "API_KEY"),
+		APISecret:   os.Getenv(EnvPrefix + "API_SECRET"),
+		FromDate:    os.Getenv(EnvPrefix + "FROM_DATE"),
+		ToDate:      os.Getenv(EnvPrefix + "TO_DATE"),
+		Interval:    os.Getenv(EnvPrefix + "INTERVAL"),
+		StorageType: os.Getenv(EnvPrefix + "STORAGE_TYPE"),
+		StoragePath: os.Getenv(EnvPrefix + "STORAGE_PATH"),
+		LogFile:     os.Getenv(EnvPrefix + "LOG_FILE"),
+	}
+	if v := os.Getenv(EnvPrefix + "INSTRUMENTS"); v != "" {
+		for _, symbol := range strings.Split(v, ",") {
+			if symbol = strings.TrimSpace(symbol); symbol != "" {
+				o.Instruments = append(o.Instruments, symbol)
+			}
+		}
+	}
+	return o
+}
+
+// ApplyOverrides replaces config values with every non-empty override.
+func (c *Config) ApplyOverrides(o Overrides) {
+	if o.APIKey != "" {
+		c.APIKey = o.APIKey
+	}
+	if o.APISecret != "" {
+		c.APISecret = o.APISecret
+	}
+	if len(o.Instruments) > 0 {
+		c.Instruments = InstrumentsOf(o.Instruments)
+	}
+	if o.FromDate != "" {
+		c.FromDate = o.FromDate
+	}
+	if o.ToDate != "" {
+		c.ToDate = o.ToDate
+	}
+	if o.Interval != "" {
+		c.Interval = ParseIntervals(o.Interval)
+	}
+	if (o.StorageType != "" || o.StoragePath != "") && c.HasTargets() {
+		// Selecting a store from outside the file replaces the storage targets
+		c.usePrimaryTarget()
+		c.StorageTargets = nil
+		if o.StorageType != "" && o.StorageType != c.StorageType {
+			// The primary target's path, compression and layout are meant for another type
+			if o.StoragePath == "" {
+				c.StoragePath = ""
+			}
+			c.Compression = ""
+			c.PathTemplate = ""
+		}
+	}
+	if o.StorageType != "" {
+		c.StorageType = o.StorageType
+	}
+	if o.StoragePath != "" {
+		c.StoragePath = o.StoragePath
+	}
+	if o.LogFile != "" {
+		c.LogFile = o.LogFile
+	}
+}
+
+// ApplyDefaults fills in storage and logging settings that are still unset.
+// With storage targets, the top-level storage fields describe the primary target.
+func (c *Config) ApplyDefaults() {
+	if c.HasTargets() {
+		c.usePrimaryTarget()
+	}
+	c.StorageType, c.StoragePath = c.EffectiveStorage()
+	if c.LogFile == "" {
+		c.LogFile = DefaultLogFile
+	}
+}
+
+// EffectiveStorage resolves the storage type and path to use, falling back to
+// the default type and its default path.
+func (c *Config) EffectiveStorage() (string, string) {
+	storageType := c.StorageType
+	if storageType == "" {
+		storageType = DefaultStorageType
+	}
+	storagePath := c.StoragePath
+	if storagePath == "" {
+		storagePath = DefaultStoragePath(storageType)
+	}
+	return storageType, storagePath
+}
+
+// DefaultStoragePath returns the default storage path of a registered
+// storage type, or "" for an unknown one.
+func DefaultStoragePath(storageType string) string {
+	backend, ok := storage.Lookup(storage.StorageType(storageType))
+	if !ok {
+		return ""
+	}
+	return backend.Schema.DefaultPath
+}
+
+// Resolve builds the effective configuration using the precedence chain
+// flags > environment > config file > defaults. When optional is true a
+// missing config file is treated as empty instead of an error.
+func Resolve(path string, optional bool, flags Overrides) (*Config, error) {
+	conf, err := Load(path)
+	if err != nil {
+		if !optional || !os.IsNotExist(err) {
+			return nil, err
+		}
+		conf = &Config{}
+	}
+
+	for _, holiday := range conf.Holidays {
+		if d, err := time.ParseInLocation(DateLayout, holiday, calendar.IST); err == nil {
+			calendar.AddHolidays(d)
+		}
+	}
+
+	// Overrides are kept so that jobs can re-apply them on top of their own fields
+	conf.overrides = []Overrides{OverridesFromEnv(), flags}
+	for _, o := range conf.overrides {
+		conf.ApplyOverrides(o)
+	}
+	// With jobs the top-level fields are shared defaults; built-in defaults are applied per job
+	if !conf.HasJobs() {
+		conf.ApplyDefaults()
+	}
+	return conf, nil
+}
+
+var envRefPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolate expands ${VAR}, ${VAR:-default} and file: references in every
+// scalar value of the document. Relative file paths are resolved against baseDir.
+func interpolate(node *yaml.Node, baseDir string) error {
+	if node.Kind == yaml.MappingNode {
+		// Only values are interpolated, never keys
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := interpolate(node.Content[i], baseDir); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := interpolate(child, baseDir); err != nil {
+			return err
+		}
+	}
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!binary" {
+		return nil
+	}
+
+	value, err := expandEnv(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %v", node.Line, err)
+	}
+	if strings.HasPrefix(value, filePrefix) {
+		filePath := strings.TrimPrefix(value, filePrefix)
+		if !filepath.IsAbs(filePath) {
+			filePath = filepath.Join(baseDir, filePath)
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("line %d: failed to read %s: %v", node.Line, value, err)
+		}
+		value = strings.TrimSpace(string(data))
+	}
+	node.Value = value
+	return nil
+}
+
+// expandEnv replaces ${VAR} and ${VAR:-default} references with environment
+// values. "$$" produces a literal "$".
+func expandEnv(s string) (string, error) {
+	var missing []string
+	out := envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		m := envRefPattern.FindStringSubmatch(ref)
+		if v, ok := os.LookupEnv(m[1]); ok && v != "" {
+			return v
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		missing = append(missing, m[1])
+		return ""
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Failure policies of a storage target.
+const (
+	OnErrorFail     = "fail"     // Abort the run when the target cannot be written
+	OnErrorContinue = "continue" // Log the failure and keep writing the other targets
+)
+
+// StorageTarget is one of several stores every fetched chunk is written to.
+// A config with storage_targets writes to all of them instead of the single
+// storage_type/storage_path store; the first target is the primary one that
+// query, storage and convert commands read from.
+//
+// Targets do not inherit the top-level storage fields: a target without a
+// path uses the default path of its type.
+type StorageTarget struct {
+	Name            string `yaml:"name,omitempty"` // Defaults to the storage type
+	StorageType     string `yaml:"storage_type"`
+	StoragePath     string `yaml:"storage_path,omitempty"`
+	Compression     string `yaml:"compression,omitempty"`
+	PathTemplate    string `yaml:"path_template,omitempty"`
+	FlushRows       int    `yaml:"flush_rows,omitempty"`
+	StorageTimezone string `yaml:"storage_timezone,omitempty"`
+	OnError         string `yaml:"on_error,omitempty"` // "fail" (default) or "continue"
+}
+
+// DisplayName returns the target name, or its storage type when unnamed.
+func (t StorageTarget) DisplayName() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.StorageType
+}
+
+// HasTargets reports whether the config writes to a list of storage targets.
+func (c *Config) HasTargets() bool {
+	return len(c.StorageTargets) > 0
+}
+
+// Targets returns the effective configuration of every storage target: a
+// copy of the config whose storage fields describe the target, with
+// TargetName and OnError set. Configs without storage_targets yield
+// themselves as a single target.
+func (c *Config) Targets() []*Config {
+	if !c.HasTargets() {
+		return []*Config{c}
+	}
+	targets := make([]*Config, 0, len(c.StorageTargets))
+	for _, t := range c.StorageTargets {
+		tc := *c
+		tc.StorageTargets = nil
+		tc.StorageType = t.StorageType
+		tc.StoragePath = t.StoragePath
+		tc.StorageType, tc.StoragePath = tc.EffectiveStorage()
+		tc.Compression = t.Compression
+		tc.PathTemplate = t.PathTemplate
+		tc.FlushRows = t.FlushRows
+		tc.StorageTimezone = t.StorageTimezone
+		tc.TargetName = t.DisplayName()
+		tc.OnError = t.OnError
+		if tc.OnError == "" {
+			tc.OnError = OnErrorFail
+		}
+		targets = append(targets, &tc)
+	}
+	return targets
+}
+
+// usePrimaryTarget copies the storage fields of the first target to the
+// top-level fields, so commands reading a single store use the primary target.
+func (c *Config) usePrimaryTarget() {
+	primary := c.Targets()[0]
+	c.StorageType = primary.StorageType
+	c.StoragePath = primary.StoragePath
+	c.Compression = primary.Compression
+	c.PathTemplate = primary.PathTemplate
+	c.FlushRows = primary.FlushRows
+	c.StorageTimezone = primary.StorageTimezone
+}
+
+// validateTargets checks the storage_targets list: names, failure policies,
+// that no two targets write the same store, and the storage fields of each.
+func (c *Config) validateTargets(result *ValidationResult) {
+	names := make(map[string]bool)
+	valid := true
+	for i, t := range c.StorageTargets {
+		field := fmt.Sprintf("storage_targets[%d]", i)
+		if t.StorageType == "" {
+			result.AddError(field+".storage_type", "", "is required")
+			valid = false
+			continue
+		}
+		if names[t.DisplayName()] {
+			result.AddError(field+".name", t.DisplayName(), "duplicate target name, set a distinct name")
+			valid = false
+		}
+		names[t.DisplayName()] = true
+		switch t.OnError {
+		case "", OnErrorFail, OnErrorContinue:
+		default:
+			result.AddError(field+".on_error", t.OnError, fmt.Sprintf("must be one of: %s, %s", OnErrorFail, OnErrorContinue))
+			valid = false
+		}
+	}
+	if !valid {
+		return
+	}
+
+	stores := make(map[string]string)
+	for _, tc := range c.Targets() {
+		prefix := fmt.Sprintf("storage_targets[%s].", tc.TargetName)
+		store := tc.StorageType + ":" + filepath.Clean(tc.StoragePath)
+		if other, ok := stores[store]; ok {
+			result.AddError(prefix+"storage_path", tc.StoragePath, fmt.Sprintf("already written by target %s", other))
+		}
+		stores[store] = tc.TargetName
+		result.Merge(tc.validateStorageFields(), prefix)
+	}
+}
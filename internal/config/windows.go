@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+// timeOfDayLayout is the layout of from_time and to_time in windows.
+const timeOfDayLayout = "15:04"
+
+// Window selects part of the timeline to fetch. A config with windows fetches
+// only those windows instead of the continuous from_date..to_date range.
+//
+// A window either lists event Dates, each widened by Around trading days on
+// both sides, or spans From..To. FromTime and ToTime optionally restrict every
+// day of the window to a time of day, e.g. 09:15 to 10:30.
+type Window struct {
+	Dates    []string `yaml:"dates,omitempty"`
+	Around   int      `yaml:"around,omitempty"`
+	From     string   `yaml:"from,omitempty"`
+	To       string   `yaml:"to,omitempty"`
+	FromTime string   `yaml:"from_time,omitempty"`
+	ToTime   string   `yaml:"to_time,omitempty"`
+}
+
+// TimeRange is a span of time to fetch in IST, inclusive of both ends.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// TimeRanges resolves the config into the sorted, non-overlapping ranges to
+// fetch: either the windows, or the single from_date..to_date range.
+func (c *Config) TimeRanges(now time.Time) ([]TimeRange, error) {
+	if len(c.Windows) == 0 {
+		from, to, err := c.DateRange(now)
+		if err != nil {
+			return nil, err
+		}
+		return []TimeRange{{From: from, To: to}}, nil
+	}
+
+	var ranges []TimeRange
+	for i, w := range c.Windows {
+		windowRanges, err := w.resolve(now, c.Interval.First())
+		if err != nil {
+			return nil, fmt.Errorf("windows[%d]: %v", i, err)
+		}
+		ranges = append(ranges, windowRanges...)
+	}
+	return mergeRanges(ranges), nil
+}
+
+// resolve expands a window into time ranges.
+func (w Window) resolve(now time.Time, interval string) ([]TimeRange, error) {
+	if len(w.Dates) > 0 && (w.From != "" || w.To != "") {
+		return nil, fmt.Errorf("use either dates or from/to, not both")
+	}
+	if len(w.Dates) == 0 && (w.From == "" || w.To == "") {
+		return nil, fmt.Errorf("dates or both from and to are required")
+	}
+	if w.Around < 0 {
+		return nil, fmt.Errorf("around (%d) must not be negative", w.Around)
+	}
+	if (w.FromTime == "") != (w.ToTime == "") {
+		return nil, fmt.Errorf("from_time and to_time must be set together")
+	}
+
+	var fromTime, toTime time.Duration
+	if w.FromTime != "" {
+		ft, err1 := time.Parse(timeOfDayLayout, w.FromTime)
+		tt, err2 := time.Parse(timeOfDayLayout, w.ToTime)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("from_time and to_time must be in HH:MM format")
+		}
+		fromTime = time.Duration(ft.Hour())*time.Hour + time.Duration(ft.Minute())*time.Minute
+		toTime = time.Duration(tt.Hour())*time.Hour + time.Duration(tt.Minute())*time.Minute
+		if fromTime >= toTime {
+			return nil, fmt.Errorf("from_time (%s) must be before to_time (%s)", w.FromTime, w.ToTime)
+		}
+	}
+
+	// Collect the spans the window covers
+	var spans []TimeRange
+	if len(w.Dates) > 0 {
+		for _, expr := range w.Dates {
+			day, err := ResolveDate(expr, now, interval)
+			if err != nil {
+				return nil, fmt.Errorf("date %s: %v", expr, err)
+			}
+			start, end := day, day
+			if w.Around > 0 {
+				start = calendar.AddTradingDays(day, -w.Around)
+				end = calendar.AddTradingDays(day, w.Around)
+			}
+			spans = append(spans, TimeRange{From: start, To: end.AddDate(0, 0, 1).Add(-time.Second)})
+		}
+	} else {
+		from, err := ResolveTime(w.From, now, interval, false)
+		if err != nil {
+			return nil, fmt.Errorf("from (%s): %v", w.From, err)
+		}
+		to, err := ResolveTime(w.To, now, interval, true)
+		if err != nil {
+			return nil, fmt.Errorf("to (%s): %v", w.To, err)
+		}
+		if !from.Before(to) {
+			return nil, fmt.Errorf("from (%s) must be before to (%s)", w.From, w.To)
+		}
+		spans = append(spans, TimeRange{From: from, To: to})
+	}
+
+	if w.FromTime == "" {
+		return spans, nil
+	}
+
+	// Restrict every trading day of each span to the time-of-day window
+	var ranges []TimeRange
+	for _, span := range spans {
+		for day := calendar.Date(span.From); !day.After(span.To); day = day.AddDate(0, 0, 1) {
+			if !calendar.IsTradingDay(day) {
+				continue
+			}
+			r := TimeRange{From: day.Add(fromTime), To: day.Add(toTime)}
+			if r.From.Before(span.From) {
+				r.From = span.From
+			}
+			if r.To.After(span.To) {
+				r.To = span.To
+			}
+			if r.From.Before(r.To) {
+				ranges = append(ranges, r)
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("has no trading day with a %s-%s session to fetch", w.FromTime, w.ToTime)
+	}
+	return ranges, nil
+}
+
+// mergeRanges sorts ranges and joins the ones that overlap.
+func mergeRanges(ranges []TimeRange) []TimeRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].From.Before(ranges[j].From) })
+	var merged []TimeRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && !r.From.After(merged[n-1].To) {
+			if r.To.After(merged[n-1].To) {
+				merged[n-1].To = r.To
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+func TestTimeRangesWithoutTradingDays(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, calendar.IST)
+	tests := []struct {
+		name    string
+		windows []Window
+		ranges  int
+		err     string
+	}{
+		{"holiday", []Window{{Dates: []string{"2024-01-26"}}}, 1, ""},
+		{"holiday session", []Window{{Dates: []string{"2024-01-26"}, FromTime: "09:15", ToTime: "10:30"}}, 0, "has no trading day"},
+		{"weekend session", []Window{{From: "2024-01-27", To: "2024-01-28", FromTime: "09:15", ToTime: "10:30"}}, 0, "has no trading day"},
+		{"holiday session around", []Window{{Dates: []string{"2024-01-26"}, Around: 1, FromTime: "09:15", ToTime: "10:30"}}, 2, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &Config{Interval: Intervals{"minute"}, Windows: tt.windows}
+			ranges, err := conf.TimeRanges(now)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("TimeRanges = %v, %v, want an error with %q", ranges, err, tt.err)
+				}
+				return
+			}
+			if err != nil || len(ranges) != tt.ranges {
+				t.Errorf("TimeRanges = %d ranges, %v, want %d", len(ranges), err, tt.ranges)
+			}
+		})
+	}
+}
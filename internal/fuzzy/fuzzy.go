@@ -0,0 +1,76 @@
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+)
+
+// Distance returns the Levenshtein edit distance between a and b.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// MaxDistance returns the largest edit distance still considered a near miss
+// for a word of the given length.
+func MaxDistance(word string) int {
+	switch n := len([]rune(word)); {
+	case n <= 4:
+		return 1
+	case n <= 10:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// Closest returns up to limit candidates within MaxDistance of word, closest
+// first. The comparison ignores case so that case mistakes rank highest.
+func Closest(word string, candidates []string, limit int) []string {
+	type match struct {
+		value    string
+		distance int
+	}
+
+	maxDist := MaxDistance(word)
+	lower := strings.ToLower(word)
+	var matches []match
+	for _, c := range candidates {
+		d := Distance(lower, strings.ToLower(c))
+		if d <= maxDist {
+			matches = append(matches, match{value: c, distance: d})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].value < matches[j].value
+	})
+
+	var out []string
+	for _, m := range matches {
+		if limit > 0 && len(out) == limit {
+			break
+		}
+		out = append(out, m.value)
+	}
+	return out
+}
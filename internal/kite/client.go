@@ -2,8 +2,10 @@ package kite
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"time"
 
 	"zerodha-connect/internal/config"
@@ -11,6 +13,7 @@ import (
 
 	kiteconnect "github.com/zerodha/gokiteconnect/v4"
 	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -62,20 +65,17 @@ func (c *Client) getConfigPath() string {
 	return "config.yaml"
 }
 
-// Authenticate handles the full authentication flow.
-func (c *Client) Authenticate() error {
-	if c.conf.RequestToken != "" {
-		c.logger.Println("✅ Request token found in config. Proceeding...")
-		c.kc.SetAccessToken(c.conf.RequestToken)
-		return nil
-	}
-
-	c.logger.Println("🔐 No request token found. Starting authentication flow...")
-
+// Login runs the interactive browser login flow and caches the resulting session.
+func (c *Client) Login() (*Session, error) {
 	if c.conf.APIKey == "" || c.conf.APISecret == "" {
-		return fmt.Errorf("API key and API secret are required for authentication")
+		return nil, &AuthenticationError{
+			Type:    AuthErrorMissingCredentials,
+			Message: "API key and API secret are required for authentication",
+		}
 	}
 
+	c.logger.Println("🔐 Starting authentication flow...")
+
 	loginURL := c.kc.GetLoginURL()
 	c.logger.Printf("🌐 Opening browser for Zerodha login...")
 
@@ -85,91 +85,145 @@ func (c *Client) Authenticate() error {
 
 	requestToken, err := ui.GetRequestToken(loginURL)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	c.logger.Printf("🔄 Exchanging request token for access token...")
 
 	data, err := c.kc.GenerateSession(requestToken, c.conf.APISecret)
 	if err != nil {
-		return fmt.Errorf("failed to generate session: %v", err)
+		return nil, &AuthenticationError{
+			Type:    AuthErrorAPIFailure,
+			Message: "failed to generate session",
+			Cause:   err,
+		}
 	}
 
-	c.conf.RequestToken = data.AccessToken
-	configPath := c.getConfigPath()
-	if err := config.Save(configPath, c.conf); err != nil {
-		return fmt.Errorf("failed to save request token to config: %v", err)
+	loginTime := data.LoginTime.Time
+	if loginTime.IsZero() {
+		loginTime = time.Now()
+	}
+	session := &Session{
+		APIKey:      c.conf.APIKey,
+		UserID:      data.UserID,
+		UserName:    data.UserName,
+		AccessToken: data.AccessToken,
+		LoginTime:   loginTime,
+	}
+	if err := SaveSession(session); err != nil {
+		return nil, err
 	}
 
-	c.kc.SetAccessToken(c.conf.RequestToken)
-	c.logger.Printf("✅ Authentication successful! Request token saved to %s", configPath)
-	return nil
+	c.kc.SetAccessToken(session.AccessToken)
+	c.logger.Printf("✅ Authentication successful! Session saved to %s", sessionFile)
+	return session, nil
 }
 
-// AuthenticateWithTokenValidation handles authentication with proper token validation
-func (c *Client) AuthenticateWithTokenValidation() error {
+// CachedSession returns the cached session for the configured API key, falling
+// back to a legacy access token stored in the config file. It returns nil when
+// no usable token is available.
+func (c *Client) CachedSession() (*Session, error) {
+	session, err := LoadSession()
+	if err != nil {
+		return nil, err
+	}
+	if session != nil && (session.APIKey == "" || session.APIKey == c.conf.APIKey) {
+		return session, nil
+	}
 	if c.conf.RequestToken != "" {
-		c.logger.Println("✅ Request token found in config. Validating...")
-		c.kc.SetAccessToken(c.conf.RequestToken)
+		return &Session{APIKey: c.conf.APIKey, AccessToken: c.conf.RequestToken}, nil
+	}
+	return nil, nil
+}
 
-		// Test the token by making a simple API call
-		if err := c.limiter.Wait(context.Background()); err != nil {
-			return fmt.Errorf("rate limiter error: %v", err)
+// EnsureSession loads the cached session and verifies it against the Kite API.
+// It never starts an interactive login; callers should direct the user to log in
+// when an *AuthenticationError is returned.
+func (c *Client) EnsureSession() error {
+	session, err := c.CachedSession()
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return &AuthenticationError{
+			Type:    AuthErrorNotLoggedIn,
+			Message: "not logged in",
 		}
-
-		_, err := c.kc.GetUserProfile()
-		if err != nil {
-			// Request token is present but invalid/expired
-			return &AuthenticationError{
-				Type:    AuthErrorTokenExpired,
-				Message: "Request token appears to be expired or invalid",
-				Cause:   err,
-			}
+	}
+	if session.IsExpired(time.Now()) {
+		return &AuthenticationError{
+			Type:    AuthErrorTokenExpired,
+			Message: fmt.Sprintf("access token expired at %s", session.ExpiresAt().Format("2006-01-02 15:04 MST")),
 		}
-
-		c.logger.Println("✅ Request token is valid")
-		return nil
 	}
 
-	// No request token present - start auth flow
-	return c.startAuthenticationFlow()
-}
-
-// startAuthenticationFlow handles the OAuth flow
-func (c *Client) startAuthenticationFlow() error {
-	c.logger.Println("🔐 No request token found. Starting authentication flow...")
+	c.kc.SetAccessToken(session.AccessToken)
 
-	if c.conf.APIKey == "" || c.conf.APISecret == "" {
-		return fmt.Errorf("API key and API secret are required for authentication")
+	if err := c.limiter.Wait(context.Background()); err != nil {
+		return fmt.Errorf("rate limiter error: %v", err)
+	}
+	if _, err := c.kc.GetUserProfile(); err != nil {
+		if !isTokenError(err) {
+			// Network failures and the like say nothing about the token
+			return fmt.Errorf("failed to verify access token: %v", err)
+		}
+		return &AuthenticationError{
+			Type:    AuthErrorTokenExpired,
+			Message: "access token is expired or invalid",
+			Cause:   err,
+		}
 	}
 
-	loginURL := c.kc.GetLoginURL()
-	c.logger.Printf("🌐 Opening browser for Zerodha login...")
+	c.logger.Println("✅ Access token is valid")
+	return nil
+}
 
-	if err := ui.OpenBrowser(loginURL); err != nil {
-		c.logger.Printf("⚠️  Failed to open browser automatically: %v", err)
+// isTokenError reports whether a Kite API error rejects the access token.
+func isTokenError(err error) bool {
+	var kiteErr kiteconnect.Error
+	if !errors.As(err, &kiteErr) {
+		return false
 	}
+	return kiteErr.ErrorType == kiteconnect.TokenError || kiteErr.Code == http.StatusForbidden
+}
 
-	requestToken, err := ui.GetRequestToken(loginURL)
+// Logout invalidates the current access token with Kite and removes every stored copy of it.
+func (c *Client) Logout() error {
+	session, err := c.CachedSession()
 	if err != nil {
 		return err
 	}
+	if session == nil {
+		return &AuthenticationError{
+			Type:    AuthErrorNotLoggedIn,
+			Message: "not logged in",
+		}
+	}
 
-	c.logger.Printf("🔄 Exchanging request token for access token...")
-
-	data, err := c.kc.GenerateSession(requestToken, c.conf.APISecret)
-	if err != nil {
-		return fmt.Errorf("failed to generate session: %v", err)
+	c.kc.SetAccessToken(session.AccessToken)
+	if err := c.limiter.Wait(context.Background()); err != nil {
+		return fmt.Errorf("rate limiter error: %v", err)
+	}
+	if _, err := c.kc.InvalidateAccessToken(); err != nil {
+		// An already expired token cannot be invalidated; still clear it locally.
+		c.logger.Printf("⚠️  Failed to invalidate access token: %v", err)
 	}
 
-	c.conf.RequestToken = data.AccessToken
-	configPath := c.getConfigPath()
-	if err := config.Save(configPath, c.conf); err != nil {
-		return fmt.Errorf("failed to save request token to config: %v", err)
+	if err := RemoveSession(); err != nil {
+		return err
+	}
+	if c.conf.RequestToken != "" {
+		c.conf.RequestToken = ""
+		err := config.UpdateFile(c.getConfigPath(), func(root *yaml.Node) error {
+			config.RemoveKey(root, "request_token")
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove access token from config: %v", err)
+		}
 	}
 
-	c.kc.SetAccessToken(c.conf.RequestToken)
-	c.logger.Printf("✅ Authentication successful! Request token saved to %s", configPath)
+	c.logger.Println("✅ Logged out and removed stored access token")
 	return nil
 }
 
@@ -194,6 +248,7 @@ const (
 	AuthErrorTokenExpired AuthErrorType = iota
 	AuthErrorMissingCredentials
 	AuthErrorAPIFailure
+	AuthErrorNotLoggedIn
 )
 
 // GetKiteConnectClient returns the underlying Kite Connect client instance.
@@ -201,19 +256,37 @@ func (c *Client) GetKiteConnectClient() *kiteconnect.Client {
 	return c.kc
 }
 
-// GetHistoricalData fetches historical data for a given instrument.
-func (c *Client) GetHistoricalData(instrumentToken int, interval string, from, to time.Time) ([]kiteconnect.HistoricalData, error) {
+// GetHistoricalData fetches historical data for a given instrument. With
+// continuous, the candles of expired futures contracts are included; with oi,
+// candles carry the open interest.
+func (c *Client) GetHistoricalData(instrumentToken int, interval string, from, to time.Time, continuous, oi bool) ([]kiteconnect.HistoricalData, error) {
 	if err := c.limiter.Wait(context.Background()); err != nil {
 		return nil, fmt.Errorf("rate limiter error: %v", err)
 	}
 
-	candles, err := c.kc.GetHistoricalData(instrumentToken, interval, from, to, false, false)
+	candles, err := c.kc.GetHistoricalData(instrumentToken, interval, from, to, continuous, oi)
 	if err != nil {
 		return nil, fmt.Errorf("API error: %v", err)
 	}
 	return candles, nil
 }
 
+// FirstCandle finds the earliest daily candle of an instrument between from
+// and to, requesting daily chunks from from onwards until one has data. It
+// returns false when the instrument has no candles in the range.
+func (c *Client) FirstCandle(instrumentToken int, from, to time.Time, continuous bool) (time.Time, bool, error) {
+	for _, chunk := range GenerateDateChunks(from, to, "day") {
+		candles, err := c.GetHistoricalData(instrumentToken, "day", chunk[0], chunk[1], continuous, false)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if len(candles) > 0 {
+			return candles[0].Date.Time, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
 // GetUserProfile fetches the user profile information.
 func (c *Client) GetUserProfile() (*kiteconnect.UserProfile, error) {
 	if err := c.limiter.Wait(context.Background()); err != nil {
@@ -2,6 +2,8 @@ package kite
 
 import (
 	"time"
+
+	"zerodha-connect/internal/calendar"
 )
 
 const (
@@ -35,6 +37,27 @@ func parseIntervalMinutes(interval string) int {
 	return 1 // default to 1 minute if unknown
 }
 
+// CandleEnd returns when the candle of the interval starting at start closes:
+// after the interval length, or at the session close for the last intraday
+// candle of a session and for daily candles.
+func CandleEnd(start time.Time, interval string) time.Time {
+	sessionClose := calendar.SessionClose(start)
+	if IsDailyOrLarger(interval) {
+		return sessionClose
+	}
+	end := start.Add(time.Duration(parseIntervalMinutes(interval)) * time.Minute)
+	if end.After(sessionClose) {
+		return sessionClose
+	}
+	return end
+}
+
+// IsCandleComplete reports whether the candle starting at start had closed at
+// now. A candle still forming changes until its end.
+func IsCandleComplete(start time.Time, interval string, now time.Time) bool {
+	return !now.Before(CandleEnd(start, interval))
+}
+
 // GenerateDateChunks creates time chunks for API requests based on the interval.
 func GenerateDateChunks(from, to time.Time, interval string) [][2]time.Time {
 	var chunkSize time.Duration
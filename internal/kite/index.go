@@ -0,0 +1,232 @@
+package kite
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+	"zerodha-connect/internal/fuzzy"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// ExchangePreference is the order in which a bare symbol listed on several
+// exchanges is resolved. Use EXCHANGE:SYMBOL to pick another listing.
+var ExchangePreference = []string{"NSE", "BSE", "NFO", "BFO", "MCX", "CDS", "BCD"}
+
+// yahooSuffixes maps Yahoo Finance style suffixes to Kite exchanges.
+var yahooSuffixes = map[string]string{".NS": "NSE", ".BO": "BSE"}
+
+// InstrumentIndex resolves configured symbols against the instrument master.
+type InstrumentIndex struct {
+	bySymbol map[string][]kiteconnect.Instrument
+	byUpper  map[string][]string
+	byName   map[string][]kiteconnect.Instrument
+	symbols  []string
+}
+
+// Suggestion is a proposed replacement for a symbol that was not found.
+type Suggestion struct {
+	Symbol string
+	Reason string
+}
+
+// NewInstrumentIndex indexes instruments by trading symbol and, for
+// derivatives, by underlying name.
+func NewInstrumentIndex(instruments []kiteconnect.Instrument) *InstrumentIndex {
+	idx := &InstrumentIndex{
+		bySymbol: make(map[string][]kiteconnect.Instrument),
+		byUpper:  make(map[string][]string),
+		byName:   make(map[string][]kiteconnect.Instrument),
+	}
+	for _, instr := range instruments {
+		if _, seen := idx.bySymbol[instr.Tradingsymbol]; !seen {
+			idx.symbols = append(idx.symbols, instr.Tradingsymbol)
+			upper := strings.ToUpper(instr.Tradingsymbol)
+			idx.byUpper[upper] = append(idx.byUpper[upper], instr.Tradingsymbol)
+		}
+		idx.bySymbol[instr.Tradingsymbol] = append(idx.bySymbol[instr.Tradingsymbol], instr)
+		if !instr.Expiry.Time.IsZero() && instr.Name != "" {
+			idx.byName[instr.Name] = append(idx.byName[instr.Name], instr)
+		}
+	}
+	return idx
+}
+
+// SplitSymbol splits an EXCHANGE:SYMBOL reference. The exchange is empty for bare symbols.
+func SplitSymbol(ref string) (exchange, symbol string) {
+	if i := strings.Index(ref, ":"); i >= 0 {
+		return strings.ToUpper(strings.TrimSpace(ref[:i])), strings.TrimSpace(ref[i+1:])
+	}
+	return "", strings.TrimSpace(ref)
+}
+
+// Len returns the number of distinct trading symbols in the index.
+func (idx *InstrumentIndex) Len() int {
+	return len(idx.symbols)
+}
+
+// Lookup resolves a bare symbol or an EXCHANGE:SYMBOL reference. Bare symbols
+// listed on several exchanges resolve following ExchangePreference.
+func (idx *InstrumentIndex) Lookup(ref string) (kiteconnect.Instrument, bool) {
+	exchange, symbol := SplitSymbol(ref)
+	listings := idx.bySymbol[symbol]
+	if len(listings) == 0 {
+		return kiteconnect.Instrument{}, false
+	}
+	if exchange != "" {
+		for _, instr := range listings {
+			if instr.Exchange == exchange {
+				return instr, true
+			}
+		}
+		return kiteconnect.Instrument{}, false
+	}
+	return preferredListing(listings), true
+}
+
+// preferredListing picks the listing on the most preferred exchange.
+func preferredListing(listings []kiteconnect.Instrument) kiteconnect.Instrument {
+	best, bestRank := listings[0], len(ExchangePreference)
+	for _, instr := range listings {
+		for rank, exchange := range ExchangePreference {
+			if instr.Exchange == exchange && rank < bestRank {
+				best, bestRank = instr, rank
+			}
+		}
+	}
+	return best
+}
+
+// Suggest proposes replacements for a symbol that Lookup could not resolve:
+// the same symbol in the right case or on another exchange, the nearest
+// live contract for an expired derivative, and close spellings.
+func (idx *InstrumentIndex) Suggest(ref string, now time.Time, limit int) []Suggestion {
+	exchange, symbol := SplitSymbol(ref)
+	var out []Suggestion
+	seen := make(map[string]bool)
+	add := func(symbol, reason string) {
+		if !seen[symbol] && (limit <= 0 || len(out) < limit) {
+			seen[symbol] = true
+			out = append(out, Suggestion{Symbol: symbol, Reason: reason})
+		}
+	}
+
+	// Yahoo Finance style symbols such as SBIN.NS
+	for suffix, suffixExchange := range yahooSuffixes {
+		if upper := strings.ToUpper(symbol); exchange == "" && strings.HasSuffix(upper, suffix) {
+			bare := strings.TrimSuffix(upper, suffix)
+			if _, ok := idx.Lookup(suffixExchange + ":" + bare); ok {
+				add(suffixExchange+":"+bare, fmt.Sprintf("Kite uses EXCHANGE:SYMBOL instead of %s", suffix))
+			}
+		}
+	}
+
+	// Wrong case
+	for _, candidate := range idx.byUpper[strings.ToUpper(symbol)] {
+		if candidate == symbol {
+			continue
+		}
+		if exchange == "" {
+			add(candidate, "symbols are case-sensitive")
+		} else if _, ok := idx.Lookup(exchange + ":" + candidate); ok {
+			add(exchange+":"+candidate, "symbols are case-sensitive")
+		}
+	}
+
+	// Listed on another exchange
+	if exchange != "" {
+		for _, instr := range idx.bySymbol[symbol] {
+			if instr.Exchange == exchange {
+				continue
+			}
+			add(instr.Exchange+":"+symbol, fmt.Sprintf("listed on %s, not %s", instr.Exchange, exchange))
+		}
+	}
+
+	// Expired derivative contract
+	if instr, ok := idx.nearestContract(strings.ToUpper(symbol), exchange, now); ok {
+		replacement := instr.Tradingsymbol
+		if exchange != "" {
+			replacement = instr.Exchange + ":" + replacement
+		}
+		add(replacement, fmt.Sprintf("contract not listed (expired?); nearest live contract expires %s",
+			instr.Expiry.Time.Format("2006-01-02")))
+	}
+
+	// Close spellings
+	for _, candidate := range fuzzy.Closest(symbol, idx.symbols, limit) {
+		if exchange != "" {
+			if _, ok := idx.Lookup(exchange + ":" + candidate); !ok {
+				continue
+			}
+			candidate = exchange + ":" + candidate
+		}
+		add(candidate, "similar spelling")
+	}
+	return out
+}
+
+// derivativeSuffixes are the instrument types encoded at the end of
+// derivative trading symbols.
+var derivativeSuffixes = []string{"FUT", "CE", "PE"}
+
+// nearestContract finds the live contract with the same underlying and
+// instrument type as an unlisted derivative symbol, preferring the same
+// strike and then the nearest expiry.
+func (idx *InstrumentIndex) nearestContract(symbol, exchange string, now time.Time) (kiteconnect.Instrument, bool) {
+	var instrumentType string
+	for _, suffix := range derivativeSuffixes {
+		if strings.HasSuffix(symbol, suffix) {
+			instrumentType = suffix
+			break
+		}
+	}
+	if instrumentType == "" {
+		return kiteconnect.Instrument{}, false
+	}
+	body := strings.TrimSuffix(symbol, instrumentType)
+
+	// The longest underlying name the symbol starts with, e.g. BANKNIFTY rather than BANK
+	var name string
+	for candidate := range idx.byName {
+		if strings.HasPrefix(body, candidate) && len(candidate) > len(name) {
+			name = candidate
+		}
+	}
+	if name == "" {
+		return kiteconnect.Instrument{}, false
+	}
+
+	today := calendar.Date(now)
+	var matches []kiteconnect.Instrument
+	for _, instr := range idx.byName[name] {
+		if instr.InstrumentType != instrumentType || instr.Expiry.Time.Before(today) {
+			continue
+		}
+		if exchange != "" && instr.Exchange != exchange {
+			continue
+		}
+		matches = append(matches, instr)
+	}
+	if len(matches) == 0 {
+		return kiteconnect.Instrument{}, false
+	}
+
+	sameStrike := func(instr kiteconnect.Instrument) bool {
+		return instrumentType != "FUT" && strings.HasSuffix(body, strconv.FormatFloat(instr.StrikePrice, 'f', -1, 64))
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if si, sj := sameStrike(matches[i]), sameStrike(matches[j]); si != sj {
+			return si
+		}
+		return matches[i].Expiry.Time.Before(matches[j].Expiry.Time)
+	})
+	if instrumentType != "FUT" && !sameStrike(matches[0]) {
+		return kiteconnect.Instrument{}, false
+	}
+	return matches[0], true
+}
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
+
+	"zerodha-connect/internal/calendar"
 
 	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
 )
 
 const instrumentCacheFile = "instrument_cache.json"
@@ -40,6 +44,12 @@ func GetInstruments(kc *kiteconnect.Client, logger *log.Logger) ([]kiteconnect.I
 			// Convert cached instruments to kiteconnect.Instrument format
 			instrumentsList = make([]kiteconnect.Instrument, len(cachedInstruments))
 			for i, cached := range cachedInstruments {
+				var expiry models.Time
+				if cached.Expiry != "" {
+					if t, parseErr := time.ParseInLocation("2006-01-02", cached.Expiry, calendar.IST); parseErr == nil {
+						expiry.Time = t
+					}
+				}
 				instrumentsList[i] = kiteconnect.Instrument{
 					InstrumentToken: cached.InstrumentToken,
 					ExchangeToken:   cached.ExchangeToken,
@@ -52,7 +62,7 @@ func GetInstruments(kc *kiteconnect.Client, logger *log.Logger) ([]kiteconnect.I
 					InstrumentType:  cached.InstrumentType,
 					Segment:         cached.Segment,
 					Exchange:        cached.Exchange,
-					// Skip Expiry field to avoid time parsing issues
+					Expiry:          expiry,
 				}
 			}
 			logger.Printf("Successfully loaded %d instruments from cache: %s", len(instrumentsList), instrumentCacheFile)
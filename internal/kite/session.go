@@ -0,0 +1,97 @@
+package kite
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+const sessionFile = "kite_session.json"
+
+// tokenExpiryHour is the hour (IST) at which Kite invalidates all access tokens.
+const tokenExpiryHour = 6
+
+// Session holds a cached Kite access token along with details of the login that produced it.
+type Session struct {
+	APIKey      string    `json:"api_key"`
+	UserID      string    `json:"user_id"`
+	UserName    string    `json:"user_name"`
+	AccessToken string    `json:"access_token"`
+	LoginTime   time.Time `json:"login_time"`
+}
+
+// ExpiresAt returns the time at which Kite is expected to expire the token.
+// Tokens are valid until 06:00 IST on the day after login. A zero time is
+// returned when the login time is unknown (e.g. legacy tokens from config).
+func (s *Session) ExpiresAt() time.Time {
+	if s.LoginTime.IsZero() {
+		return time.Time{}
+	}
+	login := s.LoginTime.In(calendar.IST)
+	expiry := time.Date(login.Year(), login.Month(), login.Day(), tokenExpiryHour, 0, 0, 0, calendar.IST)
+	if !expiry.After(login) {
+		expiry = expiry.AddDate(0, 0, 1)
+	}
+	return expiry
+}
+
+// Age returns how long ago the token was issued.
+func (s *Session) Age(now time.Time) time.Duration {
+	if s.LoginTime.IsZero() {
+		return 0
+	}
+	return now.Sub(s.LoginTime)
+}
+
+// IsExpired reports whether the token is past its expected expiry.
+func (s *Session) IsExpired(now time.Time) bool {
+	expiry := s.ExpiresAt()
+	return !expiry.IsZero() && !now.Before(expiry)
+}
+
+// LoadSession reads the cached session. It returns nil without an error when no session exists.
+func LoadSession() (*Session, error) {
+	data, err := os.ReadFile(sessionFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read session file %s: %v", sessionFile, err)
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session file %s: %v", sessionFile, err)
+	}
+	if session.AccessToken == "" {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// SaveSession writes the session to the session cache file, readable only by the current user.
+func SaveSession(session *Session) error {
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %v", err)
+	}
+	if err := os.WriteFile(sessionFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write session file %s: %v", sessionFile, err)
+	}
+	return nil
+}
+
+// RemoveSession deletes the session cache file if it exists.
+func RemoveSession() error {
+	if err := os.Remove(sessionFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove session file %s: %v", sessionFile, err)
+	}
+	return nil
+}
+
+// SessionFile returns the path of the session cache file.
+func SessionFile() string {
+	return sessionFile
+}
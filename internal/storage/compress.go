@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the codec of files written by the file-based stores.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// compressionExts lists the file suffixes of every codec, uncompressed first.
+var compressionExts = []string{"", ".gz", ".zst"}
+
+// ParseCompression parses a compression setting ("", "none", "gzip" or "zstd").
+func ParseCompression(value string) (Compression, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "none":
+		return CompressionNone, nil
+	case "gzip", "gz":
+		return CompressionGzip, nil
+	case "zstd", "zst":
+		return CompressionZstd, nil
+	default:
+		return CompressionNone, fmt.Errorf("unknown compression %q (use none, gzip or zstd)", value)
+	}
+}
+
+// Ext returns the file suffix of the codec: "", ".gz" or ".zst".
+func (c Compression) Ext() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// compress encodes data as a single, self-contained gzip member or zstd frame.
+// Members appended one after another form a valid file for both codecs, which
+// is how the stores append to compressed files.
+func (c Compression) compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	default:
+		return nil, fmt.Errorf("unknown compression %q", c)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressionOf returns the codec a file name's suffix indicates.
+func compressionOf(path string) Compression {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return CompressionGzip
+	case strings.HasSuffix(path, ".zst"):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// trimCompressionExt strips a .gz or .zst suffix from a file name.
+func trimCompressionExt(name string) string {
+	for _, ext := range compressionExts[1:] {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// openFile opens a file for streaming, decompressing it according to its
+// suffix. Concatenated gzip members and zstd frames are read as one stream;
+// a final member cut short by an interrupted write ends it with
+// io.ErrUnexpectedEOF.
+func openFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch compressionOf(path) {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(file)
+		if err == io.EOF {
+			return file, nil // An empty file
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return &decompressedFile{Reader: failingReader{err}, file: file}, nil
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return &decompressedFile{Reader: gr, file: file}, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return &decompressedFile{Reader: zr, file: file, close: zr.Close}, nil
+	default:
+		return file, nil
+	}
+}
+
+// decompressedFile reads a file through a decoder.
+type decompressedFile struct {
+	io.Reader
+	file  *os.File
+	close func()
+}
+
+func (f *decompressedFile) Close() error {
+	if f.close != nil {
+		f.close()
+	}
+	return f.file.Close()
+}
+
+// failingReader fails every read with err.
+type failingReader struct{ err error }
+
+func (r failingReader) Read([]byte) (int, error) { return 0, r.err }
+
+// completeLines passes on the complete lines of a stream. A partial last
+// line, including one cut short with its compressed member, is dropped and
+// reported through truncated once the stream is read to its end.
+type completeLines struct {
+	r         *bufio.Reader
+	line      []byte
+	err       error
+	truncated bool
+}
+
+func newCompleteLines(r io.Reader) *completeLines {
+	return &completeLines{r: bufio.NewReader(r)}
+}
+
+func (c *completeLines) Read(p []byte) (int, error) {
+	for len(c.line) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		line, err := c.r.ReadBytes('\n')
+		switch {
+		case err == nil:
+			c.line = line
+		case err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF):
+			c.truncated = len(line) > 0 || err != io.EOF
+			c.err = io.EOF
+		default:
+			c.err = err
+		}
+	}
+	n := copy(p, c.line)
+	c.line = c.line[n:]
+	return n, nil
+}
+
+// readFile reads a whole file, decompressing it according to its suffix.
+// A final member cut short by an interrupted write is dropped and reported
+// through truncated, so that readers can treat it like a partial last line.
+func readFile(path string) (data []byte, truncated bool, err error) {
+	r, err := openFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Close()
+	data, err = io.ReadAll(r)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return data, true, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %v", path, err)
+	}
+	return data, false, nil
+}
+
+// readFirstLine reads the first line of a file, decompressing it according to
+// its suffix, without reading the rest. It returns "" for an empty file.
+func readFirstLine(path string) (string, error) {
+	r, err := openFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// appendFile appends data to path as one new compressed member (or as plain
+// bytes for uncompressed files) and syncs the file. If the write fails the
+// file is truncated back to its previous size.
+func appendFile(path string, compression Compression, data []byte) error {
+	encoded, err := compression.compress(data)
+	if err != nil {
+		return fmt.Errorf("failed to compress %s: %v", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(encoded, info.Size()); err != nil {
+		file.Truncate(info.Size())
+		return err
+	}
+	return file.Sync()
+}
+
+// repairCompressed rewrites a compressed file whose last member was cut short
+// by an interrupted write, keeping every complete line. Appending after such
+// a member would make the rest of the file unreadable, so the stores call it
+// before their first append to a file. It reports whether the file was repaired.
+func repairCompressed(path string) (bool, error) {
+	if compressionOf(path) == CompressionNone {
+		return false, nil
+	}
+	data, truncated, err := readFile(path)
+	if os.IsNotExist(err) || (err == nil && !truncated) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+	if len(data) == 0 {
+		return true, os.Remove(path)
+	}
+	if err := writeFileAtomic(path, compressionOf(path), data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeFileAtomic replaces path with data, compressed according to the
+// codec, through a synced temporary file and a rename.
+func writeFileAtomic(path string, compression Compression, data []byte) error {
+	encoded, err := compression.compress(data)
+	if err != nil {
+		return fmt.Errorf("failed to compress %s: %v", path, err)
+	}
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(encoded)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// removeOtherFiles deletes the files of a series that use a different
+// compression than keep, after their candles were rewritten into keep.
+func removeOtherFiles(files []string, keep string) error {
+	for _, f := range files {
+		if f == keep {
+			continue
+		}
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testLines returns n lines that compress poorly, so that a member spans
+// several deflate blocks or zstd blocks and a cut member still decodes in part.
+func testLines(seed int64, n int) []byte {
+	rng := rand.New(rand.NewSource(seed))
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "%d,%016x,%016x\n", i, rng.Uint64(), rng.Uint64())
+	}
+	return buf.Bytes()
+}
+
+func TestCompressedMembers(t *testing.T) {
+	first, second := testLines(1, 10), testLines(2, 20000)
+	for _, compression := range []Compression{CompressionGzip, CompressionZstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "SBIN.jsonl"+compression.Ext())
+			if err := appendFile(path, compression, first); err != nil {
+				t.Fatal(err)
+			}
+			if err := appendFile(path, compression, second); err != nil {
+				t.Fatal(err)
+			}
+
+			data, truncated, err := readFile(path)
+			if err != nil || truncated {
+				t.Fatalf("readFile = truncated %v, %v", truncated, err)
+			}
+			if want := append(append([]byte(nil), first...), second...); !bytes.Equal(data, want) {
+				t.Fatalf("readFile returned %d bytes, want both members (%d bytes)", len(data), len(want))
+			}
+			if repaired, err := repairCompressed(path); err != nil || repaired {
+				t.Errorf("repairCompressed of an intact file = %v, %v", repaired, err)
+			}
+		})
+	}
+}
+
+func TestTruncatedMember(t *testing.T) {
+	first, second := testLines(1, 10), testLines(2, 20000)
+	full := append(append([]byte(nil), first...), second...)
+
+	tests := []struct {
+		name    string
+		cut     func(firstSize, fullSize int64) int64 // Size to cut the file to
+		partial bool                                  // Whether lines of the cut member survive
+	}{
+		{"in the header of the second member", func(firstSize, fullSize int64) int64 { return firstSize + 5 }, false},
+		{"in the middle of the second member", func(firstSize, fullSize int64) int64 { return (firstSize + fullSize) / 2 }, true},
+		{"in the first member", func(firstSize, fullSize int64) int64 { return firstSize / 2 }, false},
+	}
+	for _, compression := range []Compression{CompressionGzip, CompressionZstd} {
+		for _, tt := range tests {
+			t.Run(string(compression)+" "+tt.name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "SBIN.jsonl"+compression.Ext())
+				if err := appendFile(path, compression, first); err != nil {
+					t.Fatal(err)
+				}
+				info, _ := os.Stat(path)
+				firstSize := info.Size()
+				if err := appendFile(path, compression, second); err != nil {
+					t.Fatal(err)
+				}
+				info, _ = os.Stat(path)
+				cut := tt.cut(firstSize, info.Size())
+				if err := os.Truncate(path, cut); err != nil {
+					t.Fatal(err)
+				}
+
+				data, truncated, err := readFile(path)
+				if err != nil {
+					t.Fatalf("readFile: %v", err)
+				}
+				if !truncated {
+					t.Fatal("readFile did not report the cut member")
+				}
+				if !bytes.HasPrefix(full, data) {
+					t.Fatalf("readFile returned %d bytes that are not a prefix of the written data", len(data))
+				}
+				complete := data[:bytes.LastIndexByte(data, '\n')+1]
+				switch {
+				case cut < firstSize && len(complete) != 0:
+					// A first member cut short may not decode at all; if it
+					// does, its lines are a prefix of first
+					if !bytes.HasPrefix(first, complete) {
+						t.Errorf("kept lines %q are not lines of the first member", complete)
+					}
+				case cut >= firstSize && !bytes.HasPrefix(complete, first):
+					t.Errorf("lost lines of the intact first member: kept %d bytes", len(complete))
+				case tt.partial && len(complete) <= len(first):
+					t.Errorf("kept no line of the cut member: kept %d bytes", len(complete))
+				}
+
+				// Streaming readers see the same complete lines
+				file, err := openFile(path)
+				if err != nil {
+					t.Fatalf("openFile: %v", err)
+				}
+				lines := newCompleteLines(file)
+				streamed, err := io.ReadAll(lines)
+				file.Close()
+				if err != nil || !lines.truncated || !bytes.Equal(streamed, complete) {
+					t.Errorf("streamed %d bytes, truncated %v, %v; want the %d bytes of complete lines, truncated",
+						len(streamed), lines.truncated, err, len(complete))
+				}
+
+				repaired, err := repairCompressed(path)
+				if err != nil || !repaired {
+					t.Fatalf("repairCompressed = %v, %v, want a repair", repaired, err)
+				}
+				if len(complete) == 0 {
+					if _, err := os.Stat(path); !os.IsNotExist(err) {
+						t.Errorf("file without a complete line was kept: %v", err)
+					}
+					return
+				}
+				after, truncated, err := readFile(path)
+				if err != nil || truncated {
+					t.Fatalf("readFile after repair = truncated %v, %v", truncated, err)
+				}
+				if !bytes.Equal(after, complete) {
+					t.Errorf("repaired file holds %d bytes, want the %d bytes of complete lines", len(after), len(complete))
+				}
+
+				// The next member appends cleanly after the repair
+				if err := appendFile(path, compression, first); err != nil {
+					t.Fatal(err)
+				}
+				after, truncated, err = readFile(path)
+				if err != nil || truncated || !bytes.Equal(after, append(complete, first...)) {
+					t.Errorf("append after repair: %d bytes, truncated %v, %v", len(after), truncated, err)
+				}
+			})
+		}
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Compression
+		ok    bool
+	}{
+		{"", CompressionNone, true},
+		{"none", CompressionNone, true},
+		{"gzip", CompressionGzip, true},
+		{"gz", CompressionGzip, true},
+		{" ZSTD ", CompressionZstd, true},
+		{"zst", CompressionZstd, true},
+		{"lz4", CompressionNone, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseCompression(tt.value)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseCompression(%q) = %q, %v", tt.value, got, err)
+		}
+	}
+}
@@ -1,60 +1,195 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
 
 	kiteconnect "github.com/zerodha/gokiteconnect/v4"
 )
 
-// CSVStore provides a storage interface for CSV files (one file per instrument).
+// CSVStore provides a storage interface for CSV files (one file per instrument
+// and interval, laid out by the path template recorded in _metadata.json, or
+// DefaultPathTemplate).
+//
+// With compression, files are named SYMBOL.csv.gz or SYMBOL.csv.zst and every
+// write appends one compressed member. Files of any compression are read.
+//
+// Timestamps are written without an offset, as wall time of the storage
+// timezone recorded in _metadata.json. Directories of earlier releases,
+// which have no record, hold IST wall time.
+//
+// Every file has an oi column after volume. Files written by a fetch run have
+// fetched_at, run_id and is_complete columns too; a file of an earlier release
+// is rewritten with the columns it lacks the first time candles are appended
+// to it. The runs are recorded in _fetch_runs.jsonl.
 type CSVStore struct {
-	basePath string
-	logger   *log.Logger
+	basePath     string
+	compression  Compression
+	pathTemplate string
+	layout       *fileLayout
+	timezone     Timezone
+	zone         Timezone
+	lineage      lineage
+	logger       *log.Logger
+	checked      map[string]bool
+	withLineage  map[string]bool // Files known to have the lineage columns
+}
+
+// NewCSVStore creates a new CSV store writing files with the compression,
+// path template and timezone of opts.
+func NewCSVStore(basePath string, opts Options, logger *log.Logger) (*CSVStore, error) {
+	if _, err := newFileLayout(opts.PathTemplate, ".csv"); err != nil {
+		return nil, err
+	}
+	return &CSVStore{basePath: basePath, compression: opts.Compression, pathTemplate: opts.PathTemplate,
+		timezone: opts.Timezone, lineage: lineage{runID: opts.RunID}, logger: logger,
+		checked: make(map[string]bool), withLineage: make(map[string]bool)}, nil
 }
 
-// NewCSVStore creates a new CSV store.
-func NewCSVStore(basePath string, logger *log.Logger) (*CSVStore, error) {
-	return &CSVStore{basePath: basePath, logger: logger}, nil
+func init() {
+	Register(Backend{
+		Name: StorageTypeCSV,
+		New:  constructor(NewCSVStore),
+		Schema: Schema{
+			DefaultPath:  "data/csv",
+			Directory:    true,
+			Compression:  true,
+			PathTemplate: true,
+			Timezones:    []Timezone{TimezoneUTC, TimezoneIST},
+		},
+		Description: Description{
+			Title:   "📊 CSV",
+			BestFor: "Excel compatibility, data analysis tools",
+			Format:  "One CSV file per instrument and interval (" + DefaultPathTemplate + ".csv)",
+			Pros:    "Excel/spreadsheet compatible, widely supported",
+			Cons:    "No data types, larger files, manual schema",
+		},
+	})
 }
 
-// Init initializes the storage directory.
+// Init initializes the storage directory and its layout and timezone records.
 func (s *CSVStore) Init() error {
 	if err := os.MkdirAll(s.basePath, 0755); err != nil {
 		return fmt.Errorf("failed to create CSV storage directory: %v", err)
 	}
-	s.logger.Printf("✅ CSV storage directory ready: %s", s.basePath)
+	hasData := func() (bool, error) {
+		series, err := s.ListSeries()
+		return len(series) > 0, err
+	}
+	layout, err := initFileLayout(s.basePath, s.pathTemplate, ".csv", hasData)
+	if err != nil {
+		return err
+	}
+	s.layout = layout
+	zone, err := initFileTimezone(s.basePath, s.timezone, TimezoneIST, hasData)
+	if err != nil {
+		return err
+	}
+	s.zone = zone
+	s.logger.Printf("✅ CSV storage directory ready: %s (%s, timestamps in %s)", s.basePath, s.layout.template, s.zone)
 	return nil
 }
 
+// pathLayout returns the layout of the store's files.
+func (s *CSVStore) pathLayout() (*fileLayout, error) {
+	if s.layout != nil {
+		return s.layout, nil
+	}
+	layout, err := fileStoreLayout(s.basePath, ".csv")
+	if err != nil {
+		return nil, err
+	}
+	s.layout = layout
+	return layout, nil
+}
+
 // StoreCandles stores candles to a CSV file for the specific instrument.
-func (s *CSVStore) StoreCandles(instrumentSymbol string, candles []kiteconnect.HistoricalData) (int, error) {
-	fileName := fmt.Sprintf("%s.csv", instrumentSymbol)
-	filePath := filepath.Join(s.basePath, fileName)
+func (s *CSVStore) StoreCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, true))
+}
+
+// StoreIncompleteCandles appends candles still forming, flagged
+// is_complete=false. A later row of the same timestamp replaces them.
+func (s *CSVStore) StoreIncompleteCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, false))
+}
+
+// StoreLineageCandles appends candles keeping their lineage.
+func (s *CSVStore) StoreLineageCandles(series Series, candles []Candle) (int, error) {
+	return s.storeCandles(series, candles)
+}
+
+// storeCandles appends candles to the files of the periods they fall in.
+func (s *CSVStore) storeCandles(series Series, candles []Candle) (int, error) {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return 0, err
+	}
+	if err := layout.checkSeries(series); err != nil {
+		return 0, err
+	}
+	periods, groups := splitByPeriod(layout, candles, func(c Candle) time.Time { return c.Timestamp })
+	var inserted int
+	for _, period := range periods {
+		n, err := s.appendCandles(series, layout.path(s.basePath, series, period)+s.compression.Ext(), groups[period])
+		inserted += n
+		if err != nil {
+			return inserted, err
+		}
+	}
+	return inserted, nil
+}
+
+// appendCandles appends candles of a series to one of its files.
+func (s *CSVStore) appendCandles(series Series, filePath string, candles []Candle) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create CSV directory: %v", err)
+	}
+
+	if !s.checked[filePath] {
+		repaired, err := repairCompressed(filePath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check %s: %v", filePath, err)
+		}
+		if repaired {
+			s.logger.Printf("⚠️  Dropped a partial compressed member at the end of %s", filePath)
+		}
+		if err := s.checkColumns(series, filePath); err != nil {
+			return 0, err
+		}
+		s.checked[filePath] = true
+	}
+	if hasLineage(candles) && !s.withLineage[filePath] {
+		if err := s.rewriteColumns(series, filePath, true); err != nil {
+			return 0, err
+		}
+	}
+	withLineage := s.withLineage[filePath]
 
 	// Check if file exists to determine if we need headers
 	fileExists := false
-	if _, err := os.Stat(filePath); err == nil {
+	if info, err := os.Stat(filePath); err == nil && info.Size() > 0 {
 		fileExists = true
 	}
 
-	// Open file for appending
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return 0, fmt.Errorf("failed to open CSV file: %v", err)
-	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	// Rows are collected first and appended in one write (one compressed member)
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
 
 	// Write header if this is a new file
 	if !fileExists {
-		header := []string{"instrument", "timestamp", "open", "high", "low", "close", "volume"}
+		header := csvHeader(withLineage)
 		if err := writer.Write(header); err != nil {
 			return 0, fmt.Errorf("failed to write CSV header: %v", err)
 		}
@@ -63,27 +198,407 @@ func (s *CSVStore) StoreCandles(instrumentSymbol string, candles []kiteconnect.H
 	// Write candle data
 	var inserted int
 	for _, c := range candles {
-		record := []string{
-			instrumentSymbol,
-			c.Date.Time.Format("2006-01-02 15:04:05"),
-			strconv.FormatFloat(c.Open, 'f', -1, 64),
-			strconv.FormatFloat(c.High, 'f', -1, 64),
-			strconv.FormatFloat(c.Low, 'f', -1, 64),
-			strconv.FormatFloat(c.Close, 'f', -1, 64),
-			strconv.FormatInt(int64(c.Volume), 10),
-		}
-
-		if err := writer.Write(record); err != nil {
+		if err := writer.Write(csvRecord(series, c, s.zone, withLineage)); err != nil {
 			s.logger.Printf("      \\_ CSV write error: %v, for candle %+v", err, c)
 		} else {
 			inserted++
 		}
 	}
 
-	s.logger.Printf("📄 Stored %d candles to %s", len(candles), fileName)
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return 0, fmt.Errorf("failed to encode CSV rows: %v", err)
+	}
+	if err := appendFile(filePath, s.compression, buf.Bytes()); err != nil {
+		return 0, fmt.Errorf("failed to write CSV file: %v", err)
+	}
+
+	s.logger.Printf("📄 Stored %d candles to %s", len(candles), filePath)
 	return inserted, nil
 }
 
+// csvRecord returns the row of a candle, timestamps in zone.
+func csvRecord(series Series, c Candle, zone Timezone, withLineage bool) []string {
+	record := []string{
+		series.Symbol,
+		c.Timestamp.In(zone.Location()).Format(csvTimestampLayout),
+		strconv.FormatFloat(c.Open, 'f', -1, 64),
+		strconv.FormatFloat(c.High, 'f', -1, 64),
+		strconv.FormatFloat(c.Low, 'f', -1, 64),
+		strconv.FormatFloat(c.Close, 'f', -1, 64),
+		strconv.FormatInt(c.Volume, 10),
+		strconv.FormatInt(c.OI, 10),
+	}
+	if withLineage {
+		record = append(record, formatCSVFetchedAt(c.FetchedAt, zone), c.RunID, formatCSVIsComplete(storedIsComplete(c)))
+	}
+	return record
+}
+
+// csvTimestampLayout is the format of CSV timestamps, in the storage timezone.
+const csvTimestampLayout = "2006-01-02 15:04:05"
+
+// csvHeader returns the header row of a CSV file, with or without the
+// lineage columns.
+func csvHeader(withLineage bool) []string {
+	header := []string{"instrument", "timestamp", "open", "high", "low", "close", "volume", "oi"}
+	if withLineage {
+		header = append(header, "fetched_at", "run_id", "is_complete")
+	}
+	return header
+}
+
+// checkColumns finds whether a file has the lineage columns before the first
+// append to it. Files of earlier releases, without oi or with only fetched_at
+// and run_id of the lineage columns, are rewritten with the current columns.
+func (s *CSVStore) checkColumns(series Series, filePath string) error {
+	header, err := readFirstLine(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read CSV header of %s: %v", filePath, err)
+	}
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+	columns := strings.Split(strings.TrimSpace(header), ",")
+	withLineage := slices.Contains(columns, "fetched_at")
+	if !slices.Contains(columns, "oi") || withLineage && !slices.Contains(columns, "is_complete") {
+		return s.rewriteColumns(series, filePath, withLineage)
+	}
+	s.withLineage[filePath] = withLineage
+	return nil
+}
+
+// rewriteColumns rewrites the files of a series with the current columns,
+// with or without the lineage columns, left empty for rows without lineage.
+// A new file gets them with its header.
+func (s *CSVStore) rewriteColumns(series Series, filePath string, withLineage bool) error {
+	if info, err := os.Stat(filePath); err == nil && info.Size() > 0 {
+		candles, err := s.load(series)
+		if err != nil {
+			return err
+		}
+		if err := s.writeSeries(series, candles, withLineage); err != nil {
+			return fmt.Errorf("failed to add columns to %s: %v", filePath, err)
+		}
+		s.logger.Printf("🔧 Rewrote %s with the columns %s", filePath, strings.Join(csvHeader(withLineage), ","))
+	}
+	s.withLineage[filePath] = withLineage
+	return nil
+}
+
+// formatCSVFetchedAt formats a fetched_at time as wall time of zone, or empty.
+func formatCSVFetchedAt(t time.Time, zone Timezone) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(zone.Location()).Format(csvTimestampLayout)
+}
+
+// formatCSVIsComplete formats an is_complete value, empty when absent.
+func formatCSVIsComplete(complete *bool) string {
+	if complete == nil {
+		return ""
+	}
+	return strconv.FormatBool(*complete)
+}
+
+// StoredTimezone returns the timezone of the stored timestamps.
+func (s *CSVStore) StoredTimezone() (Timezone, error) {
+	if s.zone != "" {
+		return s.zone, nil
+	}
+	zone, err := fileStoreTimezone(s.basePath, TimezoneIST)
+	if err != nil {
+		return "", err
+	}
+	s.zone = zone
+	return zone, nil
+}
+
+// ConvertTimezone rewrites the timestamps of every file as wall time of another
+// timezone and records it. Files are replaced only once all are converted.
+func (s *CSVStore) ConvertTimezone(to Timezone) error {
+	from, err := s.StoredTimezone()
+	if err != nil {
+		return err
+	}
+	files, err := convertFiles(s.basePath, ".csv", to, func(data []byte) ([]byte, error) {
+		return convertCSVTimestamps(data, from, to)
+	})
+	if err != nil {
+		return err
+	}
+	s.zone = to
+	s.logger.Printf("🕒 Converted %d CSV file(s) from %s to %s", files, from, to)
+	return nil
+}
+
+// convertCSVTimestamps rewrites the timestamp column of a CSV file from the
+// wall time of one timezone to another.
+func convertCSVTimestamps(data []byte, from, to Timezone) ([]byte, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return data, nil
+	}
+	column, fetchedColumn := -1, -1
+	for i, name := range records[0] {
+		switch name {
+		case "timestamp":
+			column = i
+		case "fetched_at":
+			fetchedColumn = i
+		}
+	}
+	if column < 0 {
+		return nil, fmt.Errorf("missing column %q", "timestamp")
+	}
+	for line, record := range records[1:] {
+		t, err := time.ParseInLocation(csvTimestampLayout, record[column], from.Location())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp: %v", line+2, err)
+		}
+		record[column] = t.In(to.Location()).Format(csvTimestampLayout)
+		if fetchedColumn >= 0 && record[fetchedColumn] != "" {
+			t, err := time.ParseInLocation(csvTimestampLayout, record[fetchedColumn], from.Location())
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid fetched_at: %v", line+2, err)
+			}
+			record[fetchedColumn] = t.In(to.Location()).Format(csvTimestampLayout)
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ListSeries lists the stored instrument/interval combinations.
+func (s *CSVStore) ListSeries() ([]Series, error) {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return nil, err
+	}
+	return layout.list(s.basePath)
+}
+
+// SeriesFiles returns the CSV files of a series, of every period and in any
+// compression.
+func (s *CSVStore) SeriesFiles(series Series) ([]string, error) {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return nil, err
+	}
+	return layout.paths(s.basePath, series)
+}
+
+// Coverage reports the first and last timestamp and the row count of a series.
+func (s *CSVStore) Coverage(series Series) (Coverage, error) {
+	candles, err := s.load(series)
+	if err != nil {
+		return Coverage{Series: series}, err
+	}
+	return coverageOf(series, candles), nil
+}
+
+// ReadRange streams the candles of a series in timestamp order.
+func (s *CSVStore) ReadRange(series Series, from, to time.Time, fn func(Candle) error) error {
+	candles, err := s.loadRange(series, from, to)
+	if err != nil {
+		return err
+	}
+	return streamCandles(candles, from, to, fn)
+}
+
+// load reads all candles of a series from its files of every period and compression.
+func (s *CSVStore) load(series Series) ([]Candle, error) {
+	return s.loadRange(series, time.Time{}, time.Time{})
+}
+
+// loadRange reads the candles of a series within [from, to]. Rows are parsed
+// as they are read and only those in range are kept, so a short range of a
+// long series does not load the whole series.
+func (s *CSVStore) loadRange(series Series, from, to time.Time) ([]Candle, error) {
+	zone, err := s.StoredTimezone()
+	if err != nil {
+		return nil, err
+	}
+	layout, err := s.pathLayout()
+	if err != nil {
+		return nil, err
+	}
+	files, err := layout.rangePaths(s.basePath, series, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find CSV files: %v", err)
+	}
+	var candles []Candle
+	for _, filePath := range files {
+		err := s.scanFile(filePath, zone, func(c Candle) {
+			if inRange(c.Timestamp, from, to) {
+				candles = append(candles, c)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return candles, nil
+}
+
+// scanFile passes the candles of one CSV file to fn as they are read,
+// locating columns by the header row. A partial last row left by an
+// interrupted write is ignored.
+func (s *CSVStore) scanFile(filePath string, zone Timezone, fn func(Candle)) error {
+	file, err := openFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read CSV file: %v", err)
+	}
+	defer file.Close()
+	lines := newCompleteLines(file)
+
+	reader := csv.NewReader(lines)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header of %s: %v", filePath, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"timestamp", "open", "high", "low", "close", "volume"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("%s: missing column %q", filePath, name)
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", filePath, err)
+		}
+		c, err := parseCSVCandle(record, columns, zone)
+		if err != nil {
+			return fmt.Errorf("%s line %d: %v", filePath, line, err)
+		}
+		fn(c)
+	}
+	if lines.truncated {
+		s.logger.Printf("⚠️  Ignoring partial last row of %s", filePath)
+	}
+	return nil
+}
+
+func parseCSVCandle(record []string, columns map[string]int, zone Timezone) (Candle, error) {
+	var c Candle
+	var err error
+	if c.Timestamp, err = time.ParseInLocation(csvTimestampLayout, record[columns["timestamp"]], zone.Location()); err != nil {
+		return c, fmt.Errorf("invalid timestamp: %v", err)
+	}
+	c.Timestamp = c.Timestamp.In(calendar.IST)
+	prices := []*float64{&c.Open, &c.High, &c.Low, &c.Close}
+	for i, name := range []string{"open", "high", "low", "close"} {
+		if *prices[i], err = strconv.ParseFloat(record[columns[name]], 64); err != nil {
+			return c, fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	if c.Volume, err = strconv.ParseInt(record[columns["volume"]], 10, 64); err != nil {
+		return c, fmt.Errorf("invalid volume: %v", err)
+	}
+	if i, ok := columns["oi"]; ok && record[i] != "" {
+		if c.OI, err = strconv.ParseInt(record[i], 10, 64); err != nil {
+			return c, fmt.Errorf("invalid oi: %v", err)
+		}
+	}
+	if i, ok := columns["fetched_at"]; ok && record[i] != "" {
+		if c.FetchedAt, err = time.ParseInLocation(csvTimestampLayout, record[i], zone.Location()); err != nil {
+			return c, fmt.Errorf("invalid fetched_at: %v", err)
+		}
+		c.FetchedAt = c.FetchedAt.In(calendar.IST)
+	}
+	if i, ok := columns["run_id"]; ok {
+		c.RunID = record[i]
+	}
+	if i, ok := columns["is_complete"]; ok && record[i] != "" {
+		complete, err := strconv.ParseBool(record[i])
+		if err != nil {
+			return c, fmt.Errorf("invalid is_complete: %v", err)
+		}
+		c.Incomplete = !complete
+	}
+	return c, nil
+}
+
+// rewriteSeries replaces the files of a series by one file per period holding candles,
+// with the lineage columns if the store has a run or any candle has lineage.
+func (s *CSVStore) rewriteSeries(series Series, candles []Candle) error {
+	return s.writeSeries(series, candles, s.lineage.runID != "" || hasLineage(candles))
+}
+
+// writeSeries replaces the files of a series by one file per period holding candles.
+func (s *CSVStore) writeSeries(series Series, candles []Candle, withLineage bool) error {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return err
+	}
+	zone, err := s.StoredTimezone()
+	if err != nil {
+		return err
+	}
+	data := make(map[string][]byte)
+	periods, groups := splitByPeriod(layout, candles, func(c Candle) time.Time { return c.Timestamp })
+	for _, period := range periods {
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		writer.Write(csvHeader(withLineage))
+		for _, c := range groups[period] {
+			writer.Write(csvRecord(series, c, zone, withLineage))
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("failed to encode CSV rows: %v", err)
+		}
+		data[period] = buf.Bytes()
+	}
+	return layout.replace(s.basePath, series, s.compression, data)
+}
+
+// Dedupe keeps the most recently fetched candle of every timestamp of a series.
+func (s *CSVStore) Dedupe(series Series, dryRun bool) (int64, error) {
+	return dedupeFiles(s, series, dryRun)
+}
+
+// DeleteRange removes the candles of a series with from <= timestamp <= to.
+func (s *CSVStore) DeleteRange(series Series, from, to time.Time, dryRun bool) (int64, error) {
+	return deleteFromFiles(s, series, from, to, dryRun)
+}
+
+// Vacuum rewrites every file sorted by timestamp, dropping partial last rows.
+func (s *CSVStore) Vacuum(dryRun bool) (int64, error) {
+	return vacuumFiles(s, dryRun)
+}
+
+// RecordRun appends a fetch run to the _fetch_runs.jsonl manifest.
+func (s *CSVStore) RecordRun(run FetchRun) error {
+	return recordFileRun(s.basePath, run)
+}
+
+// FetchRuns returns the fetch runs recorded in the manifest, oldest first.
+func (s *CSVStore) FetchRuns() ([]FetchRun, error) {
+	return fileRuns(s.basePath)
+}
+
 // Close cleanup resources (no-op for CSV).
 func (s *CSVStore) Close() error {
 	return nil
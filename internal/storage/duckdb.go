@@ -1,27 +1,85 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log"
+	"time"
 
-	_ "github.com/marcboeker/go-duckdb"
+	"zerodha-connect/internal/calendar"
+
+	"github.com/marcboeker/go-duckdb"
 	kiteconnect "github.com/zerodha/gokiteconnect/v4"
 )
 
+// DefaultDuckDBFlushRows is the number of staged rows after which they are
+// merged into the ohlcv table when no flush size is configured.
+const DefaultDuckDBFlushRows = 100000
+
+// duckDBColumns are the ohlcv columns, in the order the appender writes them.
+const duckDBColumns = `instrument, open, high, low, close, timestamp, volume, exchange, "interval", fetched_at, run_id, is_complete, oi`
+
 // DuckDBStore provides a storage interface for DuckDB.
+//
+// Candles are bulk loaded with DuckDB's Appender into the ohlcv_staging
+// table and merged into ohlcv once flushRows rows are staged, when the data
+// is read back and on Close. The merge replaces stored candles of the same
+// series and timestamp, so refetching a range does not duplicate it. Staged
+// rows left behind by an interrupted run are merged by the next Init.
+//
+// Timestamps are naive TIMESTAMPs holding the wall time of the storage
+// timezone recorded in storage_metadata. Databases of earlier releases,
+// which have no record, hold UTC wall time. fetched_at is a naive TIMESTAMP
+// in UTC, and run_id refers to fetch_runs. is_complete is false for candles
+// still forming when fetched, and NULL for candles of earlier releases. oi
+// is the open interest of candles fetched with it, 0 otherwise, and NULL for
+// candles of earlier releases.
 type DuckDBStore struct {
-	db     *sql.DB
-	logger *log.Logger
+	db        *sql.DB
+	path      string
+	timezone  Timezone
+	zone      Timezone
+	lineage   lineage
+	columns   map[string]bool // Optional ohlcv columns known to be present or absent
+	logger    *log.Logger
+	flushRows int
+	staged    int
 }
 
-// NewDuckDBStore creates a new DuckDB store.
-func NewDuckDBStore(path string, logger *log.Logger) (*DuckDBStore, error) {
+// NewDuckDBStore creates a new DuckDB store. opts.FlushRows sets how many rows
+// are staged before a merge; 0 uses DefaultDuckDBFlushRows.
+func NewDuckDBStore(path string, opts Options, logger *log.Logger) (*DuckDBStore, error) {
 	db, err := sql.Open("duckdb", path)
 	if err != nil {
 		return nil, fmt.Errorf("duckdb connection failed: %v", err)
 	}
-	return &DuckDBStore{db: db, logger: logger}, nil
+	flushRows := opts.FlushRows
+	if flushRows <= 0 {
+		flushRows = DefaultDuckDBFlushRows
+	}
+	return &DuckDBStore{db: db, path: path, timezone: opts.Timezone, lineage: lineage{runID: opts.RunID},
+		columns: make(map[string]bool), logger: logger, flushRows: flushRows}, nil
+}
+
+func init() {
+	Register(Backend{
+		Name: StorageTypeDuckDB,
+		New:  constructor(NewDuckDBStore),
+		Schema: Schema{
+			DefaultPath: "market_data.duckdb",
+			FlushRows:   true,
+			Timezones:   []Timezone{TimezoneUTC, TimezoneIST},
+		},
+		Description: Description{
+			Title:   "🚀 DuckDB",
+			BestFor: "Analytical queries, time series analysis",
+			Format:  "Single database file (.duckdb)",
+			Pros:    "Fast aggregations, SQL queries, columnar storage, bulk loading",
+			Cons:    "Requires DuckDB to query",
+		},
+	})
 }
 
 // Init initializes the database schema.
@@ -34,55 +92,419 @@ func (s *DuckDBStore) Init() error {
 		low DOUBLE,
 		close DOUBLE,
 		timestamp TIMESTAMP,
-		volume BIGINT
+		volume BIGINT,
+		exchange VARCHAR,
+		"interval" VARCHAR,
+		fetched_at TIMESTAMP,
+		run_id VARCHAR,
+		is_complete BOOLEAN,
+		oi BIGINT
 	);`
 	if _, err := s.db.Exec(createTable); err != nil {
 		return fmt.Errorf("failed to create DuckDB table: %v", err)
 	}
-	s.logger.Println("✅ DuckDB table 'ohlcv' is ready.")
+	// Tables created by earlier releases lack the series, lineage, completeness and oi columns
+	for _, column := range []string{"exchange VARCHAR", `"interval" VARCHAR`, "fetched_at TIMESTAMP", "run_id VARCHAR", "is_complete BOOLEAN", "oi BIGINT"} {
+		if _, err := s.db.Exec("ALTER TABLE ohlcv ADD COLUMN IF NOT EXISTS " + column); err != nil {
+			return fmt.Errorf("failed to add column %s: %v", column, err)
+		}
+	}
+	createStaging := `
+	CREATE TABLE IF NOT EXISTS ohlcv_staging (
+		instrument VARCHAR,
+		open DOUBLE,
+		high DOUBLE,
+		low DOUBLE,
+		close DOUBLE,
+		timestamp TIMESTAMP,
+		volume BIGINT,
+		exchange VARCHAR,
+		"interval" VARCHAR,
+		fetched_at TIMESTAMP,
+		run_id VARCHAR,
+		is_complete BOOLEAN,
+		oi BIGINT
+	);`
+	if _, err := s.db.Exec(createStaging); err != nil {
+		return fmt.Errorf("failed to create DuckDB staging table: %v", err)
+	}
+	// Staged rows left by an earlier release are merged with NULL lineage and oi
+	for _, column := range []string{"fetched_at TIMESTAMP", "run_id VARCHAR", "is_complete BOOLEAN", "oi BIGINT"} {
+		if _, err := s.db.Exec("ALTER TABLE ohlcv_staging ADD COLUMN IF NOT EXISTS " + column); err != nil {
+			return fmt.Errorf("failed to add staging column %s: %v", column, err)
+		}
+	}
+	for _, column := range []string{"exchange", "fetched_at", "is_complete", "oi"} {
+		s.columns[column] = true
+	}
+	if err := createRunTables(s.db); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(createSQLMetadata); err != nil {
+		return fmt.Errorf("failed to create DuckDB storage_metadata table: %v", err)
+	}
+	zone, err := initSQLTimezone(s.db, s.path, s.timezone, TimezoneUTC)
+	if err != nil {
+		return err
+	}
+	s.zone = zone
+
+	// Recover rows staged by a run that did not get to merge them
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM ohlcv_staging").Scan(&s.staged); err != nil {
+		return fmt.Errorf("failed to read DuckDB staging table: %v", err)
+	}
+	if s.staged > 0 {
+		s.logger.Printf("⚠️  Merging %d rows staged by an earlier run", s.staged)
+		if err := s.Flush(); err != nil {
+			return err
+		}
+	}
+	s.logger.Printf("✅ DuckDB table 'ohlcv' is ready (timestamps in %s).", s.zone)
 	return nil
 }
 
-// StoreCandles inserts a slice of candles into the database.
-func (s *DuckDBStore) StoreCandles(instrumentSymbol string, candles []kiteconnect.HistoricalData) (int, error) {
+// StoreCandles appends candles to the staging table, merging the staged rows
+// into ohlcv once the flush size is reached. The candles are stamped with the
+// time of the write and the run ID of the store, if any.
+func (s *DuckDBStore) StoreCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, true))
+}
+
+// StoreIncompleteCandles appends candles still forming, flagged
+// is_complete=false, to be replaced by the next write of their timestamps.
+func (s *DuckDBStore) StoreIncompleteCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, false))
+}
+
+// StoreLineageCandles appends candles keeping their lineage.
+func (s *DuckDBStore) StoreLineageCandles(series Series, candles []Candle) (int, error) {
+	return s.storeCandles(series, candles)
+}
+
+func (s *DuckDBStore) storeCandles(series Series, candles []Candle) (int, error) {
+	if len(candles) == 0 {
+		return 0, nil
+	}
+
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("duckdb connection failed: %v", err)
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		appender, err := duckdb.NewAppenderFromConn(driverConn.(driver.Conn), "", "ohlcv_staging")
+		if err != nil {
+			return err
+		}
+		for _, c := range candles {
+			var fetchedAt, runID interface{}
+			if !c.FetchedAt.IsZero() {
+				fetchedAt = c.FetchedAt.UTC()
+			}
+			if c.RunID != "" {
+				runID = c.RunID
+			}
+			err := appender.AppendRow(
+				series.Symbol,
+				c.Open,
+				c.High,
+				c.Low,
+				c.Close,
+				wallClock(c.Timestamp, s.zone),
+				c.Volume,
+				series.Exchange,
+				series.Interval,
+				fetchedAt,
+				runID,
+				!c.Incomplete,
+				c.OI,
+			)
+			if err != nil {
+				appender.Close()
+				return fmt.Errorf("candle %+v: %v", c, err)
+			}
+		}
+		// Closing flushes the rows into the staging table
+		return appender.Close()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("DuckDB append error: %v", err)
+	}
+
+	s.staged += len(candles)
+	if s.staged >= s.flushRows {
+		if err := s.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(candles), nil
+}
+
+// Flush merges the staged rows into ohlcv in one transaction. A staged
+// candle replaces a stored candle of the same series and timestamp, and of
+// candles staged more than once the last one is kept.
+func (s *DuckDBStore) Flush() error {
+	if s.staged == 0 {
+		return nil
+	}
+	start := time.Now()
+
 	tx, err := s.db.Begin()
 	if err != nil {
-		return 0, fmt.Errorf("DB transaction error: %v", err)
+		return fmt.Errorf("DB transaction error: %v", err)
 	}
 	defer tx.Rollback() // Rollback on error
 
-	stmt, err := tx.Prepare("INSERT INTO ohlcv VALUES (?,?,?,?,?,?,?)")
+	deleteStored := `
+	DELETE FROM ohlcv USING (
+		SELECT DISTINCT instrument, exchange, "interval", timestamp FROM ohlcv_staging
+	) AS staged
+	WHERE ohlcv.instrument = staged.instrument
+		AND COALESCE(ohlcv.exchange, '') = COALESCE(staged.exchange, '')
+		AND COALESCE(ohlcv."interval", '') = COALESCE(staged."interval", '')
+		AND ohlcv.timestamp = staged.timestamp`
+	if _, err := tx.Exec(deleteStored); err != nil {
+		return fmt.Errorf("failed to replace stored candles: %v", err)
+	}
+	insertStaged := `
+	INSERT INTO ohlcv (` + duckDBColumns + `)
+	SELECT ` + duckDBColumns + ` FROM (
+		SELECT *, row_number() OVER (
+			PARTITION BY instrument, exchange, "interval", timestamp ORDER BY rowid DESC
+		) AS rn
+		FROM ohlcv_staging
+	)
+	WHERE rn = 1`
+	result, err := tx.Exec(insertStaged)
 	if err != nil {
-		return 0, fmt.Errorf("DB prepare error: %v", err)
+		return fmt.Errorf("failed to merge staged candles: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM ohlcv_staging"); err != nil {
+		return fmt.Errorf("failed to clear staging table: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit error: %v", err)
 	}
-	defer stmt.Close()
 
-	var inserted int
-	for _, c := range candles {
-		_, err := stmt.Exec(
-			instrumentSymbol,
-			c.Open,
-			c.High,
-			c.Low,
-			c.Close,
-			c.Date.Time,
-			c.Volume,
-		)
-		if err != nil {
-			// Log individual insert error but continue trying to insert others
-			s.logger.Printf("      \\_ Insert error: %v, for candle %+v", err, c)
-		} else {
-			inserted++
+	merged, _ := result.RowsAffected()
+	s.logger.Printf("🦆 Merged %d staged rows into %d candles in %v", s.staged, merged, time.Since(start).Round(time.Millisecond))
+	s.staged = 0
+	return nil
+}
+
+// dialect returns the dialect of the stored timezone, reading the series,
+// lineage, is_complete and oi columns if the table has them.
+func (s *DuckDBStore) dialect() (sqlDialect, error) {
+	zone, err := s.StoredTimezone()
+	if err != nil {
+		return sqlDialect{}, err
+	}
+	dialect := duckDBDialect(zone)
+	var tables int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_name = 'ohlcv'").Scan(&tables); err != nil {
+		return sqlDialect{}, fmt.Errorf("failed to inspect DuckDB schema: %v", err)
+	}
+	if tables == 0 {
+		return sqlDialect{}, fmt.Errorf("no candles stored yet (the database has no ohlcv table)")
+	}
+	hasSeries, err := s.hasColumn("exchange")
+	if err != nil {
+		return sqlDialect{}, err
+	}
+	if !hasSeries {
+		dialect = dialect.withoutSeriesColumns()
+	}
+	if dialect.lineage, err = s.hasColumn("fetched_at"); err != nil {
+		return sqlDialect{}, err
+	}
+	if dialect.completeness, err = s.hasColumn("is_complete"); err != nil {
+		return sqlDialect{}, err
+	}
+	if dialect.openInterest, err = s.hasColumn("oi"); err != nil {
+		return sqlDialect{}, err
+	}
+	return dialect, nil
+}
+
+// hasColumn reports whether the ohlcv table has an optional column, which
+// tables of earlier releases only gain when a store is initialized.
+func (s *DuckDBStore) hasColumn(column string) (bool, error) {
+	present, known := s.columns[column]
+	if !known {
+		var err error
+		if present, err = sqlHasColumn(s.db, column); err != nil {
+			return false, err
 		}
+		s.columns[column] = present
+	}
+	return present, nil
+}
+
+// duckDBDialect stores naive TIMESTAMPs holding the wall time of zone.
+func duckDBDialect(zone Timezone) sqlDialect {
+	return sqlDialect{
+		seriesFilter: nullableSeriesFilter,
+		bind:         func(t time.Time) interface{} { return wallClock(t, zone) },
+		parse: func(v interface{}) (time.Time, error) {
+			t, ok := v.(time.Time)
+			if !ok {
+				return time.Time{}, fmt.Errorf("unexpected timestamp value %v", v)
+			}
+			return fromWallClock(t, zone).In(calendar.IST), nil
+		},
+	}
+}
+
+// StoredTimezone returns the timezone of the stored timestamps.
+func (s *DuckDBStore) StoredTimezone() (Timezone, error) {
+	if s.zone != "" {
+		return s.zone, nil
+	}
+	recorded, err := sqlMetadata(s.db, "timezone")
+	if err != nil {
+		return "", err
+	}
+	if recorded == "" {
+		return TimezoneUTC, nil
+	}
+	s.zone = Timezone(recorded)
+	return s.zone, nil
+}
+
+// ConvertTimezone shifts every stored timestamp to the wall time of another
+// timezone and records it, in one transaction. Both zones have fixed
+// offsets, so the shift is the same for every row.
+func (s *DuckDBStore) ConvertTimezone(to Timezone) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	from, err := s.StoredTimezone()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("DB transaction error: %v", err)
 	}
+	defer tx.Rollback()
 
+	if _, err := tx.Exec(createSQLMetadata); err != nil {
+		return fmt.Errorf("failed to create DuckDB storage_metadata table: %v", err)
+	}
+	var rows int64
+	if from != to {
+		ref := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		_, fromOffset := ref.In(from.Location()).Zone()
+		_, toOffset := ref.In(to.Location()).Zone()
+		result, err := tx.Exec("UPDATE ohlcv SET timestamp = timestamp + to_seconds(CAST(? AS BIGINT))", toOffset-fromOffset)
+		if err != nil {
+			return fmt.Errorf("failed to convert timestamps: %v", err)
+		}
+		rows, _ = result.RowsAffected()
+	}
+	if err := setSQLMetadata(tx, "timezone", string(to)); err != nil {
+		return err
+	}
 	if err := tx.Commit(); err != nil {
-		return 0, fmt.Errorf("commit error: %v", err)
+		return fmt.Errorf("commit error: %v", err)
+	}
+	s.zone = to
+	s.logger.Printf("🕒 Converted %d timestamps from %s to %s", rows, from, to)
+	return nil
+}
+
+// ListSeries lists the stored instrument/interval combinations.
+func (s *DuckDBStore) ListSeries() ([]Series, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	dialect, err := s.dialect()
+	if err != nil {
+		return nil, err
+	}
+	return listSQLSeries(s.db, dialect)
+}
+
+// Coverage reports the first and last timestamp and the row count of a series.
+func (s *DuckDBStore) Coverage(series Series) (Coverage, error) {
+	if err := s.Flush(); err != nil {
+		return Coverage{Series: series}, err
+	}
+	dialect, err := s.dialect()
+	if err != nil {
+		return Coverage{Series: series}, err
+	}
+	return sqlCoverage(s.db, dialect, series)
+}
+
+// ReadRange streams the candles of a series in timestamp order.
+func (s *DuckDBStore) ReadRange(series Series, from, to time.Time, fn func(Candle) error) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	dialect, err := s.dialect()
+	if err != nil {
+		return err
+	}
+	return sqlReadRange(s.db, dialect, series, from, to, fn)
+}
+
+// Dedupe removes all but the most recently fetched row of every timestamp
+// of a series. Merges replace stored candles, so duplicates only remain in
+// databases written by earlier releases.
+func (s *DuckDBStore) Dedupe(series Series, dryRun bool) (int64, error) {
+	dialect, err := s.dialect()
+	if err != nil {
+		return 0, err
+	}
+	return sqlDedupe(s.db, dialect, series, dryRun)
+}
+
+// DeleteRange deletes the candles of a series with from <= timestamp <= to.
+func (s *DuckDBStore) DeleteRange(series Series, from, to time.Time, dryRun bool) (int64, error) {
+	dialect, err := s.dialect()
+	if err != nil {
+		return 0, err
+	}
+	return sqlDeleteRange(s.db, dialect, series, from, to, dryRun)
+}
+
+// Vacuum merges staged rows and checkpoints the database, writing the
+// table to the database file and releasing the space of deleted rows.
+func (s *DuckDBStore) Vacuum(dryRun bool) (int64, error) {
+	if !dryRun {
+		if err := s.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	rows, err := sqlRowCount(s.db)
+	if err != nil || dryRun {
+		return rows, err
 	}
-	return inserted, nil
+	if _, err := s.db.Exec("FORCE CHECKPOINT"); err != nil {
+		return rows, fmt.Errorf("DuckDB checkpoint failed: %v", err)
+	}
+	return rows, nil
+}
+
+// RecordRun records a fetch run in the fetch_runs and fetch_run_results tables.
+func (s *DuckDBStore) RecordRun(run FetchRun) error {
+	return sqlRecordRun(s.db, run)
+}
+
+// FetchRuns returns the recorded fetch runs, oldest first.
+func (s *DuckDBStore) FetchRuns() ([]FetchRun, error) {
+	return sqlFetchRuns(s.db)
 }
 
-// Close closes the database connection.
+// Close merges the staged rows and closes the database connection.
 func (s *DuckDBStore) Close() error {
-	return s.db.Close()
+	err := s.Flush()
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// TestDuckDBDedupe keeps the most recently fetched row of every timestamp,
+// whatever order the rows were inserted in, and the last inserted row where
+// no row has a fetched_at.
+func TestDuckDBDedupe(t *testing.T) {
+	store, err := NewDuckDBStore(filepath.Join(t.TempDir(), "market_data.duckdb"), Options{}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	at := func(hour, minute int) time.Time { return time.Date(2024, 1, 2, hour, minute, 0, 0, time.UTC) }
+	rows := []struct {
+		timestamp time.Time
+		fetchedAt interface{}
+		close     float64
+	}{
+		// Refetched later, but inserted first: the insert order must not win
+		{at(3, 45), at(12, 0), 602},
+		{at(3, 45), at(10, 0), 600},
+		{at(3, 45), nil, 599},
+		// Without lineage, the last inserted row wins
+		{at(3, 46), nil, 610},
+		{at(3, 46), nil, 611},
+		{at(3, 47), at(10, 0), 620},
+	}
+	for _, r := range rows {
+		_, err := store.db.Exec(`INSERT INTO ohlcv (instrument, open, high, low, close, timestamp, volume, exchange, "interval", fetched_at)
+			VALUES ('SBIN', 1, 2, 0.5, ?, ?, 100, 'NSE', 'minute', ?)`, r.close, r.timestamp, r.fetchedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	series := Series{Exchange: "NSE", Symbol: "SBIN", Interval: "minute"}
+	if n, err := store.Dedupe(series, true); err != nil || n != 3 {
+		t.Fatalf("Dedupe dry run = %d, %v, want 3 duplicates", n, err)
+	}
+	if n, err := store.Dedupe(series, false); err != nil || n != 3 {
+		t.Fatalf("Dedupe = %d, %v, want 3 rows removed", n, err)
+	}
+
+	var closes []float64
+	err = store.ReadRange(series, time.Time{}, time.Time{}, func(c Candle) error {
+		closes = append(closes, c.Close)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadRange: %v", err)
+	}
+	if want := []float64{602, 611, 620}; !slices.Equal(closes, want) {
+		t.Errorf("closes after dedupe = %v, want %v", closes, want)
+	}
+}
+
+// benchmarkCandles returns days of synthetic minute candles, 375 per session.
+func benchmarkCandles(days int) []kiteconnect.HistoricalData {
+	candles := make([]kiteconnect.HistoricalData, 0, days*375)
+	day := time.Date(2024, 1, 1, 9, 15, 0, 0, calendar.IST)
+	price := 100.0
+	for d := 0; d < days; d++ {
+		for !calendar.IsTradingDay(day) {
+			day = day.AddDate(0, 0, 1)
+		}
+		for m := 0; m < 375; m++ {
+			price += float64(m%7-3) * 0.05
+			candles = append(candles, kiteconnect.HistoricalData{
+				Date:   models.Time{Time: day.Add(time.Duration(m) * time.Minute)},
+				Open:   price,
+				High:   price + 0.5,
+				Low:    price - 0.5,
+				Close:  price + 0.1,
+				Volume: 1000 + m,
+			})
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return candles
+}
+
+// BenchmarkDuckDBStoreCandles measures ingestion of 10 instruments with 20
+// trading days of minute candles each, written in API-sized chunks:
+//
+//	go test -run '^$' -bench DuckDBStoreCandles ./internal/storage
+func BenchmarkDuckDBStoreCandles(b *testing.B) {
+	const symbols, chunk = 10, 5000
+	candles := benchmarkCandles(20)
+	rows := symbols * len(candles)
+
+	for _, flushRows := range []int{10000, DefaultDuckDBFlushRows, 1000000} {
+		b.Run(fmt.Sprintf("flush_rows=%d", flushRows), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				store, err := NewDuckDBStore(filepath.Join(b.TempDir(), "bench.duckdb"), Options{FlushRows: flushRows}, log.New(io.Discard, "", 0))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := store.Init(); err != nil {
+					b.Fatal(err)
+				}
+				for s := 0; s < symbols; s++ {
+					series := Series{Exchange: "NSE", Symbol: fmt.Sprintf("SYM%04d", s), Interval: "minute"}
+					for start := 0; start < len(candles); start += chunk {
+						end := min(start+chunk, len(candles))
+						if _, err := store.StoreCandles(series, candles[start:end]); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+				if err := store.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(rows*b.N)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// IncompleteStorer is implemented by stores that can keep candles which were
+// still forming when they were fetched, flagged is_complete=false. The next
+// write of the same timestamp replaces a flagged candle, so repeated
+// intraday fetches converge to the final candles.
+type IncompleteStorer interface {
+	StoreIncompleteCandles(series Series, candles []kiteconnect.HistoricalData) (int, error)
+}
+
+// isCompleteValue is the is_complete field of a candle written to a file:
+// false for a candle still forming, true for a complete candle of a fetch run
+// and absent for candles without lineage, such as ones written before it
+// was recorded.
+func isCompleteValue(complete bool, runID string) *bool {
+	if complete && runID == "" {
+		return nil
+	}
+	return &complete
+}
+
+// storedIsComplete is the is_complete field of a candle read back and
+// rewritten by maintenance.
+func storedIsComplete(c Candle) *bool {
+	return isCompleteValue(!c.Incomplete, c.RunID)
+}
+
+// hasLineage reports whether any of the candles has a lineage field to write.
+func hasLineage(candles []Candle) bool {
+	for _, c := range candles {
+		if storedIsComplete(c) != nil || !c.FetchedAt.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// supersedeIncomplete drops the flagged candles of an append-only file that
+// a later row of the same timestamp replaces, as a database upsert would.
+func supersedeIncomplete(candles []Candle) []Candle {
+	flagged := false
+	last := make(map[int64]int, len(candles))
+	for i, c := range candles {
+		last[c.Timestamp.Unix()] = i
+		flagged = flagged || c.Incomplete
+	}
+	if !flagged {
+		return candles
+	}
+	kept := make([]Candle, 0, len(last))
+	for i, c := range candles {
+		if c.Incomplete && last[c.Timestamp.Unix()] != i {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
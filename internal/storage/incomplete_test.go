@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// TestIncompleteCandleSuperseded stores candles still forming in one fetch
+// run and their final candles in the next, and expects every backend to read
+// back one complete candle per timestamp.
+func TestIncompleteCandleSuperseded(t *testing.T) {
+	series := Series{Exchange: "NSE", Symbol: "SBIN", Interval: "minute"}
+	candle := func(minute int, close float64) kiteconnect.HistoricalData {
+		return kiteconnect.HistoricalData{
+			Date:   models.Time{Time: time.Date(2024, 1, 2, 9, minute, 0, 0, calendar.IST)},
+			Open:   close - 1,
+			High:   close + 1,
+			Low:    close - 2,
+			Close:  close,
+			Volume: int(close),
+		}
+	}
+	runs := []struct {
+		id         string
+		complete   []kiteconnect.HistoricalData
+		incomplete []kiteconnect.HistoricalData
+	}{
+		// An intraday fetch: 09:16 and 09:17 are still forming
+		{"run-1", []kiteconnect.HistoricalData{candle(15, 600)}, []kiteconnect.HistoricalData{candle(16, 610), candle(17, 620)}},
+		// A later fetch: 09:16 is final, 09:17 still forming
+		{"run-2", []kiteconnect.HistoricalData{candle(16, 611)}, []kiteconnect.HistoricalData{candle(17, 621)}},
+		// After the session: everything is final
+		{"run-3", []kiteconnect.HistoricalData{candle(17, 622), candle(18, 630)}, nil},
+	}
+	want := []struct {
+		close float64
+		runID string
+	}{{600, "run-1"}, {611, "run-2"}, {622, "run-3"}, {630, "run-3"}}
+
+	for _, backend := range Backends() {
+		t.Run(string(backend.Name), func(t *testing.T) {
+			logger := log.New(io.Discard, "", 0)
+			path := filepath.Join(t.TempDir(), "market_data")
+			for _, run := range runs {
+				store, err := NewStore(backend.Name, path, Options{RunID: run.id}, logger)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := store.Init(); err != nil {
+					t.Fatalf("Init: %v", err)
+				}
+				flagger, ok := store.(IncompleteStorer)
+				if !ok {
+					t.Fatalf("%s does not store incomplete candles", backend.Name)
+				}
+				if len(run.incomplete) > 0 {
+					if _, err := flagger.StoreIncompleteCandles(series, run.incomplete); err != nil {
+						t.Fatalf("%s StoreIncompleteCandles: %v", run.id, err)
+					}
+				}
+				if _, err := store.StoreCandles(series, run.complete); err != nil {
+					t.Fatalf("%s StoreCandles: %v", run.id, err)
+				}
+				if err := store.Close(); err != nil {
+					t.Fatalf("%s Close: %v", run.id, err)
+				}
+			}
+
+			reader, err := OpenReader(backend.Name, path, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			var got []Candle
+			err = reader.ReadRange(series, time.Time{}, time.Time{}, func(c Candle) error {
+				got = append(got, c)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ReadRange: %v", err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("ReadRange returned %d candles, want %d: %+v", len(got), len(want), got)
+			}
+			for i, c := range got {
+				if c.Close != want[i].close || c.Incomplete || c.RunID != want[i].runID {
+					t.Errorf("candle %s: close %v, incomplete %v, run %q; want close %v, complete, run %q",
+						c.Timestamp.Format("15:04"), c.Close, c.Incomplete, c.RunID, want[i].close, want[i].runID)
+				}
+			}
+			cov, err := reader.Coverage(series)
+			if err != nil || cov.Rows != int64(len(want)) {
+				t.Errorf("Coverage = %d rows, %v, want %d", cov.Rows, err, len(want))
+			}
+		})
+	}
+}
@@ -12,34 +12,75 @@ type Store interface {
 	Init() error
 
 	// StoreCandles stores historical data for an instrument
-	StoreCandles(instrumentSymbol string, candles []kiteconnect.HistoricalData) (int, error)
+	StoreCandles(series Series, candles []kiteconnect.HistoricalData) (int, error)
 
 	// Close cleanup resources
 	Close() error
 }
 
+// Series identifies the candles of one instrument at one interval.
+type Series struct {
+	Exchange string
+	Symbol   string
+	Interval string
+}
+
+// Compactor is implemented by stores whose series can be rewritten sorted by
+// timestamp with duplicates removed. It returns the row counts before and after.
+type Compactor interface {
+	CompactSeries(series Series) (int64, int64, error)
+}
+
 // StorageType represents the different storage types available.
 type StorageType string
 
 const (
-	StorageTypeDuckDB StorageType = "duckdb"
-	StorageTypeSQLite StorageType = "sqlite"
-	StorageTypeJSON   StorageType = "json"
-	StorageTypeCSV    StorageType = "csv"
+	StorageTypeDuckDB  StorageType = "duckdb"
+	StorageTypeSQLite  StorageType = "sqlite"
+	StorageTypeJSON    StorageType = "json"
+	StorageTypeJSONL   StorageType = "jsonl"
+	StorageTypeCSV     StorageType = "csv"
+	StorageTypeParquet StorageType = "parquet"
 )
 
-// NewStore creates a new storage instance based on the specified type.
-func NewStore(storageType StorageType, path string, logger *log.Logger) (Store, error) {
-	switch storageType {
-	case StorageTypeDuckDB:
-		return NewDuckDBStore(path, logger)
-	case StorageTypeSQLite:
-		return NewSQLiteStore(path, logger)
-	case StorageTypeJSON:
-		return NewJSONStore(path, logger)
-	case StorageTypeCSV:
-		return NewCSVStore(path, logger)
-	default:
-		return NewDuckDBStore(path, logger) // Default fallback
+// Options holds settings that only apply to some storage types.
+type Options struct {
+	// Compression of the files written by the CSV, JSON and JSONL stores
+	Compression Compression
+
+	// PathTemplate lays out the files of a new CSV, JSON or JSONL store; an
+	// existing store must already use it ("" = keep the recorded layout)
+	PathTemplate string
+
+	// FlushRows is the number of rows the DuckDB store stages before merging
+	// them into its table (0 = DefaultDuckDBFlushRows)
+	FlushRows int
+
+	// Timezone of the stored timestamps of a new store; an existing store
+	// must already use it ("" = keep the recorded zone)
+	Timezone Timezone
+
+	// RunID is the fetch run writing the candles. Stores recording lineage
+	// stamp every candle with it and the time it was written ("" = no lineage).
+	RunID string
+}
+
+// NewStore creates a new storage instance of a registered storage type.
+func NewStore(storageType StorageType, path string, opts Options, logger *log.Logger) (Store, error) {
+	backend, err := lookupBackend(storageType)
+	if err != nil {
+		return nil, err
+	}
+	return backend.New(path, opts, logger)
+}
+
+// constructor adapts the constructor of a store type to Backend.New.
+func constructor[S Store](newStore func(string, Options, *log.Logger) (S, error)) func(string, Options, *log.Logger) (Store, error) {
+	return func(path string, opts Options, logger *log.Logger) (Store, error) {
+		store, err := newStore(path, opts, logger)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
 	}
 }
@@ -2,60 +2,455 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
+
+	"zerodha-connect/internal/calendar"
 
 	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
 )
 
-// JSONStore provides a storage interface for JSON files (one file per instrument).
+// JSONStore provides a storage interface for JSON files (one file per instrument
+// and interval, laid out by the path template recorded in _metadata.json, or
+// DefaultPathTemplate).
+//
+// Each write rewrites the whole file as an indented array, so it is meant as
+// a readable export (e.g. convert --to-type json); JSONLStore is the format
+// to append to from regular fetches. With compression, files are named
+// SYMBOL.json.gz or SYMBOL.json.zst.
+//
+// Timestamps are RFC 3339 with the offset of the storage timezone recorded
+// in _metadata.json (IST for directories of earlier releases). Candles
+// written by a fetch run carry fetched_at and run_id fields; the runs are
+// recorded in _fetch_runs.jsonl.
 type JSONStore struct {
-	basePath string
-	logger   *log.Logger
+	basePath     string
+	compression  Compression
+	pathTemplate string
+	layout       *fileLayout
+	timezone     Timezone
+	zone         Timezone
+	lineage      lineage
+	logger       *log.Logger
+}
+
+// jsonCandle is one element of a JSON file: a Kite candle, its lineage and
+// whether it was complete when fetched.
+type jsonCandle struct {
+	kiteconnect.HistoricalData
+	FetchedAt  time.Time `json:"fetched_at,omitzero"`
+	RunID      string    `json:"run_id,omitempty"`
+	IsComplete *bool     `json:"is_complete,omitempty"`
+}
+
+// newJSONCandle returns the element of a candle.
+func newJSONCandle(c Candle) jsonCandle {
+	return jsonCandle{
+		HistoricalData: kiteconnect.HistoricalData{
+			Date:   models.Time{Time: c.Timestamp},
+			Open:   c.Open,
+			High:   c.High,
+			Low:    c.Low,
+			Close:  c.Close,
+			Volume: int(c.Volume),
+			OI:     int(c.OI),
+		},
+		FetchedAt:  c.FetchedAt,
+		RunID:      c.RunID,
+		IsComplete: storedIsComplete(c),
+	}
 }
 
-// NewJSONStore creates a new JSON store.
-func NewJSONStore(basePath string, logger *log.Logger) (*JSONStore, error) {
-	return &JSONStore{basePath: basePath, logger: logger}, nil
+// NewJSONStore creates a new JSON store writing files with the compression,
+// path template and timezone of opts.
+func NewJSONStore(basePath string, opts Options, logger *log.Logger) (*JSONStore, error) {
+	if _, err := newFileLayout(opts.PathTemplate, ".json"); err != nil {
+		return nil, err
+	}
+	return &JSONStore{basePath: basePath, compression: opts.Compression, pathTemplate: opts.PathTemplate,
+		timezone: opts.Timezone, lineage: lineage{runID: opts.RunID}, logger: logger}, nil
 }
 
-// Init initializes the storage directory.
+func init() {
+	Register(Backend{
+		Name: StorageTypeJSON,
+		New:  constructor(NewJSONStore),
+		Schema: Schema{
+			DefaultPath:  "data/json",
+			Directory:    true,
+			Compression:  true,
+			PathTemplate: true,
+			Timezones:    []Timezone{TimezoneUTC, TimezoneIST},
+		},
+		Description: Description{
+			Title:   "📄 JSON",
+			BestFor: "Pretty exports for inspection and debugging, small datasets",
+			Format:  "One JSON array per instrument and interval (" + DefaultPathTemplate + ".json)",
+			Pros:    "Human-readable, easy to inspect, no database required",
+			Cons:    "Every write rewrites the whole file; use JSON Lines for regular fetches",
+		},
+	})
+}
+
+// Init initializes the storage directory and its layout and timezone records.
 func (s *JSONStore) Init() error {
 	if err := os.MkdirAll(s.basePath, 0755); err != nil {
 		return fmt.Errorf("failed to create JSON storage directory: %v", err)
 	}
-	s.logger.Printf("✅ JSON storage directory ready: %s", s.basePath)
+	hasData := func() (bool, error) {
+		series, err := s.ListSeries()
+		return len(series) > 0, err
+	}
+	layout, err := initFileLayout(s.basePath, s.pathTemplate, ".json", hasData)
+	if err != nil {
+		return err
+	}
+	s.layout = layout
+	zone, err := initFileTimezone(s.basePath, s.timezone, TimezoneIST, hasData)
+	if err != nil {
+		return err
+	}
+	s.zone = zone
+	s.logger.Printf("✅ JSON storage directory ready: %s (%s, timestamps in %s)", s.basePath, s.layout.template, s.zone)
 	return nil
 }
 
+// pathLayout returns the layout of the store's files.
+func (s *JSONStore) pathLayout() (*fileLayout, error) {
+	if s.layout != nil {
+		return s.layout, nil
+	}
+	layout, err := fileStoreLayout(s.basePath, ".json")
+	if err != nil {
+		return nil, err
+	}
+	s.layout = layout
+	return layout, nil
+}
+
 // StoreCandles stores candles to a JSON file for the specific instrument.
-func (s *JSONStore) StoreCandles(instrumentSymbol string, candles []kiteconnect.HistoricalData) (int, error) {
-	fileName := fmt.Sprintf("%s.json", instrumentSymbol)
-	filePath := filepath.Join(s.basePath, fileName)
+func (s *JSONStore) StoreCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, true))
+}
+
+// StoreIncompleteCandles stores candles still forming, flagged
+// "is_complete": false, to be replaced by the next write of their timestamps.
+func (s *JSONStore) StoreIncompleteCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, false))
+}
+
+// StoreLineageCandles stores candles keeping their lineage.
+func (s *JSONStore) StoreLineageCandles(series Series, candles []Candle) (int, error) {
+	return s.storeCandles(series, candles)
+}
+
+// storeCandles rewrites the files of the periods the candles fall in with
+// them appended.
+func (s *JSONStore) storeCandles(series Series, candles []Candle) (int, error) {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return 0, err
+	}
+	if err := layout.checkSeries(series); err != nil {
+		return 0, err
+	}
+	periods, groups := splitByPeriod(layout, candles, func(c Candle) time.Time { return c.Timestamp })
+	for _, period := range periods {
+		if err := s.storePeriod(layout, series, period, groups[period]); err != nil {
+			return 0, err
+		}
+	}
+	return len(candles), nil
+}
+
+// storePeriod rewrites the file of one period of a series with the candles
+// appended. Flagged candles of the timestamps written are replaced by the new ones.
+func (s *JSONStore) storePeriod(layout *fileLayout, series Series, period string, candles []Candle) error {
+	filePath := layout.path(s.basePath, series, period) + s.compression.Ext()
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create JSON directory: %v", err)
+	}
 
-	// Load existing data if file exists
-	var existingData []kiteconnect.HistoricalData
-	if data, err := os.ReadFile(filePath); err == nil {
-		json.Unmarshal(data, &existingData)
+	// Load existing data, from files of any compression. A file that cannot be
+	// parsed is left alone rather than overwritten with only the new candles.
+	files, err := layout.periodPaths(s.basePath, series, period)
+	if err != nil {
+		return fmt.Errorf("failed to find JSON files: %v", err)
+	}
+	var existingData []jsonCandle
+	for _, f := range files {
+		stored, err := s.loadFile(f)
+		if err != nil {
+			return err
+		}
+		existingData = append(existingData, stored...)
 	}
 
 	// Append new candles
-	allData := append(existingData, candles...)
+	written := make(map[int64]bool, len(candles))
+	for _, c := range candles {
+		written[c.Timestamp.Unix()] = true
+	}
+	allData := existingData[:0]
+	for _, c := range existingData {
+		if c.IsComplete != nil && !*c.IsComplete && written[c.Date.Time.Unix()] {
+			continue
+		}
+		allData = append(allData, c)
+	}
+	for _, c := range candles {
+		allData = append(allData, newJSONCandle(c))
+	}
 
 	// Write back to file
-	jsonData, err := json.MarshalIndent(allData, "", "  ")
+	jsonData, err := marshalJSONCandles(allData, s.zone)
 	if err != nil {
-		return 0, fmt.Errorf("failed to marshal JSON data: %v", err)
+		return err
 	}
 
-	if err := os.WriteFile(filePath, jsonData, 0644); err != nil {
-		return 0, fmt.Errorf("failed to write JSON file: %v", err)
+	// Write to a temporary file first so an interrupted write keeps the old file
+	if err := writeFileAtomic(filePath, s.compression, jsonData); err != nil {
+		return fmt.Errorf("failed to write JSON file: %v", err)
+	}
+	if err := removeOtherFiles(files, filePath); err != nil {
+		return fmt.Errorf("failed to remove old JSON file: %v", err)
 	}
 
-	s.logger.Printf("📄 Stored %d candles to %s (total: %d)", len(candles), fileName, len(allData))
-	return len(candles), nil
+	s.logger.Printf("📄 Stored %d candles to %s (total: %d)", len(candles), filePath, len(allData))
+	return nil
+}
+
+// marshalJSONCandles encodes candles as an indented array with timestamps in zone.
+func marshalJSONCandles(candles []jsonCandle, zone Timezone) ([]byte, error) {
+	for i := range candles {
+		candles[i].Date.Time = candles[i].Date.Time.In(zone.Location())
+		candles[i].FetchedAt = inZone(candles[i].FetchedAt, zone)
+	}
+	jsonData, err := json.MarshalIndent(candles, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON data: %v", err)
+	}
+	return jsonData, nil
+}
+
+// StoredTimezone returns the timezone of the stored timestamps.
+func (s *JSONStore) StoredTimezone() (Timezone, error) {
+	if s.zone != "" {
+		return s.zone, nil
+	}
+	zone, err := fileStoreTimezone(s.basePath, TimezoneIST)
+	if err != nil {
+		return "", err
+	}
+	s.zone = zone
+	return zone, nil
+}
+
+// ConvertTimezone rewrites the timestamps of every file with the offset of
+// another timezone and records it. Files are replaced only once all are converted.
+func (s *JSONStore) ConvertTimezone(to Timezone) error {
+	from, err := s.StoredTimezone()
+	if err != nil {
+		return err
+	}
+	files, err := convertFiles(s.basePath, ".json", to, func(data []byte) ([]byte, error) {
+		var stored []jsonCandle
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, err
+		}
+		return marshalJSONCandles(stored, to)
+	})
+	if err != nil {
+		return err
+	}
+	s.zone = to
+	s.logger.Printf("🕒 Converted %d JSON file(s) from %s to %s", files, from, to)
+	return nil
+}
+
+// ListSeries lists the stored instrument/interval combinations.
+func (s *JSONStore) ListSeries() ([]Series, error) {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return nil, err
+	}
+	return layout.list(s.basePath)
+}
+
+// SeriesFiles returns the JSON files of a series, of every period and in any
+// compression.
+func (s *JSONStore) SeriesFiles(series Series) ([]string, error) {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return nil, err
+	}
+	return layout.paths(s.basePath, series)
+}
+
+// Coverage reports the first and last timestamp and the row count of a series.
+func (s *JSONStore) Coverage(series Series) (Coverage, error) {
+	candles, err := s.load(series)
+	if err != nil {
+		return Coverage{Series: series}, err
+	}
+	return coverageOf(series, candles), nil
+}
+
+// ReadRange streams the candles of a series in timestamp order.
+func (s *JSONStore) ReadRange(series Series, from, to time.Time, fn func(Candle) error) error {
+	candles, err := s.loadRange(series, from, to)
+	if err != nil {
+		return err
+	}
+	return streamCandles(candles, from, to, fn)
+}
+
+// loadFile reads the candles of one JSON file.
+func (s *JSONStore) loadFile(filePath string) ([]jsonCandle, error) {
+	var stored []jsonCandle
+	err := s.scanFile(filePath, func(c jsonCandle) {
+		stored = append(stored, c)
+	})
+	return stored, err
+}
+
+// scanFile passes the elements of one JSON file to fn as they are decoded.
+func (s *JSONStore) scanFile(filePath string, fn func(jsonCandle)) error {
+	file, err := openFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read JSON file: %v", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	parseErr := func(err error) error {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%s is truncated", filePath)
+		}
+		return fmt.Errorf("failed to parse %s: %v", filePath, err)
+	}
+	token, err := decoder.Token()
+	if err != nil {
+		return parseErr(err)
+	}
+	if token == nil {
+		return nil // null, an empty series
+	}
+	if token != json.Delim('[') {
+		return fmt.Errorf("failed to parse %s: not a JSON array", filePath)
+	}
+	for decoder.More() {
+		var c jsonCandle
+		if err := decoder.Decode(&c); err != nil {
+			return parseErr(err)
+		}
+		fn(c)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return parseErr(err)
+	}
+	return nil
+}
+
+// load reads all candles of a series from its files of every period and compression.
+func (s *JSONStore) load(series Series) ([]Candle, error) {
+	return s.loadRange(series, time.Time{}, time.Time{})
+}
+
+// loadRange reads the candles of a series within [from, to]. Elements are
+// decoded one at a time and only those in range are kept.
+func (s *JSONStore) loadRange(series Series, from, to time.Time) ([]Candle, error) {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return nil, err
+	}
+	files, err := layout.rangePaths(s.basePath, series, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find JSON files: %v", err)
+	}
+	var candles []Candle
+	for _, f := range files {
+		err := s.scanFile(f, func(h jsonCandle) {
+			if c := h.candle(); inRange(c.Timestamp, from, to) {
+				candles = append(candles, c)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return candles, nil
+}
+
+// candle converts an element of a JSON file to a stored candle in IST.
+func (h jsonCandle) candle() Candle {
+	return Candle{
+		Timestamp:  h.Date.Time.In(calendar.IST),
+		Open:       h.Open,
+		High:       h.High,
+		Low:        h.Low,
+		Close:      h.Close,
+		Volume:     int64(h.Volume),
+		OI:         int64(h.OI),
+		FetchedAt:  inIST(h.FetchedAt),
+		Incomplete: h.IsComplete != nil && !*h.IsComplete,
+		RunID:      h.RunID,
+	}
+}
+
+// rewriteSeries replaces the files of a series by one file per period holding candles.
+func (s *JSONStore) rewriteSeries(series Series, candles []Candle) error {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return err
+	}
+	zone, err := s.StoredTimezone()
+	if err != nil {
+		return err
+	}
+	stored := make([]jsonCandle, len(candles))
+	for i, c := range candles {
+		stored[i] = newJSONCandle(c)
+	}
+	data := make(map[string][]byte)
+	periods, groups := splitByPeriod(layout, stored, func(c jsonCandle) time.Time { return c.Date.Time })
+	for _, period := range periods {
+		if data[period], err = marshalJSONCandles(groups[period], zone); err != nil {
+			return err
+		}
+	}
+	return layout.replace(s.basePath, series, s.compression, data)
+}
+
+// Dedupe keeps the most recently fetched candle of every timestamp of a series.
+func (s *JSONStore) Dedupe(series Series, dryRun bool) (int64, error) {
+	return dedupeFiles(s, series, dryRun)
+}
+
+// DeleteRange removes the candles of a series with from <= timestamp <= to.
+func (s *JSONStore) DeleteRange(series Series, from, to time.Time, dryRun bool) (int64, error) {
+	return deleteFromFiles(s, series, from, to, dryRun)
+}
+
+// Vacuum rewrites every file sorted by timestamp.
+func (s *JSONStore) Vacuum(dryRun bool) (int64, error) {
+	return vacuumFiles(s, dryRun)
+}
+
+// RecordRun appends a fetch run to the _fetch_runs.jsonl manifest.
+func (s *JSONStore) RecordRun(run FetchRun) error {
+	return recordFileRun(s.basePath, run)
+}
+
+// FetchRuns returns the fetch runs recorded in the manifest, oldest first.
+func (s *JSONStore) FetchRuns() ([]FetchRun, error) {
+	return fileRuns(s.basePath)
 }
 
 // Close cleanup resources (no-op for JSON).
@@ -0,0 +1,501 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// jsonlCandle is one line of a JSON Lines file.
+type jsonlCandle struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Open       float64   `json:"open"`
+	High       float64   `json:"high"`
+	Low        float64   `json:"low"`
+	Close      float64   `json:"close"`
+	Volume     int64     `json:"volume"`
+	OI         int64     `json:"oi,omitempty"`
+	FetchedAt  time.Time `json:"fetched_at,omitzero"`
+	RunID      string    `json:"run_id,omitempty"`
+	IsComplete *bool     `json:"is_complete,omitempty"`
+}
+
+// newJSONLCandle returns the line of a candle, times in zone.
+func newJSONLCandle(c Candle, zone Timezone) jsonlCandle {
+	return jsonlCandle{Timestamp: c.Timestamp.In(zone.Location()), Open: c.Open, High: c.High, Low: c.Low, Close: c.Close,
+		Volume: c.Volume, OI: c.OI, FetchedAt: inZone(c.FetchedAt, zone), RunID: c.RunID, IsComplete: storedIsComplete(c)}
+}
+
+// JSONLStore provides a storage interface for JSON Lines files (one candle per
+// line, one file per instrument and interval, laid out by the path template
+// recorded in _metadata.json, or DefaultPathTemplate).
+//
+// Writes append to the file and are fsynced before StoreCandles returns, so
+// the cost of a write does not grow with the file. A write torn by a crash
+// leaves at most a partial last line, which is dropped by the next append.
+//
+// With compression, files are named SYMBOL.jsonl.gz or SYMBOL.jsonl.zst and
+// every write appends one compressed member, which zcat and zstdcat read as
+// a single stream.
+//
+// Timestamps are RFC 3339 with the offset of the storage timezone recorded
+// in _metadata.json (IST for directories of earlier releases). Candles
+// written by a fetch run carry fetched_at and run_id fields; the runs are
+// recorded in _fetch_runs.jsonl.
+type JSONLStore struct {
+	basePath     string
+	compression  Compression
+	pathTemplate string
+	layout       *fileLayout
+	timezone     Timezone
+	zone         Timezone
+	lineage      lineage
+	logger       *log.Logger
+	checked      map[string]bool
+}
+
+// NewJSONLStore creates a new JSON Lines store writing files with the
+// compression, path template and timezone of opts.
+func NewJSONLStore(basePath string, opts Options, logger *log.Logger) (*JSONLStore, error) {
+	if _, err := newFileLayout(opts.PathTemplate, ".jsonl"); err != nil {
+		return nil, err
+	}
+	return &JSONLStore{basePath: basePath, compression: opts.Compression, pathTemplate: opts.PathTemplate,
+		timezone: opts.Timezone, lineage: lineage{runID: opts.RunID}, logger: logger, checked: make(map[string]bool)}, nil
+}
+
+func init() {
+	Register(Backend{
+		Name: StorageTypeJSONL,
+		New:  constructor(NewJSONLStore),
+		Schema: Schema{
+			DefaultPath:  "data/jsonl",
+			Directory:    true,
+			Compression:  true,
+			PathTemplate: true,
+			Timezones:    []Timezone{TimezoneUTC, TimezoneIST},
+		},
+		Description: Description{
+			Title:   "📝 JSON Lines",
+			BestFor: "Regular fetches into plain text files, streaming tools (jq, pandas)",
+			Format:  "One candle per line, one file per instrument and interval (" + DefaultPathTemplate + ".jsonl)",
+			Pros:    "Appends without rewriting, crash-safe, human-readable",
+			Cons:    "Refetched candles are appended again until 'storage compact' runs",
+		},
+	})
+}
+
+// Init initializes the storage directory and its layout and timezone records.
+func (s *JSONLStore) Init() error {
+	if err := os.MkdirAll(s.basePath, 0755); err != nil {
+		return fmt.Errorf("failed to create JSONL storage directory: %v", err)
+	}
+	hasData := func() (bool, error) {
+		series, err := s.ListSeries()
+		return len(series) > 0, err
+	}
+	layout, err := initFileLayout(s.basePath, s.pathTemplate, ".jsonl", hasData)
+	if err != nil {
+		return err
+	}
+	s.layout = layout
+	zone, err := initFileTimezone(s.basePath, s.timezone, TimezoneIST, hasData)
+	if err != nil {
+		return err
+	}
+	s.zone = zone
+	s.logger.Printf("✅ JSONL storage directory ready: %s (%s, timestamps in %s)", s.basePath, s.layout.template, s.zone)
+	return nil
+}
+
+// pathLayout returns the layout of the store's files.
+func (s *JSONLStore) pathLayout() (*fileLayout, error) {
+	if s.layout != nil {
+		return s.layout, nil
+	}
+	layout, err := fileStoreLayout(s.basePath, ".jsonl")
+	if err != nil {
+		return nil, err
+	}
+	s.layout = layout
+	return layout, nil
+}
+
+// StoreCandles appends candles to the JSONL file of the series.
+func (s *JSONLStore) StoreCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, true))
+}
+
+// StoreIncompleteCandles appends candles still forming, flagged
+// "is_complete": false. A later line of the same timestamp replaces them.
+func (s *JSONLStore) StoreIncompleteCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, false))
+}
+
+// StoreLineageCandles appends candles keeping their lineage.
+func (s *JSONLStore) StoreLineageCandles(series Series, candles []Candle) (int, error) {
+	return s.storeCandles(series, candles)
+}
+
+// storeCandles appends candles to the files of the periods they fall in.
+func (s *JSONLStore) storeCandles(series Series, candles []Candle) (int, error) {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return 0, err
+	}
+	if err := layout.checkSeries(series); err != nil {
+		return 0, err
+	}
+	periods, groups := splitByPeriod(layout, candles, func(c Candle) time.Time { return c.Timestamp })
+	var appended int
+	for _, period := range periods {
+		n, err := s.appendCandles(layout.path(s.basePath, series, period)+s.compression.Ext(), groups[period])
+		appended += n
+		if err != nil {
+			return appended, err
+		}
+	}
+	return appended, nil
+}
+
+// appendCandles appends candles to one file and syncs it.
+func (s *JSONLStore) appendCandles(filePath string, candles []Candle) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create JSONL directory: %v", err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, c := range candles {
+		if err := enc.Encode(newJSONLCandle(c, s.zone)); err != nil {
+			return 0, fmt.Errorf("failed to encode candle: %v", err)
+		}
+	}
+
+	if s.compression != CompressionNone {
+		if !s.checked[filePath] {
+			repaired, err := repairCompressed(filePath)
+			if err != nil {
+				return 0, fmt.Errorf("failed to check %s: %v", filePath, err)
+			}
+			if repaired {
+				s.logger.Printf("⚠️  Dropped a partial compressed member at the end of %s", filePath)
+			}
+			s.checked[filePath] = true
+		}
+		if err := appendFile(filePath, s.compression, buf.Bytes()); err != nil {
+			return 0, fmt.Errorf("failed to write JSONL file: %v", err)
+		}
+		s.logger.Printf("📄 Appended %d candles to %s", len(candles), filePath)
+		return len(candles), nil
+	}
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open JSONL file: %v", err)
+	}
+	defer file.Close()
+
+	end, err := s.repairTail(file, filePath)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := file.WriteAt(buf.Bytes(), end); err != nil {
+		return 0, fmt.Errorf("failed to write JSONL file: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync JSONL file: %v", err)
+	}
+
+	s.logger.Printf("📄 Appended %d candles to %s", len(candles), filePath)
+	return len(candles), nil
+}
+
+// repairTail truncates a partial last line left by an interrupted write and
+// returns the offset to append at.
+func (s *JSONLStore) repairTail(file *os.File, filePath string) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat JSONL file: %v", err)
+	}
+	size := info.Size()
+	if size == 0 {
+		return 0, nil
+	}
+
+	// Scan backwards for the last newline
+	const block = 4096
+	buf := make([]byte, block)
+	end := size
+	for end > 0 {
+		start := end - block
+		if start < 0 {
+			start = 0
+		}
+		n, err := file.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("failed to read JSONL file: %v", err)
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			end = start + int64(i) + 1
+			break
+		}
+		end = start
+	}
+	if end == size {
+		return size, nil
+	}
+
+	s.logger.Printf("⚠️  Dropping %d bytes of a partial last line in %s", size-end, filePath)
+	if err := file.Truncate(end); err != nil {
+		return 0, fmt.Errorf("failed to repair JSONL file: %v", err)
+	}
+	return end, nil
+}
+
+// ListSeries lists the stored instrument/interval combinations.
+func (s *JSONLStore) ListSeries() ([]Series, error) {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return nil, err
+	}
+	return layout.list(s.basePath)
+}
+
+// SeriesFiles returns the JSON Lines files of a series, of every period and
+// in any compression.
+func (s *JSONLStore) SeriesFiles(series Series) ([]string, error) {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return nil, err
+	}
+	return layout.paths(s.basePath, series)
+}
+
+// Coverage reports the first and last timestamp and the row count of a series.
+func (s *JSONLStore) Coverage(series Series) (Coverage, error) {
+	candles, err := s.load(series)
+	if err != nil {
+		return Coverage{Series: series}, err
+	}
+	return coverageOf(series, candles), nil
+}
+
+// ReadRange streams the candles of a series in timestamp order.
+func (s *JSONLStore) ReadRange(series Series, from, to time.Time, fn func(Candle) error) error {
+	candles, err := s.loadRange(series, from, to)
+	if err != nil {
+		return err
+	}
+	return streamCandles(candles, from, to, fn)
+}
+
+// load reads all candles of a series from its files of every period and
+// compression, in file order.
+func (s *JSONLStore) load(series Series) ([]Candle, error) {
+	return s.loadRange(series, time.Time{}, time.Time{})
+}
+
+// loadRange reads the candles of a series within [from, to], in file order.
+// Lines are decoded as they are read and only those in range are kept.
+func (s *JSONLStore) loadRange(series Series, from, to time.Time) ([]Candle, error) {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return nil, err
+	}
+	files, err := layout.rangePaths(s.basePath, series, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find JSONL files: %v", err)
+	}
+	var candles []Candle
+	for _, filePath := range files {
+		err := s.scanFile(filePath, func(c Candle) {
+			if inRange(c.Timestamp, from, to) {
+				candles = append(candles, c)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return candles, nil
+}
+
+// scanFile passes the candles of one JSONL file to fn as they are read. A
+// partial last line is ignored; any other malformed line is an error.
+func (s *JSONLStore) scanFile(filePath string, fn func(Candle)) error {
+	file, err := openFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read JSONL file: %v", err)
+	}
+	defer file.Close()
+	lines := newCompleteLines(file)
+
+	reader := bufio.NewReader(lines)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", filePath, err)
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		var c jsonlCandle
+		if err := json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("%s line %d: %v", filePath, line, err)
+		}
+		fn(Candle{
+			Timestamp:  c.Timestamp.In(calendar.IST),
+			Open:       c.Open,
+			High:       c.High,
+			Low:        c.Low,
+			Close:      c.Close,
+			Volume:     c.Volume,
+			OI:         c.OI,
+			FetchedAt:  inIST(c.FetchedAt),
+			RunID:      c.RunID,
+			Incomplete: c.IsComplete != nil && !*c.IsComplete,
+		})
+	}
+	if lines.truncated {
+		s.logger.Printf("⚠️  Ignoring partial last line of %s", filePath)
+	}
+	return nil
+}
+
+// CompactSeries rewrites the files of a series sorted by timestamp, keeping
+// the most recently appended candle for each timestamp. The new file is
+// synced and renamed over the old one, so a crash leaves either version.
+// It is written in the store's compression; files of the series in other
+// compressions are merged into it and removed.
+func (s *JSONLStore) CompactSeries(series Series) (int64, int64, error) {
+	candles, err := s.load(series)
+	if err != nil {
+		return 0, 0, err
+	}
+	before := int64(len(candles))
+	if before == 0 {
+		return 0, 0, nil
+	}
+	kept := latestCandles(candles)
+	if err := s.rewriteSeries(series, kept); err != nil {
+		return before, before, err
+	}
+	return before, int64(len(kept)), nil
+}
+
+// rewriteSeries replaces the files of a series by one file per period holding candles.
+func (s *JSONLStore) rewriteSeries(series Series, candles []Candle) error {
+	layout, err := s.pathLayout()
+	if err != nil {
+		return err
+	}
+	zone, err := s.StoredTimezone()
+	if err != nil {
+		return err
+	}
+	data := make(map[string][]byte)
+	periods, groups := splitByPeriod(layout, candles, func(c Candle) time.Time { return c.Timestamp })
+	for _, period := range periods {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, c := range groups[period] {
+			if err := enc.Encode(newJSONLCandle(c, zone)); err != nil {
+				return fmt.Errorf("failed to encode candle: %v", err)
+			}
+		}
+		data[period] = buf.Bytes()
+	}
+	return layout.replace(s.basePath, series, s.compression, data)
+}
+
+// Dedupe keeps the most recently fetched candle of every timestamp of a series.
+func (s *JSONLStore) Dedupe(series Series, dryRun bool) (int64, error) {
+	return dedupeFiles(s, series, dryRun)
+}
+
+// DeleteRange removes the candles of a series with from <= timestamp <= to.
+func (s *JSONLStore) DeleteRange(series Series, from, to time.Time, dryRun bool) (int64, error) {
+	return deleteFromFiles(s, series, from, to, dryRun)
+}
+
+// Vacuum rewrites every file sorted by timestamp, dropping partial last lines.
+func (s *JSONLStore) Vacuum(dryRun bool) (int64, error) {
+	return vacuumFiles(s, dryRun)
+}
+
+// StoredTimezone returns the timezone of the stored timestamps.
+func (s *JSONLStore) StoredTimezone() (Timezone, error) {
+	if s.zone != "" {
+		return s.zone, nil
+	}
+	zone, err := fileStoreTimezone(s.basePath, TimezoneIST)
+	if err != nil {
+		return "", err
+	}
+	s.zone = zone
+	return zone, nil
+}
+
+// ConvertTimezone rewrites the timestamps of every file with the offset of
+// another timezone and records it. Files are replaced only once all are
+// converted; a partial last line is dropped.
+func (s *JSONLStore) ConvertTimezone(to Timezone) error {
+	from, err := s.StoredTimezone()
+	if err != nil {
+		return err
+	}
+	files, err := convertFiles(s.basePath, ".jsonl", to, func(data []byte) ([]byte, error) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		lines := bytes.SplitAfter(data, []byte("\n"))
+		for i, line := range lines {
+			if len(bytes.TrimSpace(line)) == 0 || !bytes.HasSuffix(line, []byte("\n")) {
+				continue
+			}
+			var c jsonlCandle
+			if err := json.Unmarshal(line, &c); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			c.Timestamp = c.Timestamp.In(to.Location())
+			if err := enc.Encode(c); err != nil {
+				return nil, fmt.Errorf("failed to encode candle: %v", err)
+			}
+		}
+		return buf.Bytes(), nil
+	})
+	if err != nil {
+		return err
+	}
+	s.zone = to
+	s.logger.Printf("🕒 Converted %d JSONL file(s) from %s to %s", files, from, to)
+	return nil
+}
+
+// RecordRun appends a fetch run to the _fetch_runs.jsonl manifest.
+func (s *JSONLStore) RecordRun(run FetchRun) error {
+	return recordFileRun(s.basePath, run)
+}
+
+// FetchRuns returns the fetch runs recorded in the manifest, oldest first.
+func (s *JSONLStore) FetchRuns() ([]FetchRun, error) {
+	return fileRuns(s.basePath)
+}
+
+// Close cleanup resources (no-op for JSONL).
+func (s *JSONLStore) Close() error {
+	return nil
+}
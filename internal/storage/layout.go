@@ -0,0 +1,552 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+// DefaultPathTemplate lays out the files of a store as
+// <EXCHANGE>/<interval>/<SYMBOL>.<ext>, one file per series.
+const DefaultPathTemplate = "{exchange}/{interval}/{symbol}"
+
+// Placeholders of a path template. {exchange}, {interval} and {symbol} are
+// required; {year} (and {month} with it) split a series into one file per
+// period of its candles, in IST.
+const (
+	placeholderExchange = "{exchange}"
+	placeholderInterval = "{interval}"
+	placeholderSymbol   = "{symbol}"
+	placeholderYear     = "{year}"
+	placeholderMonth    = "{month}"
+)
+
+// fileStoreExts are the extensions of the file stores; a path template may
+// end in the one of its store.
+var fileStoreExts = []string{".csv", ".json", ".jsonl"}
+
+var templatePlaceholder = regexp.MustCompile(`\{[^{}/]*\}`)
+
+// fileLayout maps the series of a file store to its files through a path
+// template, and file paths back to their series and period.
+type fileLayout struct {
+	template string // Without extension
+	ext      string
+	pattern  *regexp.Regexp
+	fields   []string // Placeholder of each group of pattern
+	byYear   bool
+	byMonth  bool
+}
+
+// ValidatePathTemplate checks a path template without regard to the store it
+// is used with.
+func ValidatePathTemplate(template string) error {
+	for _, ext := range fileStoreExts {
+		if strings.HasSuffix(template, ext) {
+			template = strings.TrimSuffix(template, ext)
+			break
+		}
+	}
+	_, err := newFileLayout(template, "")
+	return err
+}
+
+// newFileLayout parses the path template of a store writing files with ext.
+// An empty template is the default layout.
+func newFileLayout(template, ext string) (*fileLayout, error) {
+	if template == "" {
+		template = DefaultPathTemplate
+	}
+	if ext != "" && strings.HasSuffix(template, ext) {
+		template = strings.TrimSuffix(template, ext)
+	} else if other := filepath.Ext(template); slices.Contains(fileStoreExts, other) {
+		return nil, fmt.Errorf("path template %q ends in %s, but these files end in %s", template, other, ext)
+	}
+	if strings.HasPrefix(template, "/") || strings.ContainsAny(template, `\*?[`) {
+		return nil, fmt.Errorf("path template %q must be a relative path without \\, *, ? or [", template)
+	}
+
+	l := &fileLayout{template: template, ext: ext}
+	counts := make(map[string]int)
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for i, segment := range strings.Split(template, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("path template %q has an empty, . or .. directory", template)
+		}
+		if i > 0 {
+			pattern.WriteString("/")
+		}
+		// One free-text value per directory or file name keeps paths parseable
+		names := 0
+		last := 0
+		for _, loc := range templatePlaceholder.FindAllStringIndex(segment, -1) {
+			pattern.WriteString(regexp.QuoteMeta(segment[last:loc[0]]))
+			last = loc[1]
+			placeholder := segment[loc[0]:loc[1]]
+			counts[placeholder]++
+			switch placeholder {
+			case placeholderExchange, placeholderInterval, placeholderSymbol:
+				names++
+				pattern.WriteString(`([^/]+)`)
+			case placeholderYear:
+				pattern.WriteString(`(\d{4})`)
+			case placeholderMonth:
+				pattern.WriteString(`(\d{2})`)
+			default:
+				return nil, fmt.Errorf("path template %q has unknown placeholder %s (use {exchange}, {interval}, {symbol}, {year} or {month})", template, placeholder)
+			}
+			l.fields = append(l.fields, placeholder)
+		}
+		if strings.ContainsAny(segment[last:], "{}") {
+			return nil, fmt.Errorf("path template %q has an unclosed placeholder", template)
+		}
+		pattern.WriteString(regexp.QuoteMeta(segment[last:]))
+		if names > 1 {
+			return nil, fmt.Errorf("path template %q has more than one of {exchange}, {interval} and {symbol} in %q", template, segment)
+		}
+	}
+	pattern.WriteString("$")
+
+	for _, placeholder := range []string{placeholderExchange, placeholderInterval, placeholderSymbol} {
+		if counts[placeholder] != 1 {
+			return nil, fmt.Errorf("path template %q must have %s exactly once", template, placeholder)
+		}
+	}
+	if counts[placeholderYear] > 1 || counts[placeholderMonth] > 1 {
+		return nil, fmt.Errorf("path template %q has {year} or {month} more than once", template)
+	}
+	if counts[placeholderMonth] == 1 && counts[placeholderYear] == 0 {
+		return nil, fmt.Errorf("path template %q has {month} without {year}", template)
+	}
+	l.byYear = counts[placeholderYear] == 1
+	l.byMonth = counts[placeholderMonth] == 1
+	l.pattern = regexp.MustCompile(pattern.String())
+	return l, nil
+}
+
+// isDefault reports whether the layout is the default one, which also reads
+// the flat and per-interval layouts and the unescaped names of earlier releases.
+func (l *fileLayout) isDefault() bool {
+	return l.template == DefaultPathTemplate
+}
+
+// period returns the period of the file a candle at t belongs to: "2024" or
+// "2024-03", or "" when the layout has one file per series.
+func (l *fileLayout) period(t time.Time) string {
+	switch {
+	case l.byMonth:
+		return t.In(calendar.IST).Format("2006-01")
+	case l.byYear:
+		return t.In(calendar.IST).Format("2006")
+	default:
+		return ""
+	}
+}
+
+// path returns the file of a period of a series, without compression suffix.
+func (l *fileLayout) path(base string, series Series, period string) string {
+	rel := l.template
+	rel = strings.ReplaceAll(rel, placeholderExchange, escapeName(series.Exchange))
+	rel = strings.ReplaceAll(rel, placeholderInterval, escapeName(series.Interval))
+	rel = strings.ReplaceAll(rel, placeholderSymbol, escapeName(series.Symbol))
+	if l.byYear {
+		rel = strings.ReplaceAll(rel, placeholderYear, period[:4])
+	}
+	if l.byMonth {
+		rel = strings.ReplaceAll(rel, placeholderMonth, period[5:7])
+	}
+	return filepath.Join(base, filepath.FromSlash(rel)) + l.ext
+}
+
+// checkSeries reports a series that cannot be written in the layout: outside
+// the default one, files need both an exchange and an interval.
+func (l *fileLayout) checkSeries(series Series) error {
+	if !l.isDefault() && (series.Exchange == "" || series.Interval == "") {
+		return fmt.Errorf("%s needs an exchange and an interval for path template %s", series, l.template)
+	}
+	return nil
+}
+
+// parse finds the series and period of a file from its path relative to the
+// base directory, with slashes and without compression suffix.
+func (l *fileLayout) parse(rel string) (Series, string, bool) {
+	if !strings.HasSuffix(rel, l.ext) {
+		return Series{}, "", false
+	}
+	rel = strings.TrimSuffix(rel, l.ext)
+	if l.isDefault() {
+		parts := strings.Split(rel, "/")
+		s := Series{Symbol: unescapeName(parts[len(parts)-1])}
+		switch len(parts) {
+		case 1:
+		case 2:
+			s.Interval = unescapeName(parts[0])
+		case 3:
+			s.Exchange, s.Interval = unescapeName(parts[0]), unescapeName(parts[1])
+		default:
+			return Series{}, "", false
+		}
+		return s, "", true
+	}
+
+	match := l.pattern.FindStringSubmatch(rel)
+	if match == nil {
+		return Series{}, "", false
+	}
+	var s Series
+	var year, month string
+	for i, field := range l.fields {
+		value := match[i+1]
+		switch field {
+		case placeholderExchange:
+			s.Exchange = unescapeName(value)
+		case placeholderInterval:
+			s.Interval = unescapeName(value)
+		case placeholderSymbol:
+			s.Symbol = unescapeName(value)
+		case placeholderYear:
+			year = value
+		case placeholderMonth:
+			month = value
+		}
+	}
+	period := year
+	if month != "" {
+		period += "-" + month
+	}
+	return s, period, true
+}
+
+// layoutFile is an existing file of a series.
+type layoutFile struct {
+	path        string
+	period      string
+	compression int // Index in compressionExts
+}
+
+// files returns the existing files of a series, in any compression, ordered
+// by period and uncompressed first. For the default layout, files named with
+// the unescaped symbol by earlier releases come first.
+func (l *fileLayout) files(base string, series Series) ([]layoutFile, error) {
+	var files []layoutFile
+	if !l.byYear {
+		var paths []string
+		if l.isDefault() {
+			legacy := filepath.Join(base, series.Exchange, series.Interval, series.Symbol+l.ext)
+			if legacy != l.path(base, series, "") {
+				paths = append(paths, legacy)
+			}
+		}
+		paths = append(paths, l.path(base, series, ""))
+		for _, p := range paths {
+			for _, compressionExt := range compressionExts {
+				path := p + compressionExt
+				if _, err := os.Stat(path); err == nil {
+					files = append(files, layoutFile{path: path})
+				} else if !os.IsNotExist(err) {
+					return nil, err
+				}
+			}
+		}
+		return files, nil
+	}
+
+	// Periods are found by globbing for their digits
+	pattern := l.template
+	pattern = strings.ReplaceAll(pattern, placeholderExchange, escapeName(series.Exchange))
+	pattern = strings.ReplaceAll(pattern, placeholderInterval, escapeName(series.Interval))
+	pattern = strings.ReplaceAll(pattern, placeholderSymbol, escapeName(series.Symbol))
+	pattern = strings.ReplaceAll(pattern, placeholderYear, "[0-9][0-9][0-9][0-9]")
+	pattern = strings.ReplaceAll(pattern, placeholderMonth, "[0-9][0-9]")
+	for rank, compressionExt := range compressionExts {
+		matches, err := filepath.Glob(filepath.Join(base, filepath.FromSlash(pattern)) + l.ext + compressionExt)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range matches {
+			rel, err := filepath.Rel(base, strings.TrimSuffix(path, compressionExt))
+			if err != nil {
+				return nil, err
+			}
+			s, period, ok := l.parse(filepath.ToSlash(rel))
+			if !ok || s != series {
+				continue
+			}
+			files = append(files, layoutFile{path: path, period: period, compression: rank})
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].period != files[j].period {
+			return files[i].period < files[j].period
+		}
+		return files[i].compression < files[j].compression
+	})
+	return files, nil
+}
+
+// paths returns the paths of the existing files of a series.
+func (l *fileLayout) paths(base string, series Series) ([]string, error) {
+	files, err := l.files(base, series)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	return paths, nil
+}
+
+// periodPaths returns the paths of the existing files of one period of a series.
+func (l *fileLayout) periodPaths(base string, series Series, period string) ([]string, error) {
+	files, err := l.files(base, series)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, f := range files {
+		if f.period == period {
+			paths = append(paths, f.path)
+		}
+	}
+	return paths, nil
+}
+
+// rangePaths returns the paths of the existing files of a series that may
+// hold candles within [from, to]; zero bounds leave that side open. Files of
+// periods outside the range are not read at all.
+func (l *fileLayout) rangePaths(base string, series Series, from, to time.Time) ([]string, error) {
+	files, err := l.files(base, series)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, f := range files {
+		if periodOverlaps(f.period, from, to) {
+			paths = append(paths, f.path)
+		}
+	}
+	return paths, nil
+}
+
+// periodOverlaps reports whether a period ("2024", "2024-03" or "" for a
+// whole series) overlaps [from, to].
+func periodOverlaps(period string, from, to time.Time) bool {
+	var start, end time.Time
+	switch len(period) {
+	case len("2006"):
+		start, _ = time.ParseInLocation("2006", period, calendar.IST)
+		end = start.AddDate(1, 0, 0)
+	case len("2006-01"):
+		start, _ = time.ParseInLocation("2006-01", period, calendar.IST)
+		end = start.AddDate(0, 1, 0)
+	default:
+		return true
+	}
+	return (to.IsZero() || !start.After(to)) && (from.IsZero() || end.After(from))
+}
+
+// list finds the series stored below base, in any compression.
+func (l *fileLayout) list(base string) ([]Series, error) {
+	var series []Series
+	seen := make(map[Series]bool)
+	err := filepath.WalkDir(base, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := trimCompressionExt(d.Name())
+		if d.IsDir() || !strings.HasSuffix(name, l.ext) {
+			return nil
+		}
+		// Metadata (_metadata.json) and hidden files are not series
+		if strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(base, filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			return err
+		}
+		s, _, ok := l.parse(filepath.ToSlash(rel))
+		// A series stored in several files is listed once
+		if ok && !seen[s] {
+			seen[s] = true
+			series = append(series, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortSeries(series)
+	return series, nil
+}
+
+// replace replaces the files of a series, in any compression, by one file
+// per period of data. An empty data removes them.
+func (l *fileLayout) replace(base string, series Series, compression Compression, data map[string][]byte) error {
+	files, err := l.paths(base, series)
+	if err != nil {
+		return fmt.Errorf("failed to find %s files: %v", l.ext, err)
+	}
+	written := make(map[string]bool, len(data))
+	for period, periodData := range data {
+		filePath := l.path(base, series, period) + compression.Ext()
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+		if err := writeFileAtomic(filePath, compression, periodData); err != nil {
+			return fmt.Errorf("failed to replace %s: %v", filePath, err)
+		}
+		written[filePath] = true
+	}
+	for _, f := range files {
+		if written[f] {
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			return fmt.Errorf("failed to remove merged file: %v", err)
+		}
+	}
+	return nil
+}
+
+// splitByPeriod groups candles by the period of their file, keeping their order.
+func splitByPeriod[T any](l *fileLayout, candles []T, timestamp func(T) time.Time) ([]string, map[string][]T) {
+	var periods []string
+	groups := make(map[string][]T)
+	for _, c := range candles {
+		period := l.period(timestamp(c))
+		if _, ok := groups[period]; !ok {
+			periods = append(periods, period)
+		}
+		groups[period] = append(groups[period], c)
+	}
+	sort.Strings(periods)
+	return periods, groups
+}
+
+// escapeName makes a symbol, exchange or interval safe as a file name on
+// every platform, reversibly: bytes other than ASCII letters, digits, '-',
+// '_' and '.' are written as %XX, as is a leading '.' or '_' (hidden and
+// metadata files). "NIFTY 50" becomes NIFTY%2050 and M&M becomes M%26M.
+func escapeName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		safe := c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || (c == '_' || c == '.') && i > 0
+		if safe {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// unescapeName reverses escapeName. A '%' not followed by two hex digits is
+// kept as is, so names written unescaped by earlier releases read back unchanged.
+func unescapeName(name string) string {
+	if !strings.Contains(name, "%") {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '%' && i+2 < len(name) && isHex(name[i+1]) && isHex(name[i+2]) {
+			b.WriteByte(unhex(name[i+1])<<4 | unhex(name[i+2]))
+			i += 2
+			continue
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'A' && c <= 'F' || c >= 'a' && c <= 'f'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	default:
+		return c - '0'
+	}
+}
+
+// PathTemplateMismatchError reports a file store laid out with a different
+// path template than the configuration asks for.
+type PathTemplateMismatchError struct {
+	Path       string
+	Stored     string
+	Configured string
+}
+
+func (e *PathTemplateMismatchError) Error() string {
+	return fmt.Sprintf("%s lays out files as %s, not %s (copy it to a new directory with: zerodha-connect convert --to-path-template %q)",
+		e.Path, e.Stored, e.Configured, e.Configured)
+}
+
+// initFileLayout resolves and records the path template of a file store
+// opened for writing. A store without a record that already holds files is
+// in the default layout; an empty one takes the configured template.
+func initFileLayout(base, configured, ext string, hasData func() (bool, error)) (*fileLayout, error) {
+	want, err := newFileLayout(configured, ext)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := readFileMetadata(base)
+	if err != nil {
+		return nil, err
+	}
+	if meta.PathTemplate != "" {
+		stored, err := newFileLayout(meta.PathTemplate, ext)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Join(base, fileMetadataName), err)
+		}
+		if configured != "" && stored.template != want.template {
+			return nil, &PathTemplateMismatchError{Path: base, Stored: stored.template, Configured: want.template}
+		}
+		return stored, nil
+	}
+	if want.isDefault() {
+		return want, nil
+	}
+	stored, err := hasData()
+	if err != nil {
+		return nil, err
+	}
+	if stored {
+		return nil, &PathTemplateMismatchError{Path: base, Stored: DefaultPathTemplate, Configured: want.template}
+	}
+	meta.PathTemplate = want.template
+	if err := writeFileMetadata(base, meta); err != nil {
+		return nil, err
+	}
+	return want, nil
+}
+
+// fileStoreLayout returns the layout of a file store for reading: the
+// recorded path template, or the default layout.
+func fileStoreLayout(base, ext string) (*fileLayout, error) {
+	meta, err := readFileMetadata(base)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := newFileLayout(meta.PathTemplate, ext)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Join(base, fileMetadataName), err)
+	}
+	return layout, nil
+}
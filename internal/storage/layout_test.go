@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+func TestEscapeName(t *testing.T) {
+	tests := []struct {
+		name    string
+		escaped string
+	}{
+		{"SBIN", "SBIN"},
+		{"NIFTY 50", "NIFTY%2050"},
+		{"M&M", "M%26M"},
+		{"A/B", "A%2FB"},
+		{"%", "%25"},
+		{"100%", "100%25"},
+		{".hidden", "%2Ehidden"},
+		{"_metadata", "%5Fmetadata"},
+		{"BAJAJ-AUTO", "BAJAJ-AUTO"},
+		{"A.B_C", "A.B_C"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := escapeName(tt.name); got != tt.escaped {
+			t.Errorf("escapeName(%q) = %q, want %q", tt.name, got, tt.escaped)
+		}
+		if got := unescapeName(tt.escaped); got != tt.name {
+			t.Errorf("unescapeName(%q) = %q, want %q", tt.escaped, got, tt.name)
+		}
+	}
+}
+
+func TestUnescapeUnescapedName(t *testing.T) {
+	// Names written unescaped by earlier releases read back as they are
+	for _, name := range []string{"M&M", "NIFTY 50", "50%", "%G1", "A%2"} {
+		if got := unescapeName(name); got != name {
+			t.Errorf("unescapeName(%q) = %q, want it unchanged", name, got)
+		}
+	}
+}
+
+func TestNewFileLayoutRejects(t *testing.T) {
+	tests := []struct {
+		template string
+		ext      string
+		err      string
+	}{
+		{"{exchange}/{interval}/{symbol}/{symbol}", ".csv", "{symbol} exactly once"},
+		{"{exchange}/{interval}/{year}/{year}/{symbol}", ".csv", "{year} or {month} more than once"},
+		{"{exchange}/{interval}/{symbol}_{month}", ".csv", "{month} without {year}"},
+		{"{exchange}/../{interval}/{symbol}", ".csv", "empty, . or .. directory"},
+		{"{exchange}/./{interval}/{symbol}", ".csv", "empty, . or .. directory"},
+		{"{exchange}//{interval}/{symbol}", ".csv", "empty, . or .. directory"},
+		{"{exchange}/{interval}/{symbol}.csv", ".jsonl", "ends in .csv, but these files end in .jsonl"},
+		{"/{exchange}/{interval}/{symbol}", ".csv", "must be a relative path"},
+		{"{exchange}/{interval}/{symbol}*", ".csv", "must be a relative path"},
+		{"{exchange}/{interval}-{symbol}", ".csv", "more than one of"},
+		{"{exchange}/{interval}/{name}", ".csv", "unknown placeholder {name}"},
+		{"{exchange}/{interval}/{symbol", ".csv", "unclosed placeholder"},
+		{"{exchange}/{symbol}", ".csv", "{interval} exactly once"},
+	}
+	for _, tt := range tests {
+		_, err := newFileLayout(tt.template, tt.ext)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("newFileLayout(%q, %q) = %v, want an error with %q", tt.template, tt.ext, err, tt.err)
+		}
+	}
+}
+
+func TestNewFileLayoutAccepts(t *testing.T) {
+	for _, tt := range []struct{ template, ext string }{
+		{"", ".csv"},
+		{DefaultPathTemplate, ".jsonl"},
+		{"{exchange}/{interval}/{symbol}.csv", ".csv"},
+		{"{exchange}/{interval}/{year}/{symbol}", ".json"},
+		{"{interval}/{exchange}/{symbol}/{year}-{month}", ".csv"},
+		{"data_{exchange}/{interval}/{symbol}_{year}{month}", ".jsonl"},
+	} {
+		if _, err := newFileLayout(tt.template, tt.ext); err != nil {
+			t.Errorf("newFileLayout(%q, %q): %v", tt.template, tt.ext, err)
+		}
+	}
+}
+
+func TestFileLayoutRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 31, 23, 0, 0, 0, calendar.IST)
+	tests := []struct {
+		template string
+		period   string
+		rel      string // Path of the SBIN file relative to the base directory
+	}{
+		{DefaultPathTemplate, "", "NSE/minute/SBIN.csv"},
+		{"{interval}/{exchange}/{symbol}", "", "minute/NSE/SBIN.csv"},
+		{"{exchange}/{interval}/{year}/{symbol}", "2024", "NSE/minute/2024/SBIN.csv"},
+		{"{exchange}/{interval}/{symbol}/{year}-{month}", "2024-03", "NSE/minute/SBIN/2024-03.csv"},
+		{"{exchange}/{interval}/{symbol}_{year}{month}", "2024-03", "NSE/minute/SBIN_202403.csv"},
+	}
+	base := filepath.Join("data", "csv")
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			l, err := newFileLayout(tt.template, ".csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := l.period(at); got != tt.period {
+				t.Errorf("period = %q, want %q", got, tt.period)
+			}
+			for _, series := range []Series{
+				{Exchange: "NSE", Symbol: "SBIN", Interval: "minute"},
+				{Exchange: "NSE", Symbol: "NIFTY 50", Interval: "minute"},
+				{Exchange: "NSE", Symbol: "M&M", Interval: "minute"},
+				{Exchange: "NFO", Symbol: "A/B", Interval: "day"},
+				{Exchange: "BSE", Symbol: "_X", Interval: "15minute"},
+			} {
+				path := l.path(base, series, tt.period)
+				rel, err := filepath.Rel(base, path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rel = filepath.ToSlash(rel)
+				if series.Symbol == "SBIN" && rel != tt.rel {
+					t.Errorf("path of %s = %q, want %q", series, rel, tt.rel)
+				}
+				got, period, ok := l.parse(rel)
+				if !ok || got != series || period != tt.period {
+					t.Errorf("parse(%q) = %v, %q, %v, want %v, %q", rel, got, period, ok, series, tt.period)
+				}
+			}
+		})
+	}
+}
+
+func TestFileLayoutParseForeignFiles(t *testing.T) {
+	l, err := newFileLayout("{exchange}/{interval}/{symbol}/{year}-{month}", ".csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{
+		"NSE/minute/SBIN/2024-03.jsonl",
+		"NSE/minute/SBIN/2024.csv",
+		"NSE/minute/SBIN/24-03.csv",
+		"NSE/minute/2024-03.csv",
+		"_metadata.json",
+	} {
+		if s, period, ok := l.parse(rel); ok {
+			t.Errorf("parse(%q) = %v, %q, want no match", rel, s, period)
+		}
+	}
+}
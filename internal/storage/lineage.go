@@ -0,0 +1,374 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// Status of a fetch run.
+const (
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+)
+
+// FetchRun records one fetch data run of a job: when it ran, with which
+// config and release, for which user, and what it stored per instrument.
+// Every candle written by the run carries its ID.
+type FetchRun struct {
+	ID          string             `json:"id"`
+	Job         string             `json:"job,omitempty"`
+	Status      string             `json:"status"`
+	StartedAt   time.Time          `json:"started_at"`
+	FinishedAt  time.Time          `json:"finished_at,omitzero"`
+	ConfigHash  string             `json:"config_hash"`
+	ToolVersion string             `json:"tool_version"`
+	UserID      string             `json:"user_id,omitempty"`
+	Results     []InstrumentResult `json:"results,omitempty"`
+}
+
+// InstrumentResult is what a fetch run did for one series.
+type InstrumentResult struct {
+	Series       Series `json:"-"`
+	Candles      int    `json:"candles"`       // Candles returned by the API
+	Stored       int    `json:"stored"`        // Candles written to the store
+	FailedChunks int    `json:"failed_chunks"` // Chunks that could not be fetched or stored
+	Error        string `json:"error,omitempty"`
+}
+
+func (r InstrumentResult) MarshalJSON() ([]byte, error) {
+	type plain InstrumentResult
+	return json.Marshal(struct {
+		Exchange string `json:"exchange"`
+		Symbol   string `json:"symbol"`
+		Interval string `json:"interval"`
+		plain
+	}{r.Series.Exchange, r.Series.Symbol, r.Series.Interval, plain(r)})
+}
+
+func (r *InstrumentResult) UnmarshalJSON(data []byte) error {
+	type plain InstrumentResult
+	var v struct {
+		Exchange string `json:"exchange"`
+		Symbol   string `json:"symbol"`
+		Interval string `json:"interval"`
+		plain
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = InstrumentResult(v.plain)
+	r.Series = Series{Exchange: v.Exchange, Symbol: v.Symbol, Interval: v.Interval}
+	return nil
+}
+
+// NewRunID returns a run ID sorting by start time, e.g. 20240105T091500-3f9a1c.
+func NewRunID(start time.Time) string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return start.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// RunRecorder is implemented by stores keeping the history of the fetch runs
+// that wrote them: databases in fetch_runs and fetch_run_results tables,
+// file stores in a _fetch_runs.jsonl manifest next to the data.
+type RunRecorder interface {
+	// RecordRun records a run, replacing an earlier record with the same ID
+	RecordRun(run FetchRun) error
+
+	// FetchRuns returns the recorded runs, oldest first
+	FetchRuns() ([]FetchRun, error)
+}
+
+// lineage stamps the candles written by a store with the run writing them.
+// The zero value writes no lineage, e.g. for a store opened by convert.
+type lineage struct {
+	runID string
+}
+
+// stamp returns the fetched_at time and run ID of candles written now, or
+// zero values without a run.
+func (l lineage) stamp() (time.Time, string) {
+	if l.runID == "" {
+		return time.Time{}, ""
+	}
+	return time.Now().Truncate(time.Second), l.runID
+}
+
+// candles converts fetched candles to the candles written now, stamped with
+// the lineage of the write and flagged when they are still forming.
+func (l lineage) candles(data []kiteconnect.HistoricalData, complete bool) []Candle {
+	fetchedAt, runID := l.stamp()
+	candles := make([]Candle, len(data))
+	for i, c := range data {
+		candles[i] = Candle{
+			Timestamp:  c.Date.Time,
+			Open:       c.Open,
+			High:       c.High,
+			Low:        c.Low,
+			Close:      c.Close,
+			Volume:     int64(c.Volume),
+			OI:         int64(c.OI),
+			FetchedAt:  fetchedAt,
+			RunID:      runID,
+			Incomplete: !complete,
+		}
+	}
+	return candles
+}
+
+// LineageStorer is implemented by stores that can write candles read from
+// another store as they are: their fetched_at, run ID and is_complete flag
+// are kept instead of being stamped by the write. Convert uses it so that a
+// converted store keeps the lineage of its data.
+type LineageStorer interface {
+	StoreLineageCandles(series Series, candles []Candle) (int, error)
+}
+
+// inIST returns t in IST, keeping the zero time zero.
+func inIST(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.In(calendar.IST)
+}
+
+// inZone returns t in the storage timezone, keeping the zero time zero.
+func inZone(t time.Time, zone Timezone) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.In(zone.Location())
+}
+
+// runManifestFile is the manifest of fetch runs in a file store directory.
+// Its leading underscore keeps it out of the series listing.
+const runManifestFile = "_fetch_runs.jsonl"
+
+// recordFileRun appends a run record to the manifest of a file store. The
+// manifest only grows; the last record of a run ID wins.
+func recordFileRun(base string, run FetchRun) error {
+	line, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode fetch run: %v", err)
+	}
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return err
+	}
+	if err := appendFile(filepath.Join(base, runManifestFile), CompressionNone, append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to record fetch run: %v", err)
+	}
+	return nil
+}
+
+// fileRuns reads the manifest of a file store, keeping the last record of
+// every run. A partial last line left by an interrupted write is ignored.
+func fileRuns(base string) ([]FetchRun, error) {
+	data, err := os.ReadFile(filepath.Join(base, runManifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fetch runs: %v", err)
+	}
+	byID := make(map[string]FetchRun)
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for line := 1; ; line++ {
+		text, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		if len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+		var run FetchRun
+		if err := json.Unmarshal(text, &run); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", runManifestFile, line, err)
+		}
+		byID[run.ID] = run
+	}
+	return sortRuns(byID), nil
+}
+
+// sortRuns returns runs ordered by start time.
+func sortRuns(byID map[string]FetchRun) []FetchRun {
+	runs := make([]FetchRun, 0, len(byID))
+	for _, run := range byID {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].StartedAt.Equal(runs[j].StartedAt) {
+			return runs[i].StartedAt.Before(runs[j].StartedAt)
+		}
+		return runs[i].ID < runs[j].ID
+	})
+	return runs
+}
+
+// createSQLRunTables are the fetch run history tables of a database.
+// Times are RFC 3339 text, which SQLite and DuckDB both compare correctly.
+var createSQLRunTables = []string{`
+	CREATE TABLE IF NOT EXISTS fetch_runs (
+		id VARCHAR PRIMARY KEY,
+		job VARCHAR,
+		status VARCHAR NOT NULL,
+		started_at VARCHAR NOT NULL,
+		finished_at VARCHAR,
+		config_hash VARCHAR,
+		tool_version VARCHAR,
+		user_id VARCHAR
+	);`, `
+	CREATE TABLE IF NOT EXISTS fetch_run_results (
+		run_id VARCHAR NOT NULL,
+		exchange VARCHAR NOT NULL,
+		instrument VARCHAR NOT NULL,
+		"interval" VARCHAR NOT NULL,
+		candles BIGINT,
+		stored BIGINT,
+		failed_chunks BIGINT,
+		error VARCHAR,
+		PRIMARY KEY (run_id, exchange, instrument, "interval")
+	);`,
+}
+
+// sqlExecer is a database or transaction statements are executed on.
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// createRunTables creates the fetch run history tables.
+func createRunTables(db sqlExecer) error {
+	for _, create := range createSQLRunTables {
+		if _, err := db.Exec(create); err != nil {
+			return fmt.Errorf("failed to create fetch run tables: %v", err)
+		}
+	}
+	return nil
+}
+
+// formatRunTime formats a run time for the run tables; zero is NULL.
+func formatRunTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// sqlRecordRun records a run and its results in one transaction, replacing
+// the rows of an earlier record. Results only grow during a run, so no stale
+// result rows are left behind.
+func sqlRecordRun(db *sql.DB, run FetchRun) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("DB transaction error: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT OR REPLACE INTO fetch_runs (id, job, status, started_at, finished_at, config_hash, tool_version, user_id)
+		VALUES (?,?,?,?,?,?,?,?)`,
+		run.ID, run.Job, run.Status, formatRunTime(run.StartedAt), formatRunTime(run.FinishedAt),
+		run.ConfigHash, run.ToolVersion, run.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to record fetch run %s: %v", run.ID, err)
+	}
+	for _, r := range run.Results {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO fetch_run_results (run_id, exchange, instrument, "interval", candles, stored, failed_chunks, error)
+			VALUES (?,?,?,?,?,?,?,?)`,
+			run.ID, r.Series.Exchange, r.Series.Symbol, r.Series.Interval, r.Candles, r.Stored, r.FailedChunks, r.Error)
+		if err != nil {
+			return fmt.Errorf("failed to record results of fetch run %s: %v", run.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit error: %v", err)
+	}
+	return nil
+}
+
+// sqlFetchRuns reads the run history tables, returning no runs when they do
+// not exist yet.
+func sqlFetchRuns(db *sql.DB) ([]FetchRun, error) {
+	rows, err := db.Query(`SELECT id, COALESCE(job, ''), status, started_at, COALESCE(finished_at, ''),
+		COALESCE(config_hash, ''), COALESCE(tool_version, ''), COALESCE(user_id, '') FROM fetch_runs`)
+	if err != nil {
+		if exists, checkErr := sqlTableExists(db, "fetch_runs"); checkErr == nil && !exists {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read fetch runs: %v", err)
+	}
+	byID := make(map[string]FetchRun)
+	for rows.Next() {
+		var run FetchRun
+		var started, finished string
+		if err := rows.Scan(&run.ID, &run.Job, &run.Status, &started, &finished, &run.ConfigHash, &run.ToolVersion, &run.UserID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read fetch run: %v", err)
+		}
+		run.StartedAt, _ = time.Parse(time.RFC3339, started)
+		if finished != "" {
+			run.FinishedAt, _ = time.Parse(time.RFC3339, finished)
+		}
+		byID[run.ID] = run
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results, err := db.Query(`SELECT run_id, exchange, instrument, "interval", COALESCE(candles, 0), COALESCE(stored, 0),
+		COALESCE(failed_chunks, 0), COALESCE(error, '') FROM fetch_run_results ORDER BY run_id, instrument, "interval", exchange`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fetch run results: %v", err)
+	}
+	defer results.Close()
+	for results.Next() {
+		var runID string
+		var r InstrumentResult
+		if err := results.Scan(&runID, &r.Series.Exchange, &r.Series.Symbol, &r.Series.Interval,
+			&r.Candles, &r.Stored, &r.FailedChunks, &r.Error); err != nil {
+			return nil, fmt.Errorf("failed to read fetch run result: %v", err)
+		}
+		if run, ok := byID[runID]; ok {
+			run.Results = append(run.Results, r)
+			byID[runID] = run
+		}
+	}
+	if err := results.Err(); err != nil {
+		return nil, err
+	}
+	return sortRuns(byID), nil
+}
+
+// sqlTableExists reports whether a table exists, in SQLite or DuckDB.
+func sqlTableExists(db *sql.DB, table string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_name = ?", table).Scan(&count)
+	if err != nil {
+		// SQLite has no information_schema
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count)
+	}
+	return count > 0, err
+}
+
+// sqlHasColumn reports whether the ohlcv table has a column, in SQLite or DuckDB.
+func sqlHasColumn(db *sql.DB, column string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('ohlcv') WHERE name = ?", column).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect the ohlcv table: %v", err)
+	}
+	return count > 0, nil
+}
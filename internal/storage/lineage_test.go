@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+// TestStoreLineageCandles writes candles of two fetch runs and one without
+// lineage through a store without a run of its own, as convert does, and
+// expects every backend to read back their lineage unchanged.
+func TestStoreLineageCandles(t *testing.T) {
+	series := Series{Exchange: "NSE", Symbol: "SBIN", Interval: "minute"}
+	fetchedAt := time.Date(2024, 1, 2, 9, 20, 5, 0, calendar.IST)
+	candle := func(minute int, close float64, at time.Time, runID string, incomplete bool) Candle {
+		return Candle{
+			Timestamp:  time.Date(2024, 1, 2, 9, minute, 0, 0, calendar.IST),
+			Open:       close - 1,
+			High:       close + 1,
+			Low:        close - 2,
+			Close:      close,
+			Volume:     int64(close),
+			FetchedAt:  at,
+			RunID:      runID,
+			Incomplete: incomplete,
+		}
+	}
+	candles := []Candle{
+		candle(15, 600, time.Time{}, "", false),
+		candle(16, 610, fetchedAt.Add(-time.Hour), "run-1", false),
+		candle(17, 620, fetchedAt, "run-2", true),
+	}
+
+	for _, backend := range Backends() {
+		t.Run(string(backend.Name), func(t *testing.T) {
+			logger := log.New(io.Discard, "", 0)
+			path := filepath.Join(t.TempDir(), "market_data")
+			store, err := NewStore(backend.Name, path, Options{}, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Init(); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			keeper, ok := store.(LineageStorer)
+			if !ok {
+				t.Fatalf("%s does not store lineage candles", backend.Name)
+			}
+			if n, err := keeper.StoreLineageCandles(series, candles); err != nil || n != len(candles) {
+				t.Fatalf("StoreLineageCandles = %d, %v", n, err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			reader, err := OpenReader(backend.Name, path, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			var got []Candle
+			err = reader.ReadRange(series, time.Time{}, time.Time{}, func(c Candle) error {
+				got = append(got, c)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ReadRange: %v", err)
+			}
+			if len(got) != len(candles) {
+				t.Fatalf("read %d candles, want %d", len(got), len(candles))
+			}
+			for i, c := range got {
+				want := candles[i]
+				if !c.Timestamp.Equal(want.Timestamp) || c.Close != want.Close || !c.FetchedAt.Equal(want.FetchedAt) ||
+					c.RunID != want.RunID || c.Incomplete != want.Incomplete {
+					t.Errorf("candle %d = %s close %v fetched %v run %q incomplete %v, want %s close %v fetched %v run %q incomplete %v",
+						i, c.Timestamp, c.Close, c.FetchedAt, c.RunID, c.Incomplete,
+						want.Timestamp, want.Close, want.FetchedAt, want.RunID, want.Incomplete)
+				}
+			}
+		})
+	}
+}
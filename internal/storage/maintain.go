@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Maintainer is implemented by stores supporting the storage maintain
+// operations. Each returns the number of candles it removes or rewrites;
+// with dryRun it only counts them and changes nothing.
+type Maintainer interface {
+	// Dedupe keeps only the most recently fetched candle of every timestamp
+	// of a series, or the most recently written one without fetched_at
+	Dedupe(series Series, dryRun bool) (int64, error)
+
+	// DeleteRange removes the candles of a series with from <= timestamp <= to.
+	// A zero from or to leaves that side unbounded.
+	DeleteRange(series Series, from, to time.Time, dryRun bool) (int64, error)
+
+	// Vacuum reclaims space: databases are vacuumed or checkpointed, files are
+	// rewritten sorted by timestamp. It returns the number of candles stored.
+	Vacuum(dryRun bool) (int64, error)
+}
+
+// seriesRewriter is a file store whose series are loaded and rewritten whole.
+type seriesRewriter interface {
+	ListSeries() ([]Series, error)
+	load(series Series) ([]Candle, error)
+	rewriteSeries(series Series, candles []Candle) error
+}
+
+// latestCandles returns the candles sorted by timestamp, keeping one candle
+// of every timestamp like sqlDedupe: the most recently fetched one, or the
+// last occurrence among candles without fetched_at or fetched at the same time.
+func latestCandles(candles []Candle) []Candle {
+	latest := make(map[int64]int, len(candles))
+	for i, c := range candles {
+		key := c.Timestamp.Unix()
+		if j, seen := latest[key]; seen && candles[j].FetchedAt.After(c.FetchedAt) {
+			continue
+		}
+		latest[key] = i
+	}
+	kept := make([]Candle, 0, len(latest))
+	for i, c := range candles {
+		if latest[c.Timestamp.Unix()] == i {
+			kept = append(kept, c)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Timestamp.Before(kept[j].Timestamp)
+	})
+	return kept
+}
+
+// dedupeFiles rewrites the files of a series without duplicate timestamps.
+func dedupeFiles(s seriesRewriter, series Series, dryRun bool) (int64, error) {
+	candles, err := s.load(series)
+	if err != nil {
+		return 0, err
+	}
+	kept := latestCandles(candles)
+	removed := int64(len(candles) - len(kept))
+	if dryRun || removed == 0 {
+		return removed, nil
+	}
+	return removed, s.rewriteSeries(series, kept)
+}
+
+// deleteFromFiles rewrites the files of a series without the candles in
+// [from, to], removing them once no candle is left.
+func deleteFromFiles(s seriesRewriter, series Series, from, to time.Time, dryRun bool) (int64, error) {
+	candles, err := s.load(series)
+	if err != nil {
+		return 0, err
+	}
+	var kept []Candle
+	for _, c := range candles {
+		if !inRange(c.Timestamp, from, to) {
+			kept = append(kept, c)
+		}
+	}
+	removed := int64(len(candles) - len(kept))
+	if dryRun || removed == 0 {
+		return removed, nil
+	}
+	return removed, s.rewriteSeries(series, kept)
+}
+
+// vacuumFiles rewrites the files of every series sorted by timestamp, in the
+// store's compression. Partial rows left by interrupted writes are dropped.
+func vacuumFiles(s seriesRewriter, dryRun bool) (int64, error) {
+	all, err := s.ListSeries()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, series := range all {
+		candles, err := s.load(series)
+		if err != nil {
+			return total, err
+		}
+		total += int64(len(candles))
+		if dryRun {
+			continue
+		}
+		sort.SliceStable(candles, func(i, j int) bool {
+			return candles[i].Timestamp.Before(candles[j].Timestamp)
+		})
+		if err := s.rewriteSeries(series, candles); err != nil {
+			return total, fmt.Errorf("%s: %v", series, err)
+		}
+	}
+	return total, nil
+}
+
+// sqlDedupe deletes all but one row of every timestamp of a series from an
+// ohlcv table with a rowid. It keeps the most recently fetched row, or the
+// last inserted one where fetched_at is not recorded.
+func sqlDedupe(db *sql.DB, ts sqlDialect, series Series, dryRun bool) (int64, error) {
+	args := seriesArgs(series)
+	var duplicates int64
+	query := "SELECT COUNT(*) - COUNT(DISTINCT timestamp) FROM ohlcv WHERE " + ts.seriesFilter
+	if err := db.QueryRow(query, args...).Scan(&duplicates); err != nil {
+		return 0, fmt.Errorf("failed to count duplicates of %s: %v", series, err)
+	}
+	if dryRun || duplicates == 0 {
+		return duplicates, nil
+	}
+	order := "rowid DESC"
+	if ts.lineage {
+		order = "fetched_at DESC NULLS LAST, rowid DESC"
+	}
+	remove := "DELETE FROM ohlcv WHERE " + ts.seriesFilter + ` AND rowid NOT IN (
+		SELECT id FROM (
+			SELECT rowid AS id, row_number() OVER (PARTITION BY timestamp ORDER BY ` + order + `) AS rn
+			FROM ohlcv WHERE ` + ts.seriesFilter + `
+		)
+		WHERE rn = 1)`
+	result, err := db.Exec(remove, append(args, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove duplicates of %s: %v", series, err)
+	}
+	return result.RowsAffected()
+}
+
+// sqlDeleteRange deletes the rows of a series with from <= timestamp <= to.
+func sqlDeleteRange(db *sql.DB, ts sqlDialect, series Series, from, to time.Time, dryRun bool) (int64, error) {
+	where := ts.seriesFilter
+	args := seriesArgs(series)
+	if !from.IsZero() {
+		where += " AND timestamp >= ?"
+		args = append(args, ts.bind(from))
+	}
+	if !to.IsZero() {
+		where += " AND timestamp <= ?"
+		args = append(args, ts.bind(to))
+	}
+	if dryRun {
+		var rows int64
+		if err := db.QueryRow("SELECT COUNT(*) FROM ohlcv WHERE "+where, args...).Scan(&rows); err != nil {
+			return 0, fmt.Errorf("failed to count candles of %s: %v", series, err)
+		}
+		return rows, nil
+	}
+	result, err := db.Exec("DELETE FROM ohlcv WHERE "+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete candles of %s: %v", series, err)
+	}
+	return result.RowsAffected()
+}
+
+// sqlRowCount returns the number of rows of the ohlcv table.
+func sqlRowCount(db *sql.DB) (int64, error) {
+	var rows int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM ohlcv").Scan(&rows); err != nil {
+		return 0, fmt.Errorf("failed to count candles: %v", err)
+	}
+	return rows, nil
+}
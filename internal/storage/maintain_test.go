@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+func TestLatestCandles(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2024, 1, 2, 9, minute, 0, 0, calendar.IST) }
+	fetched := func(hour int) time.Time { return time.Date(2024, 1, 2, hour, 0, 0, 0, calendar.IST) }
+	candles := []Candle{
+		// Refetched later, but written first: the write order must not win
+		{Timestamp: at(15), Close: 602, FetchedAt: fetched(18)},
+		{Timestamp: at(15), Close: 600, FetchedAt: fetched(16)},
+		{Timestamp: at(15), Close: 599},
+		// Without fetched_at, the last written candle wins
+		{Timestamp: at(17), Close: 611},
+		{Timestamp: at(16), Close: 610},
+		{Timestamp: at(17), Close: 612},
+		// Fetched at the same time, the last written candle wins
+		{Timestamp: at(18), Close: 620, FetchedAt: fetched(16)},
+		{Timestamp: at(18), Close: 621, FetchedAt: fetched(16)},
+		// A candle with fetched_at wins over a later one without
+		{Timestamp: at(19), Close: 630, FetchedAt: fetched(16)},
+		{Timestamp: at(19), Close: 631},
+	}
+	want := []float64{602, 610, 612, 621, 630}
+
+	kept := latestCandles(candles)
+	if len(kept) != len(want) {
+		t.Fatalf("kept %d candles, want %d: %+v", len(kept), len(want), kept)
+	}
+	for i, c := range kept {
+		if c.Close != want[i] || (i > 0 && !kept[i-1].Timestamp.Before(c.Timestamp)) {
+			t.Errorf("candle %d = %s close %v, want close %v in timestamp order", i, c.Timestamp.Format(time.Kitchen), c.Close, want[i])
+		}
+	}
+}
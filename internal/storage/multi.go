@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// FailurePolicy decides what a failed write to one target of a MultiStore does.
+type FailurePolicy string
+
+const (
+	// FailRun makes the write return an error, so the caller can abort the run
+	FailRun FailurePolicy = "fail"
+	// ContinueRun logs the failure and keeps writing the other targets
+	ContinueRun FailurePolicy = "continue"
+)
+
+// Target is one store written by a MultiStore.
+type Target struct {
+	Name   string
+	Store  Store
+	Policy FailurePolicy
+}
+
+// TargetStats reports what a MultiStore wrote to one of its targets.
+type TargetStats struct {
+	Name     string
+	Policy   FailurePolicy
+	Inserted int
+	Failures int   // Failed writes, or 1 when the target could not be initialized
+	LastErr  error // Most recent failure
+	Disabled bool  // Init failed, so the target was skipped
+}
+
+// TargetError is returned by a MultiStore when a target with the FailRun
+// policy could not be initialized or written.
+type TargetError struct {
+	Target string
+	Err    error
+}
+
+func (e *TargetError) Error() string {
+	return fmt.Sprintf("storage target %s: %v", e.Target, e.Err)
+}
+
+func (e *TargetError) Unwrap() error {
+	return e.Err
+}
+
+// MultiStore is a Store writing every chunk to several stores. Each chunk is
+// offered to all targets, even when an earlier one fails; failures of
+// ContinueRun targets are only logged and counted.
+type MultiStore struct {
+	targets []Target
+	stats   []TargetStats
+	logger  *log.Logger
+}
+
+// NewMultiStore creates a store writing to every target, in order. The first
+// target is the primary one whose inserted count StoreCandles returns.
+func NewMultiStore(targets []Target, logger *log.Logger) *MultiStore {
+	stats := make([]TargetStats, len(targets))
+	for i, t := range targets {
+		stats[i] = TargetStats{Name: t.Name, Policy: t.Policy}
+	}
+	return &MultiStore{targets: targets, stats: stats, logger: logger}
+}
+
+// Init initializes every target. A ContinueRun target that fails is disabled
+// for the rest of the run.
+func (m *MultiStore) Init() error {
+	for i, t := range m.targets {
+		if err := t.Store.Init(); err != nil {
+			if t.Policy != ContinueRun {
+				return &TargetError{Target: t.Name, Err: err}
+			}
+			m.logger.Printf("⚠️  Storage target %s disabled: %v", t.Name, err)
+			m.stats[i].Failures++
+			m.stats[i].LastErr = err
+			m.stats[i].Disabled = true
+		}
+	}
+	return nil
+}
+
+// StoreCandles writes the candles to every enabled target. It returns the
+// count inserted by the first target that succeeded, and a *TargetError for
+// the first FailRun target that failed.
+func (m *MultiStore) StoreCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return m.storeCandles(series, candles, true)
+}
+
+// StoreIncompleteCandles writes candles still forming to every enabled
+// target that can flag them; the other targets drop them.
+func (m *MultiStore) StoreIncompleteCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return m.storeCandles(series, candles, false)
+}
+
+func (m *MultiStore) storeCandles(series Series, candles []kiteconnect.HistoricalData, complete bool) (int, error) {
+	inserted := -1
+	var fatal error
+	for i, t := range m.targets {
+		if m.stats[i].Disabled {
+			continue
+		}
+		var n int
+		var err error
+		if complete {
+			n, err = t.Store.StoreCandles(series, candles)
+		} else if flagger, ok := t.Store.(IncompleteStorer); ok {
+			n, err = flagger.StoreIncompleteCandles(series, candles)
+		} else {
+			continue
+		}
+		if err != nil {
+			m.stats[i].Failures++
+			m.stats[i].LastErr = err
+			m.logger.Printf("⚠️  Storage target %s failed for %s:%s: %v", t.Name, series.Exchange, series.Symbol, err)
+			if t.Policy != ContinueRun && fatal == nil {
+				fatal = &TargetError{Target: t.Name, Err: err}
+			}
+			continue
+		}
+		m.stats[i].Inserted += n
+		if inserted < 0 {
+			inserted = n
+		}
+	}
+	if inserted < 0 {
+		inserted = 0
+	}
+	return inserted, fatal
+}
+
+// RecordRun records the run in every enabled target keeping a run history.
+// Failures follow the policy of the target, like failed writes.
+func (m *MultiStore) RecordRun(run FetchRun) error {
+	var fatal error
+	for i, t := range m.targets {
+		recorder, ok := t.Store.(RunRecorder)
+		if !ok || m.stats[i].Disabled {
+			continue
+		}
+		if err := recorder.RecordRun(run); err != nil {
+			m.logger.Printf("⚠️  Storage target %s failed to record run %s: %v", t.Name, run.ID, err)
+			if t.Policy != ContinueRun && fatal == nil {
+				fatal = &TargetError{Target: t.Name, Err: err}
+			}
+		}
+	}
+	return fatal
+}
+
+// FetchRuns returns the run history of the first target keeping one.
+func (m *MultiStore) FetchRuns() ([]FetchRun, error) {
+	for i, t := range m.targets {
+		if recorder, ok := t.Store.(RunRecorder); ok && !m.stats[i].Disabled {
+			return recorder.FetchRuns()
+		}
+	}
+	return nil, nil
+}
+
+// Stats returns the inserted and failure counts of every target.
+func (m *MultiStore) Stats() []TargetStats {
+	return append([]TargetStats(nil), m.stats...)
+}
+
+// Close closes every target and returns the first error.
+func (m *MultiStore) Close() error {
+	var first error
+	for _, t := range m.targets {
+		if err := t.Store.Close(); err != nil && first == nil {
+			first = &TargetError{Target: t.Name, Err: err}
+		}
+	}
+	return first
+}
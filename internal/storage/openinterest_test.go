@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// oiCandle returns a futures candle at 09:minute on 2 January 2024.
+func oiCandle(minute int, oi int) kiteconnect.HistoricalData {
+	return kiteconnect.HistoricalData{
+		Date:   models.Time{Time: time.Date(2024, 1, 2, 9, minute, 0, 0, calendar.IST)},
+		Open:   21700,
+		High:   21720,
+		Low:    21690,
+		Close:  21710,
+		Volume: 1200,
+		OI:     oi,
+	}
+}
+
+// readOI reads back the open interest of every candle of a series.
+func readOI(t *testing.T, reader Reader, series Series) []int64 {
+	t.Helper()
+	var got []int64
+	err := reader.ReadRange(series, time.Time{}, time.Time{}, func(c Candle) error {
+		got = append(got, c.OI)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadRange: %v", err)
+	}
+	return got
+}
+
+// TestOpenInterest expects every backend to store the open interest of
+// candles fetched with oi: true and read it back.
+func TestOpenInterest(t *testing.T) {
+	series := Series{Exchange: "NFO", Symbol: "NIFTY24JANFUT", Interval: "minute"}
+	candles := []kiteconnect.HistoricalData{oiCandle(15, 12500000), oiCandle(16, 12512350), oiCandle(17, 0)}
+
+	for _, backend := range Backends() {
+		t.Run(string(backend.Name), func(t *testing.T) {
+			logger := log.New(io.Discard, "", 0)
+			path := filepath.Join(t.TempDir(), "market_data")
+			store, err := NewStore(backend.Name, path, Options{RunID: "run-1"}, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Init(); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			if _, err := store.StoreCandles(series, candles); err != nil {
+				t.Fatalf("StoreCandles: %v", err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			reader, err := OpenReader(backend.Name, path, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			if got, want := readOI(t, reader, series), []int64{12500000, 12512350, 0}; !slices.Equal(got, want) {
+				t.Errorf("oi = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestOpenInterestEarlierStores opens stores written before oi was stored:
+// their candles read back without open interest, and the next write adds
+// the column.
+func TestOpenInterestEarlierStores(t *testing.T) {
+	series := Series{Exchange: "NFO", Symbol: "NIFTY24JANFUT", Interval: "minute"}
+	logger := log.New(io.Discard, "", 0)
+	exec := func(t *testing.T, driver, path string, statements ...string) {
+		db, err := sql.Open(driver, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		for _, statement := range statements {
+			if _, err := db.Exec(statement); err != nil {
+				t.Fatalf("%s: %v", statement, err)
+			}
+		}
+	}
+	tests := []struct {
+		storageType StorageType
+		forget      func(t *testing.T, path string) // Removes the oi column
+		check       func(t *testing.T, path string) // Checks the column is back
+	}{
+		{StorageTypeCSV, func(t *testing.T, path string) {
+			file := filepath.Join(path, "NFO", "minute", "NIFTY24JANFUT.csv")
+			records := readCSVFile(t, file)
+			column := slices.Index(records[0], "oi")
+			if column < 0 {
+				t.Fatalf("header %v has no oi column", records[0])
+			}
+			for i, record := range records {
+				records[i] = slices.Delete(record, column, column+1)
+			}
+			var buf bytes.Buffer
+			if err := csv.NewWriter(&buf).WriteAll(records); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, func(t *testing.T, path string) {
+			header := readCSVFile(t, filepath.Join(path, "NFO", "minute", "NIFTY24JANFUT.csv"))[0]
+			if want := csvHeader(true); !slices.Equal(header, want) {
+				t.Errorf("header = %v, want %v", header, want)
+			}
+		}},
+		{StorageTypeDuckDB, func(t *testing.T, path string) {
+			exec(t, "duckdb", path, "ALTER TABLE ohlcv DROP COLUMN oi", "ALTER TABLE ohlcv_staging DROP COLUMN oi")
+		}, func(t *testing.T, path string) {
+			db, err := sql.Open("duckdb", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if present, err := sqlHasColumn(db, "oi"); err != nil || !present {
+				t.Errorf("oi column present = %v, %v", present, err)
+			}
+		}},
+		{StorageTypeSQLite, func(t *testing.T, path string) {
+			exec(t, "sqlite3", path, "ALTER TABLE ohlcv DROP COLUMN oi", "UPDATE schema_migrations SET version = 5 WHERE version = 6")
+		}, func(t *testing.T, path string) {
+			store, err := NewSQLiteStore(path, Options{}, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if version, err := store.schemaVersion(); err != nil || version != SQLiteSchemaVersion {
+				t.Errorf("schema version = %d, %v, want %d", version, err, SQLiteSchemaVersion)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.storageType), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "market_data")
+			write := func(candle kiteconnect.HistoricalData) {
+				t.Helper()
+				store, err := NewStore(tt.storageType, path, Options{RunID: "run-1"}, logger)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := store.Init(); err != nil {
+					t.Fatalf("Init: %v", err)
+				}
+				if _, err := store.StoreCandles(series, []kiteconnect.HistoricalData{candle}); err != nil {
+					t.Fatalf("StoreCandles: %v", err)
+				}
+				if err := store.Close(); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+			}
+			write(oiCandle(15, 12500000))
+			tt.forget(t, path)
+
+			reader, err := OpenReader(tt.storageType, path, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readOI(t, reader, series); !slices.Equal(got, []int64{0}) {
+				t.Errorf("oi before the next write = %v, want [0]", got)
+			}
+			reader.Close()
+
+			write(oiCandle(16, 12512350))
+			tt.check(t, path)
+			reader, err = OpenReader(tt.storageType, path, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			if got, want := readOI(t, reader, series), []int64{0, 12512350}; !slices.Equal(got, want) {
+				t.Errorf("oi after the next write = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// readCSVFile reads all records of an uncompressed CSV file.
+func readCSVFile(t *testing.T, file string) [][]string {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
@@ -0,0 +1,659 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+
+	_ "github.com/marcboeker/go-duckdb"
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+)
+
+// parquetDataFile is the name of the compacted file of a partition.
+const parquetDataFile = "data.parquet"
+
+// ParquetStore provides a storage interface for Hive-partitioned Parquet files:
+//
+//	<base>/exchange=NSE/symbol=SBIN/interval=minute/year=2024/data.parquet
+//
+// Every StoreCandles call adds part files to the year partitions it touches,
+// and Close compacts each touched partition into a single sorted,
+// de-duplicated data.parquet. Appends therefore only ever rewrite the years
+// they write to, never an instrument's whole history. Files are written and
+// compacted through an in-memory DuckDB connection.
+//
+// Timestamps are TIMESTAMPTZ values, which Parquet stores adjusted to UTC;
+// _metadata.json records UTC as the storage timezone.
+//
+// Rows written by a fetch run carry fetched_at, run_id and is_complete
+// columns; files of earlier releases without them read as NULL. Compaction
+// keeps the latest row per timestamp, which replaces candles flagged
+// is_complete=false. The runs are recorded in
+// _fetch_runs.jsonl.
+type ParquetStore struct {
+	basePath string
+	timezone Timezone
+	lineage  lineage
+	db       *sql.DB
+	logger   *log.Logger
+	touched  map[string]bool
+	seq      int
+}
+
+// NewParquetStore creates a new Parquet store.
+func NewParquetStore(basePath string, opts Options, logger *log.Logger) (*ParquetStore, error) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		return nil, fmt.Errorf("duckdb connection failed: %v", err)
+	}
+	// Staging tables live in the in-memory database of a single connection
+	db.SetMaxOpenConns(1)
+	return &ParquetStore{basePath: basePath, timezone: opts.Timezone, lineage: lineage{runID: opts.RunID},
+		db: db, logger: logger, touched: make(map[string]bool)}, nil
+}
+
+func init() {
+	Register(Backend{
+		Name: StorageTypeParquet,
+		New:  constructor(NewParquetStore),
+		Schema: Schema{
+			DefaultPath: "data/parquet",
+			Directory:   true,
+		},
+		Description: Description{
+			Title:   "🧱 Parquet",
+			BestFor: "Research stacks (DuckDB, Polars, Spark, pandas)",
+			Format:  "Hive-partitioned files (exchange=/symbol=/interval=/year=)",
+			Pros:    "Typed columnar data, compressed, appends only rewrite touched years",
+			Cons:    "Not human-readable, needs a Parquet-aware tool",
+		},
+	})
+}
+
+// Init initializes the storage directory and the staging table.
+func (s *ParquetStore) Init() error {
+	if s.timezone != "" && s.timezone != TimezoneUTC {
+		return fmt.Errorf("Parquet stores UTC-adjusted timestamps; storage timezone %s is not supported", s.timezone)
+	}
+	if err := os.MkdirAll(s.basePath, 0755); err != nil {
+		return fmt.Errorf("failed to create Parquet storage directory: %v", err)
+	}
+	meta, err := readFileMetadata(s.basePath)
+	if err != nil {
+		return err
+	}
+	if meta.Timezone == "" {
+		if err := writeFileMetadata(s.basePath, fileMetadata{Timezone: TimezoneUTC}); err != nil {
+			return err
+		}
+	}
+	createTable := `
+	CREATE TABLE IF NOT EXISTS staging (
+		timestamp TIMESTAMPTZ,
+		open DOUBLE,
+		high DOUBLE,
+		low DOUBLE,
+		close DOUBLE,
+		volume BIGINT,
+		oi BIGINT,
+		fetched_at TIMESTAMPTZ,
+		run_id VARCHAR,
+		is_complete BOOLEAN
+	);`
+	if _, err := s.db.Exec(createTable); err != nil {
+		return fmt.Errorf("failed to create Parquet staging table: %v", err)
+	}
+	s.logger.Printf("✅ Parquet storage directory ready: %s", s.basePath)
+	return nil
+}
+
+// partitionDir returns the directory holding one year of a series.
+func (s *ParquetStore) partitionDir(series Series, year int) string {
+	return filepath.Join(s.basePath,
+		"exchange="+series.Exchange,
+		"symbol="+series.Symbol,
+		"interval="+series.Interval,
+		fmt.Sprintf("year=%d", year))
+}
+
+// StoreCandles writes the candles as new part files, one per year they span.
+func (s *ParquetStore) StoreCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, true))
+}
+
+// StoreIncompleteCandles writes candles still forming, flagged
+// is_complete=false, to be replaced by the next write of their timestamps.
+func (s *ParquetStore) StoreIncompleteCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, false))
+}
+
+// StoreLineageCandles writes candles keeping their lineage.
+func (s *ParquetStore) StoreLineageCandles(series Series, candles []Candle) (int, error) {
+	return s.storeCandles(series, candles)
+}
+
+func (s *ParquetStore) storeCandles(series Series, candles []Candle) (int, error) {
+	if series.Exchange == "" || series.Symbol == "" || series.Interval == "" {
+		return 0, fmt.Errorf("parquet storage needs exchange, symbol and interval (got %q, %q, %q)",
+			series.Exchange, series.Symbol, series.Interval)
+	}
+
+	byYear := make(map[int][]Candle)
+	for _, c := range candles {
+		year := c.Timestamp.In(calendar.IST).Year()
+		byYear[year] = append(byYear[year], c)
+	}
+
+	var inserted int
+	for year, yearCandles := range byYear {
+		dir := s.partitionDir(series, year)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return inserted, fmt.Errorf("failed to create partition directory: %v", err)
+		}
+		n, err := s.writePart(dir, yearCandles)
+		if err != nil {
+			return inserted, err
+		}
+		s.touched[dir] = true
+		inserted += n
+	}
+
+	s.logger.Printf("📄 Stored %d candles for %s:%s (%s) in %d partition(s)",
+		inserted, series.Exchange, series.Symbol, series.Interval, len(byYear))
+	return inserted, nil
+}
+
+// writePart stages candles and copies them to a new part file in dir.
+func (s *ParquetStore) writePart(dir string, candles []Candle) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("DB transaction error: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM staging"); err != nil {
+		return 0, fmt.Errorf("failed to reset staging table: %v", err)
+	}
+	stmt, err := tx.Prepare("INSERT INTO staging VALUES (to_timestamp(?),?,?,?,?,?,?,to_timestamp(?),?,?)")
+	if err != nil {
+		return 0, fmt.Errorf("DB prepare error: %v", err)
+	}
+	defer stmt.Close()
+
+	var inserted int
+	for _, c := range candles {
+		var fetchedAt, runID, isComplete interface{}
+		if !c.FetchedAt.IsZero() {
+			fetchedAt = c.FetchedAt.Unix()
+		}
+		if c.RunID != "" {
+			runID = c.RunID
+		}
+		if value := storedIsComplete(c); value != nil {
+			isComplete = *value
+		}
+		_, err := stmt.Exec(c.Timestamp.Unix(), c.Open, c.High, c.Low, c.Close, c.Volume, c.OI, fetchedAt, runID, isComplete)
+		if err != nil {
+			s.logger.Printf("      \\_ Insert error: %v, for candle %+v", err, c)
+		} else {
+			inserted++
+		}
+	}
+
+	// Part names sort by write time, so later writes win during compaction
+	s.seq++
+	part := filepath.Join(dir, fmt.Sprintf("part-%d-%06d.parquet", time.Now().UnixNano(), s.seq))
+	copySQL := fmt.Sprintf("COPY (SELECT * FROM staging ORDER BY timestamp) TO %s (FORMAT PARQUET, COMPRESSION ZSTD)",
+		sqlString(part))
+	if _, err := tx.Exec(copySQL); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %v", part, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit error: %v", err)
+	}
+	return inserted, nil
+}
+
+// Compact merges the part files of every partition written by this store
+// into its data.parquet, keeping the most recently fetched row per timestamp.
+func (s *ParquetStore) Compact() error {
+	dirs := make([]string, 0, len(s.touched))
+	for dir := range s.touched {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		if err := s.compactPartition(dir); err != nil {
+			return err
+		}
+		delete(s.touched, dir)
+	}
+	return nil
+}
+
+func (s *ParquetStore) compactPartition(dir string) error {
+	parts, err := filepath.Glob(filepath.Join(dir, "part-*.parquet"))
+	if err != nil || len(parts) == 0 {
+		return err
+	}
+	return s.rewritePartition(dir, "")
+}
+
+// rewritePartition merges the files of a partition into its data.parquet,
+// keeping the most recently fetched (or written) row per timestamp and dropping the rows
+// matching exclude, a SQL condition. A partition left without rows is removed.
+func (s *ParquetStore) rewritePartition(dir, exclude string) error {
+	parts, err := filepath.Glob(filepath.Join(dir, "part-*.parquet"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(parts)
+
+	// data.parquet sorts before the part files, i.e. it holds the oldest rows
+	files := parts
+	dataFile := filepath.Join(dir, parquetDataFile)
+	if _, err := os.Stat(dataFile); err == nil {
+		files = append([]string{dataFile}, parts...)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(files))
+	for i, f := range files {
+		quoted[i] = sqlString(f)
+	}
+	list := "[" + strings.Join(quoted, ", ") + "]"
+	lineageColumns, err := s.lineageColumns(list)
+	if err != nil {
+		return err
+	}
+
+	keep := "true"
+	if exclude != "" {
+		keep = "NOT (" + exclude + ")"
+	}
+	tmpFile := filepath.Join(dir, "data.tmp")
+	compactSQL := fmt.Sprintf(`
+	COPY (
+		SELECT %s FROM (%s)
+		WHERE %s
+		ORDER BY timestamp
+	) TO %s (FORMAT PARQUET, COMPRESSION ZSTD)`,
+		parquetColumns, latestRows(list, lineageColumns), keep, sqlString(tmpFile))
+	if _, err := s.db.Exec(compactSQL); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to compact %s: %v", dir, err)
+	}
+	var rows int64
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM read_parquet(" + sqlString(tmpFile) + ")").Scan(&rows); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to read %s: %v", tmpFile, err)
+	}
+	if rows == 0 {
+		s.logger.Printf("🗑️  Removed emptied partition %s", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		// Drop the symbol and interval directories too once they are empty
+		for parent := filepath.Dir(dir); parent != s.basePath && len(parent) > len(s.basePath); parent = filepath.Dir(parent) {
+			if os.Remove(parent) != nil {
+				break
+			}
+		}
+		return nil
+	}
+	if err := os.Rename(tmpFile, dataFile); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", dataFile, err)
+	}
+	for _, part := range parts {
+		if err := os.Remove(part); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", part, err)
+		}
+	}
+	s.logger.Printf("🗜️  Compacted %d file(s) in %s", len(files), dir)
+	return nil
+}
+
+// StoredTimezone returns UTC, the zone Parquet timestamps are adjusted to.
+func (s *ParquetStore) StoredTimezone() (Timezone, error) {
+	return TimezoneUTC, nil
+}
+
+// ConvertTimezone accepts only UTC, the zone Parquet timestamps are adjusted to.
+func (s *ParquetStore) ConvertTimezone(to Timezone) error {
+	if to != TimezoneUTC {
+		return fmt.Errorf("Parquet stores UTC-adjusted timestamps; storage timezone %s is not supported", to)
+	}
+	return nil
+}
+
+// ListSeries lists the stored instrument/interval combinations.
+func (s *ParquetStore) ListSeries() ([]Series, error) {
+	dirs, err := filepath.Glob(filepath.Join(s.basePath, "exchange=*", "symbol=*", "interval=*"))
+	if err != nil {
+		return nil, err
+	}
+	var series []Series
+	for _, dir := range dirs {
+		interval := filepath.Base(dir)
+		symbol := filepath.Base(filepath.Dir(dir))
+		exchange := filepath.Base(filepath.Dir(filepath.Dir(dir)))
+		series = append(series, Series{
+			Exchange: strings.TrimPrefix(exchange, "exchange="),
+			Symbol:   strings.TrimPrefix(symbol, "symbol="),
+			Interval: strings.TrimPrefix(interval, "interval="),
+		})
+	}
+	sortSeries(series)
+	return series, nil
+}
+
+// seriesFiles returns the Parquet files of all year partitions of a series
+// as a DuckDB list literal, or "" if there are none.
+func (s *ParquetStore) seriesFiles(series Series) (string, error) {
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(s.partitionDir(series, 0)), "year=*", "*.parquet"))
+	if err != nil || len(files) == 0 {
+		return "", err
+	}
+	quoted := make([]string, len(files))
+	for i, f := range files {
+		quoted[i] = sqlString(f)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]", nil
+}
+
+// parquetColumns are the columns of the candles read from Parquet files.
+const parquetColumns = "timestamp, open, high, low, close, volume, oi, fetched_at, run_id, is_complete"
+
+// latestRows returns a query over a DuckDB list of Parquet files that keeps
+// one row per timestamp: like sqlDedupe, the most recently fetched one, then
+// the one of the latest file. Files are listed oldest first, data.parquet
+// before the part files of later writes, so that readers see the candles a
+// compaction would keep.
+func latestRows(files, lineageColumns string) string {
+	return fmt.Sprintf(`
+		SELECT * FROM (
+			SELECT *, row_number() OVER (
+				PARTITION BY timestamp ORDER BY fetched_at DESC NULLS LAST, file_index DESC
+			) AS rn
+			FROM (
+				SELECT timestamp, open, high, low, close, volume, oi, %s, list_position(%s, filename) AS file_index
+				FROM read_parquet(%s, filename = true, union_by_name = true)
+			)
+		)
+		WHERE rn = 1`, lineageColumns, files, files)
+}
+
+// parquetLineageColumns are the optional columns of the Parquet files, with
+// their types.
+var parquetLineageColumns = [][2]string{{"fetched_at", "TIMESTAMPTZ"}, {"run_id", "VARCHAR"}, {"is_complete", "BOOLEAN"}}
+
+// lineageColumns returns the fetched_at, run_id and is_complete select list
+// for a DuckDB list of Parquet files, with NULL for a column none of them
+// has. Files are read by name, so that files without a column read as NULL.
+func (s *ParquetStore) lineageColumns(files string) (string, error) {
+	rows, err := s.db.Query(fmt.Sprintf("SELECT DISTINCT name FROM parquet_schema(%s)", files))
+	if err != nil {
+		return "", fmt.Errorf("failed to read Parquet schema: %v", err)
+	}
+	defer rows.Close()
+	present := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return "", fmt.Errorf("failed to read Parquet schema: %v", err)
+		}
+		present[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	columns := make([]string, len(parquetLineageColumns))
+	for i, column := range parquetLineageColumns {
+		columns[i] = column[0]
+		if !present[column[0]] {
+			columns[i] = fmt.Sprintf("NULL::%s AS %s", column[1], column[0])
+		}
+	}
+	return strings.Join(columns, ", "), nil
+}
+
+// SeriesFiles returns the data and pending part files of every year
+// partition of a series.
+func (s *ParquetStore) SeriesFiles(series Series) ([]string, error) {
+	dirs, err := s.partitionDirs(&series)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, dir := range dirs {
+		dirFiles, err := filepath.Glob(filepath.Join(dir, "*.parquet"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, dirFiles...)
+	}
+	return files, nil
+}
+
+// Coverage reports the first and last timestamp and the row count of a series.
+func (s *ParquetStore) Coverage(series Series) (Coverage, error) {
+	cov := Coverage{Series: series}
+	files, err := s.seriesFiles(series)
+	if err != nil || files == "" {
+		return cov, err
+	}
+	lineageColumns, err := s.lineageColumns(files)
+	if err != nil {
+		return cov, err
+	}
+	var first, last, fetched sql.NullTime
+	query := fmt.Sprintf("SELECT MIN(timestamp), MAX(timestamp), COUNT(*), MAX(fetched_at) FROM (%s)",
+		latestRows(files, lineageColumns))
+	if err := s.db.QueryRow(query).Scan(&first, &last, &cov.Rows, &fetched); err != nil {
+		return cov, fmt.Errorf("failed to read coverage of %s: %v", series, err)
+	}
+	cov.First, cov.Last = first.Time.In(calendar.IST), last.Time.In(calendar.IST)
+	if fetched.Valid {
+		cov.LastFetched = fetched.Time.In(calendar.IST)
+	}
+	return cov, nil
+}
+
+// ReadRange streams the candles of a series in timestamp order.
+func (s *ParquetStore) ReadRange(series Series, from, to time.Time, fn func(Candle) error) error {
+	files, err := s.seriesFiles(series)
+	if err != nil || files == "" {
+		return err
+	}
+
+	lineageColumns, err := s.lineageColumns(files)
+	if err != nil {
+		return err
+	}
+
+	// Bounds are passed as epoch seconds so that no session time zone is involved
+	query := fmt.Sprintf("SELECT %s FROM (%s) WHERE true", parquetColumns, latestRows(files, lineageColumns))
+	var args []interface{}
+	if !from.IsZero() {
+		query += " AND timestamp >= to_timestamp(?)"
+		args = append(args, float64(from.UnixMicro())/1e6)
+	}
+	if !to.IsZero() {
+		query += " AND timestamp <= to_timestamp(?)"
+		args = append(args, float64(to.UnixMicro())/1e6)
+	}
+	query += " ORDER BY timestamp"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", series, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Candle
+		var volume, oi sql.NullInt64
+		var fetchedAt sql.NullTime
+		var runID sql.NullString
+		var complete sql.NullBool
+		if err := rows.Scan(&c.Timestamp, &c.Open, &c.High, &c.Low, &c.Close, &volume, &oi, &fetchedAt, &runID, &complete); err != nil {
+			return fmt.Errorf("failed to read candle of %s: %v", series, err)
+		}
+		c.Timestamp = c.Timestamp.In(calendar.IST)
+		c.Volume, c.OI = volume.Int64, oi.Int64
+		if fetchedAt.Valid {
+			c.FetchedAt = fetchedAt.Time.In(calendar.IST)
+		}
+		c.RunID = runID.String
+		c.Incomplete = complete.Valid && !complete.Bool
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// partitionDirs returns the year partitions of a series, or of every series
+// when series is nil.
+func (s *ParquetStore) partitionDirs(series *Series) ([]string, error) {
+	pattern := filepath.Join(s.basePath, "exchange=*", "symbol=*", "interval=*", "year=*")
+	if series != nil {
+		pattern = filepath.Join(filepath.Dir(s.partitionDir(*series, 0)), "year=*")
+	}
+	return filepath.Glob(pattern)
+}
+
+// countRows counts the rows of the Parquet files in dirs matching a SQL condition.
+func (s *ParquetStore) countRows(dirs []string, where string) (int64, error) {
+	var files []string
+	for _, dir := range dirs {
+		dirFiles, err := filepath.Glob(filepath.Join(dir, "*.parquet"))
+		if err != nil {
+			return 0, err
+		}
+		for _, f := range dirFiles {
+			files = append(files, sqlString(f))
+		}
+	}
+	if len(files) == 0 {
+		return 0, nil
+	}
+	var rows int64
+	query := fmt.Sprintf("SELECT %s FROM read_parquet([%s], union_by_name = true)", where, strings.Join(files, ", "))
+	if err := s.db.QueryRow(query).Scan(&rows); err != nil {
+		return 0, fmt.Errorf("failed to count rows: %v", err)
+	}
+	return rows, nil
+}
+
+// Dedupe compacts the partitions of a series, keeping the most recently
+// fetched row per timestamp, or the most recently written one without fetched_at.
+func (s *ParquetStore) Dedupe(series Series, dryRun bool) (int64, error) {
+	dirs, err := s.partitionDirs(&series)
+	if err != nil {
+		return 0, err
+	}
+	var duplicates int64
+	for _, dir := range dirs {
+		n, err := s.countRows([]string{dir}, "COUNT(*) - COUNT(DISTINCT timestamp)")
+		if err != nil {
+			return duplicates, err
+		}
+		duplicates += n
+		if n > 0 && !dryRun {
+			if err := s.rewritePartition(dir, ""); err != nil {
+				return duplicates, err
+			}
+		}
+	}
+	return duplicates, nil
+}
+
+// DeleteRange rewrites the partitions of a series without the rows with
+// from <= timestamp <= to, removing partitions left empty.
+func (s *ParquetStore) DeleteRange(series Series, from, to time.Time, dryRun bool) (int64, error) {
+	conditions := []string{"true"}
+	if !from.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("timestamp >= to_timestamp(%f)", float64(from.UnixMicro())/1e6))
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("timestamp <= to_timestamp(%f)", float64(to.UnixMicro())/1e6))
+	}
+	match := strings.Join(conditions, " AND ")
+
+	dirs, err := s.partitionDirs(&series)
+	if err != nil {
+		return 0, err
+	}
+	var removed int64
+	for _, dir := range dirs {
+		if !dryRun {
+			// Merge pending part files first so that duplicates are not counted
+			if err := s.compactPartition(dir); err != nil {
+				return removed, err
+			}
+		}
+		n, err := s.countRows([]string{dir}, "COUNT(*) FILTER (WHERE "+match+")")
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+		if n > 0 && !dryRun {
+			if err := s.rewritePartition(dir, match); err != nil {
+				return removed, err
+			}
+		}
+	}
+	return removed, nil
+}
+
+// Vacuum merges the pending part files of every partition into its data.parquet.
+func (s *ParquetStore) Vacuum(dryRun bool) (int64, error) {
+	dirs, err := s.partitionDirs(nil)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := s.countRows(dirs, "COUNT(*)")
+	if err != nil || dryRun {
+		return rows, err
+	}
+	for _, dir := range dirs {
+		if err := s.compactPartition(dir); err != nil {
+			return rows, err
+		}
+	}
+	return rows, nil
+}
+
+// RecordRun appends a fetch run to the _fetch_runs.jsonl manifest.
+func (s *ParquetStore) RecordRun(run FetchRun) error {
+	return recordFileRun(s.basePath, run)
+}
+
+// FetchRuns returns the fetch runs recorded in the manifest, oldest first.
+func (s *ParquetStore) FetchRuns() ([]FetchRun, error) {
+	return fileRuns(s.basePath)
+}
+
+// Close compacts the partitions written in this session and closes the connection.
+func (s *ParquetStore) Close() error {
+	err := s.Compact()
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// sqlString quotes a value as a SQL string literal.
+func sqlString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+// TestParquetReadsLatestRows reads a series whose refetched and superseded
+// candles are still in pending part files, before and after compaction.
+func TestParquetReadsLatestRows(t *testing.T) {
+	dir := t.TempDir()
+	series := Series{Exchange: "NSE", Symbol: "SBIN", Interval: "minute"}
+	candle := func(minute int, close float64) kiteconnect.HistoricalData {
+		return kiteconnect.HistoricalData{
+			Date:  models.Time{Time: time.Date(2024, 1, 2, 9, minute, 0, 0, calendar.IST)},
+			Close: close,
+		}
+	}
+	store, err := NewParquetStore(dir, Options{}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.StoreCandles(series, []kiteconnect.HistoricalData{candle(15, 600)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.StoreIncompleteCandles(series, []kiteconnect.HistoricalData{candle(16, 610)}); err != nil {
+		t.Fatal(err)
+	}
+	// A refetch of both candles, the second one now final, and a new one
+	if _, err := store.StoreCandles(series, []kiteconnect.HistoricalData{candle(15, 601), candle(16, 611), candle(17, 620)}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(t *testing.T, reader Reader) {
+		t.Helper()
+		var got []Candle
+		err := reader.ReadRange(series, time.Time{}, time.Time{}, func(c Candle) error {
+			got = append(got, c)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ReadRange: %v", err)
+		}
+		want := []float64{601, 611, 620}
+		if len(got) != len(want) {
+			t.Fatalf("ReadRange returned %d candles, want %d: %+v", len(got), len(want), got)
+		}
+		for i, c := range got {
+			if c.Close != want[i] || c.Incomplete {
+				t.Errorf("candle %d: close %v, incomplete %v, want close %v, complete", i, c.Close, c.Incomplete, want[i])
+			}
+		}
+
+		got = nil
+		from := time.Date(2024, 1, 2, 9, 16, 0, 0, calendar.IST)
+		err = reader.ReadRange(series, from, from, func(c Candle) error {
+			got = append(got, c)
+			return nil
+		})
+		if err != nil || len(got) != 1 || got[0].Close != 611 {
+			t.Errorf("ReadRange of 09:16 = %+v, %v, want the final candle", got, err)
+		}
+
+		cov, err := reader.Coverage(series)
+		if err != nil {
+			t.Fatalf("Coverage: %v", err)
+		}
+		if cov.Rows != 3 || !cov.First.Equal(candle(15, 0).Date.Time) || !cov.Last.Equal(candle(17, 0).Date.Time) {
+			t.Errorf("Coverage = %d rows from %s to %s, want 3 rows from 09:15 to 09:17", cov.Rows, cov.First, cov.Last)
+		}
+	}
+
+	t.Run("pending", func(t *testing.T) { check(t, store) })
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenReader(StorageTypeParquet, dir, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	t.Run("compacted", func(t *testing.T) { check(t, reader) })
+}
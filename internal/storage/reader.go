@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// Candle is a stored OHLCV bar.
+type Candle struct {
+	Timestamp time.Time
+	Open      float64
+	High      float64
+	Low       float64
+	Close     float64
+	Volume    int64
+	OI        int64
+
+	// Lineage of the candle: when it was fetched and by which fetch run.
+	// Zero for candles written before lineage was recorded.
+	FetchedAt time.Time
+	RunID     string
+
+	// Incomplete marks a candle that was still forming when it was fetched
+	// (stored is_complete=false), to be replaced by the next fetch
+	Incomplete bool
+}
+
+// Coverage summarises the stored candles of a series.
+type Coverage struct {
+	Series Series
+	First  time.Time
+	Last   time.Time
+	Rows   int64
+
+	// LastFetched is the latest fetched_at of the series, zero when its
+	// candles carry no lineage
+	LastFetched time.Time
+}
+
+// Reader defines the read side implemented by all storage backends.
+// Stored timestamps are interpreted in the store's recorded timezone and
+// returned in IST, the zone Kite reports candles in.
+type Reader interface {
+	// ListSeries lists the stored instrument/interval combinations
+	ListSeries() ([]Series, error)
+
+	// Coverage reports the first and last timestamp and the row count of a series
+	Coverage(series Series) (Coverage, error)
+
+	// ReadRange streams the candles of a series with from <= timestamp <= to
+	// in timestamp order. A zero from or to leaves that side unbounded.
+	ReadRange(series Series, from, to time.Time, fn func(Candle) error) error
+
+	// Close cleanup resources
+	Close() error
+}
+
+// OpenReader opens existing data of the specified storage type for reading.
+func OpenReader(storageType StorageType, path string, logger *log.Logger) (Reader, error) {
+	backend, err := lookupBackend(storageType)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("no %s data at %s: %v", storageType, path, err)
+	}
+	store, err := backend.New(path, Options{}, logger)
+	if err != nil {
+		return nil, err
+	}
+	reader, ok := store.(Reader)
+	if !ok {
+		store.Close()
+		return nil, fmt.Errorf("%s storage cannot be read", storageType)
+	}
+	return reader, nil
+}
+
+// String formats a series as EXCHANGE:SYMBOL (interval).
+func (s Series) String() string {
+	symbol := s.Symbol
+	if s.Exchange != "" {
+		symbol = s.Exchange + ":" + symbol
+	}
+	if s.Interval == "" {
+		return symbol
+	}
+	return fmt.Sprintf("%s (%s)", symbol, s.Interval)
+}
+
+// inRange reports whether t lies within [from, to], treating zero bounds as open.
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || !t.After(to))
+}
+
+// sortSeries orders series by symbol, interval and exchange.
+func sortSeries(series []Series) {
+	sort.Slice(series, func(i, j int) bool {
+		a, b := series[i], series[j]
+		if a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		if a.Interval != b.Interval {
+			return a.Interval < b.Interval
+		}
+		return a.Exchange < b.Exchange
+	})
+}
+
+// streamCandles sorts candles by timestamp and passes those within range to fn,
+// leaving out flagged candles replaced by a later row.
+func streamCandles(candles []Candle, from, to time.Time, fn func(Candle) error) error {
+	candles = supersedeIncomplete(candles)
+	sort.SliceStable(candles, func(i, j int) bool {
+		return candles[i].Timestamp.Before(candles[j].Timestamp)
+	})
+	for _, c := range candles {
+		if !inRange(c.Timestamp, from, to) {
+			continue
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// coverageOf summarises candles loaded from a file, leaving out flagged
+// candles replaced by a later row.
+func coverageOf(series Series, candles []Candle) Coverage {
+	candles = supersedeIncomplete(candles)
+	cov := Coverage{Series: series, Rows: int64(len(candles))}
+	for _, c := range candles {
+		if cov.First.IsZero() || c.Timestamp.Before(cov.First) {
+			cov.First = c.Timestamp
+		}
+		if c.Timestamp.After(cov.Last) {
+			cov.Last = c.Timestamp
+		}
+		if c.FetchedAt.After(cov.LastFetched) {
+			cov.LastFetched = c.FetchedAt
+		}
+	}
+	return cov
+}
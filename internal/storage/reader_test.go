@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+// TestOpenReaderEarlierSchema reads databases as the first release wrote
+// them, without series columns, without initializing (migrating) the store.
+func TestOpenReaderEarlierSchema(t *testing.T) {
+	tests := []struct {
+		storageType StorageType
+		driver      string
+		create      string
+		timestamp   interface{}
+	}{
+		{
+			storageType: StorageTypeSQLite,
+			driver:      "sqlite3",
+			create:      "CREATE TABLE ohlcv (instrument TEXT, open REAL, high REAL, low REAL, close REAL, timestamp TEXT, volume INTEGER)",
+			timestamp:   "2024-01-02 09:15:00",
+		},
+		{
+			storageType: StorageTypeDuckDB,
+			driver:      "duckdb",
+			create:      "CREATE TABLE ohlcv (instrument VARCHAR, open DOUBLE, high DOUBLE, low DOUBLE, close DOUBLE, timestamp TIMESTAMP, volume BIGINT)",
+			timestamp:   time.Date(2024, 1, 2, 3, 45, 0, 0, time.UTC),
+		},
+	}
+	want := time.Date(2024, 1, 2, 9, 15, 0, 0, calendar.IST)
+
+	for _, tt := range tests {
+		t.Run(string(tt.storageType), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "market_data")
+			db, err := sql.Open(tt.driver, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec(tt.create); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec("INSERT INTO ohlcv VALUES (?, ?, ?, ?, ?, ?, ?)", "SBIN", 1.0, 2.0, 0.5, 1.5, tt.timestamp, 10); err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+
+			reader, err := OpenReader(tt.storageType, path, log.New(io.Discard, "", 0))
+			if err != nil {
+				t.Fatalf("OpenReader: %v", err)
+			}
+			defer reader.Close()
+
+			series, err := reader.ListSeries()
+			if err != nil {
+				t.Fatalf("ListSeries: %v", err)
+			}
+			if len(series) != 1 || series[0] != (Series{Symbol: "SBIN"}) {
+				t.Fatalf("ListSeries = %v, want [SBIN]", series)
+			}
+			cov, err := reader.Coverage(series[0])
+			if err != nil {
+				t.Fatalf("Coverage: %v", err)
+			}
+			if cov.Rows != 1 || !cov.First.Equal(want) {
+				t.Errorf("Coverage = %d rows from %v, want 1 row from %v", cov.Rows, cov.First, want)
+			}
+			var candles []Candle
+			err = reader.ReadRange(series[0], want.Add(-time.Hour), want, func(c Candle) error {
+				candles = append(candles, c)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ReadRange: %v", err)
+			}
+			if len(candles) != 1 || !candles[0].Timestamp.Equal(want) || candles[0].Close != 1.5 || candles[0].Volume != 10 {
+				t.Errorf("ReadRange = %+v, want the stored candle", candles)
+			}
+		})
+	}
+}
+
+func TestOpenReaderWithoutTable(t *testing.T) {
+	for _, tt := range []struct {
+		storageType StorageType
+		driver      string
+	}{{StorageTypeSQLite, "sqlite3"}, {StorageTypeDuckDB, "duckdb"}} {
+		t.Run(string(tt.storageType), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "market_data")
+			db, err := sql.Open(tt.driver, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec("CREATE TABLE other (id INTEGER)"); err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+
+			reader, err := OpenReader(tt.storageType, path, log.New(io.Discard, "", 0))
+			if err != nil {
+				t.Fatalf("OpenReader: %v", err)
+			}
+			defer reader.Close()
+			if _, err := reader.ListSeries(); err == nil || !strings.Contains(err.Error(), "no ohlcv table") {
+				t.Errorf("ListSeries = %v, want a missing table error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Backend describes a storage type: how to create its store, which settings
+// it accepts and how the storage command presents it. Built-in backends
+// register themselves from their own files; other packages can add more with
+// Register before the command runs.
+type Backend struct {
+	Name        StorageType
+	New         func(path string, opts Options, logger *log.Logger) (Store, error)
+	Schema      Schema
+	Description Description
+}
+
+// Schema describes the config settings a backend accepts.
+type Schema struct {
+	// DefaultPath is used when storage_path is not set
+	DefaultPath string
+
+	// Directory is true when the path is a directory of files rather than a
+	// single database file
+	Directory bool
+
+	// Compression, FlushRows, PathTemplate and Timezones report which Options
+	// the store honours. Timezones lists the zones it can store timestamps
+	// in; a backend without any always stores UTC.
+	Compression  bool
+	FlushRows    bool
+	PathTemplate bool
+	Timezones    []Timezone
+}
+
+// SupportsTimezone reports whether the backend can store timestamps in zone.
+func (s Schema) SupportsTimezone(zone Timezone) bool {
+	if len(s.Timezones) == 0 {
+		return zone == TimezoneUTC
+	}
+	for _, z := range s.Timezones {
+		if z == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// Description is shown for a backend by the storage command.
+type Description struct {
+	Title   string // e.g. "🚀 DuckDB"
+	BestFor string
+	Format  string
+	Pros    string
+	Cons    string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[StorageType]Backend)
+)
+
+// Register makes a backend available under its name. It panics when the name
+// is empty or already registered, or the backend has no constructor.
+func Register(b Backend) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if b.Name == "" {
+		panic("storage: Register with an empty backend name")
+	}
+	if b.New == nil {
+		panic(fmt.Sprintf("storage: Register of %s without a constructor", b.Name))
+	}
+	if _, dup := registry[b.Name]; dup {
+		panic(fmt.Sprintf("storage: Register called twice for backend %s", b.Name))
+	}
+	registry[b.Name] = b
+}
+
+// Lookup returns the backend registered under a name.
+func Lookup(name StorageType) (Backend, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	b, ok := registry[name]
+	return b, ok
+}
+
+// Backends returns every registered backend, sorted by name.
+func Backends() []Backend {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	backends := make([]Backend, 0, len(registry))
+	for _, b := range registry {
+		backends = append(backends, b)
+	}
+	sort.Slice(backends, func(i, j int) bool { return backends[i].Name < backends[j].Name })
+	return backends
+}
+
+// Names returns the names of every registered backend, sorted.
+func Names() []string {
+	backends := Backends()
+	names := make([]string, len(backends))
+	for i, b := range backends {
+		names[i] = string(b.Name)
+	}
+	return names
+}
+
+// UnknownTypeError is returned for a storage type no backend is registered for.
+type UnknownTypeError struct {
+	Name StorageType
+}
+
+func (e *UnknownTypeError) Error() string {
+	return fmt.Sprintf("unknown storage type %q (available: %s)", e.Name, strings.Join(Names(), ", "))
+}
+
+// lookupBackend returns the backend of a storage type or an *UnknownTypeError.
+func lookupBackend(name StorageType) (Backend, error) {
+	b, ok := Lookup(name)
+	if !ok {
+		return Backend{}, &UnknownTypeError{Name: name}
+	}
+	return b, nil
+}
@@ -4,54 +4,375 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
 
 	_ "github.com/mattn/go-sqlite3"
 	kiteconnect "github.com/zerodha/gokiteconnect/v4"
 )
 
+// SQLiteSchemaVersion is the layout of the ohlcv table written by this release.
+//
+//	1: TEXT timestamps in IST, no keys or indexes (earlier releases)
+//	2: INTEGER UTC epoch seconds, primary key (instrument, interval, exchange, timestamp)
+//	3: storage_metadata table recording the timezone (always UTC)
+//	4: fetched_at and run_id lineage columns, fetch_runs and fetch_run_results tables
+//	5: is_complete flag of candles still forming when fetched
+//	6: oi column holding the open interest of futures and options candles
+const SQLiteSchemaVersion = 6
+
+// sqliteParams opens the database in WAL mode, so readers do not block the
+// writer, with a 64 MB page cache and a busy timeout for concurrent access.
+const sqliteParams = "?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000&_cache_size=-65536&_txlock=immediate"
+
 // SQLiteStore provides a storage interface for SQLite.
+//
+// The ohlcv table is keyed by series and timestamp, so a candle written
+// again replaces the stored one. The applied schema version is recorded in
+// schema_migrations; Init migrates databases written by earlier releases.
+// Timestamps are epoch seconds, so the storage timezone is always UTC.
+// fetched_at is epoch seconds too, and run_id refers to fetch_runs. oi is
+// the open interest of candles fetched with it, 0 otherwise.
 type SQLiteStore struct {
-	db     *sql.DB
-	logger *log.Logger
+	db       *sql.DB
+	timezone Timezone
+	lineage  lineage
+	logger   *log.Logger
+	version  int
 }
 
 // NewSQLiteStore creates a new SQLite store.
-func NewSQLiteStore(path string, logger *log.Logger) (*SQLiteStore, error) {
-	db, err := sql.Open("sqlite3", path)
+func NewSQLiteStore(path string, opts Options, logger *log.Logger) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path+sqliteParams)
 	if err != nil {
 		return nil, fmt.Errorf("sqlite connection failed: %v", err)
 	}
-	return &SQLiteStore{db: db, logger: logger}, nil
+	return &SQLiteStore{db: db, timezone: opts.Timezone, lineage: lineage{runID: opts.RunID}, logger: logger}, nil
 }
 
-// Init initializes the database schema.
-func (s *SQLiteStore) Init() error {
-	createTable := `
-	CREATE TABLE IF NOT EXISTS ohlcv (
-		instrument TEXT,
+func init() {
+	Register(Backend{
+		Name: StorageTypeSQLite,
+		New:  constructor(NewSQLiteStore),
+		Schema: Schema{
+			DefaultPath: "market_data.sqlite",
+		},
+		Description: Description{
+			Title:   "💾 SQLite",
+			BestFor: "Universal compatibility, small to medium datasets",
+			Format:  "Single database file (.sqlite)",
+			Pros:    "Widely supported, portable, SQL queries, indexed range reads, WAL mode",
+			Cons:    "Slower for large analytical workloads",
+		},
+	})
+}
+
+// sqliteMigration upgrades the schema from one version to the next.
+type sqliteMigration struct {
+	from        int
+	description string
+	apply       func(tx *sql.Tx) (string, error)
+}
+
+// sqliteMigrations lists the schema upgrades in order.
+var sqliteMigrations = []sqliteMigration{
+	{from: 1, description: "UTC epoch timestamps and primary key", apply: migrateSQLiteV1},
+	{from: 2, description: "storage metadata", apply: migrateSQLiteV2},
+	{from: 3, description: "fetch lineage", apply: migrateSQLiteV3},
+	{from: 4, description: "incomplete candles", apply: migrateSQLiteV4},
+	{from: 5, description: "open interest", apply: migrateSQLiteV5},
+}
+
+// createSQLiteTable is the ohlcv table of the current schema version.
+const createSQLiteTable = `
+	CREATE TABLE ohlcv (
+		instrument TEXT NOT NULL,
+		"interval" TEXT NOT NULL DEFAULT '',
+		exchange TEXT NOT NULL DEFAULT '',
+		timestamp INTEGER NOT NULL,
 		open REAL,
 		high REAL,
 		low REAL,
 		close REAL,
-		timestamp TEXT,
-		volume INTEGER
+		volume INTEGER,
+		fetched_at INTEGER,
+		run_id TEXT,
+		is_complete INTEGER,
+		oi INTEGER,
+		PRIMARY KEY (instrument, "interval", exchange, timestamp)
+	) WITHOUT ROWID;`
+
+// Init creates the schema or migrates it to SQLiteSchemaVersion.
+func (s *SQLiteStore) Init() error {
+	if s.timezone != "" && s.timezone != TimezoneUTC {
+		return fmt.Errorf("SQLite stores UTC epoch seconds; storage timezone %s is not supported", s.timezone)
+	}
+	createMigrations := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TEXT NOT NULL
 	);`
-	if _, err := s.db.Exec(createTable); err != nil {
-		return fmt.Errorf("failed to create SQLite table: %v", err)
+	if _, err := s.db.Exec(createMigrations); err != nil {
+		return fmt.Errorf("failed to create SQLite schema_migrations table: %v", err)
+	}
+
+	version, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > SQLiteSchemaVersion {
+		return fmt.Errorf("SQLite schema version %d is newer than this release supports (%d)", version, SQLiteSchemaVersion)
+	}
+
+	if version == 0 {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("DB transaction error: %v", err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(createSQLiteTable); err != nil {
+			return fmt.Errorf("failed to create SQLite table: %v", err)
+		}
+		if _, err := migrateSQLiteV2(tx); err != nil {
+			return fmt.Errorf("failed to create SQLite storage_metadata table: %v", err)
+		}
+		if err := createRunTables(tx); err != nil {
+			return err
+		}
+		if err := recordSQLiteVersion(tx, SQLiteSchemaVersion, "create schema"); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit error: %v", err)
+		}
+		version = SQLiteSchemaVersion
+	}
+
+	for _, m := range sqliteMigrations {
+		if m.from != version {
+			continue
+		}
+		if err := s.migrate(m); err != nil {
+			return err
+		}
+		version = m.from + 1
 	}
-	s.logger.Println("✅ SQLite table 'ohlcv' is ready.")
+	s.version = version
+
+	s.logger.Printf("✅ SQLite table 'ohlcv' is ready (schema version %d).", version)
 	return nil
 }
 
-// StoreCandles inserts a slice of candles into the database.
-func (s *SQLiteStore) StoreCandles(instrumentSymbol string, candles []kiteconnect.HistoricalData) (int, error) {
+// schemaVersion returns the recorded schema version. Databases without a
+// recorded version are version 1 if they hold an ohlcv table, or empty (0).
+func (s *SQLiteStore) schemaVersion() (int, error) {
+	var tables int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&tables)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect SQLite schema: %v", err)
+	}
+	if tables > 0 {
+		var version sql.NullInt64
+		if err := s.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+			return 0, fmt.Errorf("failed to read SQLite schema version: %v", err)
+		}
+		if version.Valid {
+			return int(version.Int64), nil
+		}
+	}
+
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'ohlcv'`).Scan(&tables); err != nil {
+		return 0, fmt.Errorf("failed to inspect SQLite schema: %v", err)
+	}
+	if tables > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// migrate applies one migration and records it, in a single transaction.
+func (s *SQLiteStore) migrate(m sqliteMigration) error {
+	start := time.Now()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("DB transaction error: %v", err)
+	}
+	defer tx.Rollback()
+
+	note, err := m.apply(tx)
+	if err != nil {
+		return fmt.Errorf("SQLite migration from version %d failed: %v", m.from, err)
+	}
+	if err := recordSQLiteVersion(tx, m.from+1, m.description); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit error: %v", err)
+	}
+	s.logger.Printf("🔄 Migrated SQLite schema from version %d to %d (%s) in %v: %s",
+		m.from, m.from+1, m.description, time.Since(start).Round(time.Millisecond), note)
+	return nil
+}
+
+func recordSQLiteVersion(tx *sql.Tx, version int, description string) error {
+	_, err := tx.Exec("INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)",
+		version, description, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to record SQLite schema version: %v", err)
+	}
+	return nil
+}
+
+// migrateSQLiteV1 converts the IST TEXT timestamps of earlier releases to UTC
+// epoch seconds and rebuilds the table with its primary key. Where the old
+// table holds a timestamp more than once, the row inserted last is kept.
+// Rows whose timestamp cannot be parsed are dropped and counted.
+func migrateSQLiteV1(tx *sql.Tx) (string, error) {
+	// Tables of the earliest releases lack the series columns
+	for _, column := range []string{"exchange", "interval"} {
+		var present int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info('ohlcv') WHERE name = ?", column).Scan(&present); err != nil {
+			return "", fmt.Errorf("failed to inspect SQLite table: %v", err)
+		}
+		if present == 0 {
+			if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE ohlcv ADD COLUMN "%s" TEXT`, column)); err != nil {
+				return "", fmt.Errorf("failed to add column %s: %v", column, err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec("ALTER TABLE ohlcv RENAME TO ohlcv_v1"); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(createSQLiteTable); err != nil {
+		return "", err
+	}
+	// IST is a fixed offset without daylight saving time
+	_, offset := time.Time{}.In(calendar.IST).Zone()
+	copyRows := `
+	INSERT OR REPLACE INTO ohlcv (instrument, "interval", exchange, timestamp, open, high, low, close, volume)
+	SELECT instrument, COALESCE("interval", ''), COALESCE(exchange, ''),
+		CAST(strftime('%s', timestamp) AS INTEGER) - ?, open, high, low, close, volume
+	FROM ohlcv_v1
+	WHERE instrument IS NOT NULL AND strftime('%s', timestamp) IS NOT NULL
+	ORDER BY rowid`
+	result, err := tx.Exec(copyRows, offset)
+	if err != nil {
+		return "", err
+	}
+	copied, _ := result.RowsAffected()
+
+	var total int64
+	if err := tx.QueryRow("SELECT COUNT(*) FROM ohlcv_v1").Scan(&total); err != nil {
+		return "", err
+	}
+	var kept int64
+	if err := tx.QueryRow("SELECT COUNT(*) FROM ohlcv").Scan(&kept); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("DROP TABLE ohlcv_v1"); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d rows converted, %d duplicates merged, %d unreadable rows dropped",
+		kept, copied-kept, total-copied), nil
+}
+
+// migrateSQLiteV2 adds the storage_metadata table and records that
+// timestamps are stored in UTC, which they have been since version 2.
+func migrateSQLiteV2(tx *sql.Tx) (string, error) {
+	if _, err := tx.Exec(createSQLMetadata); err != nil {
+		return "", err
+	}
+	if err := setSQLMetadata(tx, "timezone", string(TimezoneUTC)); err != nil {
+		return "", err
+	}
+	return "timezone recorded as UTC", nil
+}
+
+// migrateSQLiteV3 adds the lineage columns, NULL for the rows stored so far,
+// and the fetch run history tables. Tables rebuilt by migrateSQLiteV1 already
+// have the columns.
+func migrateSQLiteV3(tx *sql.Tx) (string, error) {
+	added, err := addSQLiteColumns(tx, "fetched_at INTEGER", "run_id TEXT")
+	if err != nil {
+		return "", err
+	}
+	if err := createRunTables(tx); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d lineage columns added, fetch run tables created", added), nil
+}
+
+// migrateSQLiteV4 adds the is_complete flag. Stored candles keep NULL,
+// which reads as complete.
+func migrateSQLiteV4(tx *sql.Tx) (string, error) {
+	added, err := addSQLiteColumns(tx, "is_complete INTEGER")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d column added", added), nil
+}
+
+// migrateSQLiteV5 adds the oi column. Stored candles keep NULL, which
+// reads as no open interest.
+func migrateSQLiteV5(tx *sql.Tx) (string, error) {
+	added, err := addSQLiteColumns(tx, "oi INTEGER")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d column added", added), nil
+}
+
+// addSQLiteColumns adds the columns missing from the ohlcv table and returns
+// how many were added.
+func addSQLiteColumns(tx *sql.Tx, columns ...string) (int, error) {
+	added := 0
+	for _, column := range columns {
+		name := strings.Fields(column)[0]
+		var present int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info('ohlcv') WHERE name = ?", name).Scan(&present); err != nil {
+			return added, fmt.Errorf("failed to inspect SQLite table: %v", err)
+		}
+		if present == 0 {
+			if _, err := tx.Exec("ALTER TABLE ohlcv ADD COLUMN " + column); err != nil {
+				return added, fmt.Errorf("failed to add column %s: %v", name, err)
+			}
+			added++
+		}
+	}
+	return added, nil
+}
+
+// StoreCandles inserts a slice of candles into the database, replacing
+// stored candles with the same timestamp. The candles are stamped with the
+// time of the write and the run ID of the store, if any.
+func (s *SQLiteStore) StoreCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, true))
+}
+
+// StoreIncompleteCandles inserts candles still forming, flagged
+// is_complete=false, to be replaced by the next write of their timestamps.
+func (s *SQLiteStore) StoreIncompleteCandles(series Series, candles []kiteconnect.HistoricalData) (int, error) {
+	return s.storeCandles(series, s.lineage.candles(candles, false))
+}
+
+// StoreLineageCandles inserts candles keeping their lineage.
+func (s *SQLiteStore) StoreLineageCandles(series Series, candles []Candle) (int, error) {
+	return s.storeCandles(series, candles)
+}
+
+func (s *SQLiteStore) storeCandles(series Series, candles []Candle) (int, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return 0, fmt.Errorf("DB transaction error: %v", err)
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("INSERT INTO ohlcv VALUES (?,?,?,?,?,?,?)")
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO ohlcv (instrument, "interval", exchange, timestamp, open, high, low, close, volume, oi, fetched_at, run_id, is_complete)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)`)
 	if err != nil {
 		return 0, fmt.Errorf("DB prepare error: %v", err)
 	}
@@ -59,14 +380,27 @@ func (s *SQLiteStore) StoreCandles(instrumentSymbol string, candles []kiteconnec
 
 	var inserted int
 	for _, c := range candles {
+		var fetchedAt, runID interface{}
+		if !c.FetchedAt.IsZero() {
+			fetchedAt = c.FetchedAt.Unix()
+		}
+		if c.RunID != "" {
+			runID = c.RunID
+		}
 		_, err := stmt.Exec(
-			instrumentSymbol,
+			series.Symbol,
+			series.Interval,
+			series.Exchange,
+			c.Timestamp.Unix(),
 			c.Open,
 			c.High,
 			c.Low,
 			c.Close,
-			c.Date.Time.Format("2006-01-02 15:04:05"),
 			c.Volume,
+			c.OI,
+			fetchedAt,
+			runID,
+			!c.Incomplete,
 		)
 		if err != nil {
 			s.logger.Printf("      \\_ Insert error: %v, for candle %+v", err, c)
@@ -81,6 +415,166 @@ func (s *SQLiteStore) StoreCandles(instrumentSymbol string, candles []kiteconnec
 	return inserted, nil
 }
 
+// sqliteDialect reads the current schema: UTC epoch seconds and NOT NULL
+// series columns, matched exactly so that the primary key is used.
+var sqliteDialect = sqlDialect{
+	seriesFilter: `instrument = ? AND exchange = ? AND "interval" = ?`,
+	bind:         func(t time.Time) interface{} { return t.Unix() },
+	parse: func(v interface{}) (time.Time, error) {
+		epoch, ok := v.(int64)
+		if !ok {
+			return time.Time{}, fmt.Errorf("unexpected timestamp value %v", v)
+		}
+		return time.Unix(epoch, 0).In(calendar.IST), nil
+	},
+}
+
+// sqliteV1TimestampLayout is the TEXT format of schema version 1 timestamps, in IST.
+const sqliteV1TimestampLayout = "2006-01-02 15:04:05"
+
+// sqliteV1Dialect reads databases of earlier releases that have not been
+// migrated, e.g. when they are only opened for reading.
+var sqliteV1Dialect = sqlDialect{
+	seriesFilter: nullableSeriesFilter,
+	bind:         func(t time.Time) interface{} { return t.In(calendar.IST).Format(sqliteV1TimestampLayout) },
+	parse: func(v interface{}) (time.Time, error) {
+		var text string
+		switch value := v.(type) {
+		case string:
+			text = value
+		case []byte:
+			text = string(value)
+		default:
+			return time.Time{}, fmt.Errorf("unexpected timestamp value %v", v)
+		}
+		t, err := time.ParseInLocation(sqliteV1TimestampLayout, text, calendar.IST)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q: %v", text, err)
+		}
+		return t, nil
+	},
+}
+
+// dialect returns the dialect matching the schema version of the database.
+func (s *SQLiteStore) dialect() (sqlDialect, error) {
+	if s.version == 0 {
+		version, err := s.schemaVersion()
+		if err != nil {
+			return sqlDialect{}, err
+		}
+		s.version = version
+	}
+	switch s.version {
+	case 0:
+		return sqlDialect{}, fmt.Errorf("no candles stored yet (the database has no ohlcv table)")
+	case 1:
+		// Tables of the earliest releases lack the series columns too
+		hasSeries, err := sqlHasColumn(s.db, "exchange")
+		if err != nil {
+			return sqlDialect{}, err
+		}
+		if !hasSeries {
+			return sqliteV1Dialect.withoutSeriesColumns(), nil
+		}
+		return sqliteV1Dialect, nil
+	}
+	dialect := sqliteDialect
+	dialect.lineage = s.version >= 4
+	dialect.completeness = s.version >= 5
+	dialect.openInterest = s.version >= 6
+	return dialect, nil
+}
+
+// StoredTimezone returns UTC, the zone of epoch seconds.
+func (s *SQLiteStore) StoredTimezone() (Timezone, error) {
+	return TimezoneUTC, nil
+}
+
+// ConvertTimezone accepts only UTC: epoch seconds do not depend on a zone,
+// and databases of earlier releases are converted by the schema migration.
+func (s *SQLiteStore) ConvertTimezone(to Timezone) error {
+	if to != TimezoneUTC {
+		return fmt.Errorf("SQLite stores UTC epoch seconds; storage timezone %s is not supported", to)
+	}
+	return nil
+}
+
+// ListSeries lists the stored instrument/interval combinations.
+func (s *SQLiteStore) ListSeries() ([]Series, error) {
+	dialect, err := s.dialect()
+	if err != nil {
+		return nil, err
+	}
+	return listSQLSeries(s.db, dialect)
+}
+
+// Coverage reports the first and last timestamp and the row count of a series.
+func (s *SQLiteStore) Coverage(series Series) (Coverage, error) {
+	dialect, err := s.dialect()
+	if err != nil {
+		return Coverage{Series: series}, err
+	}
+	return sqlCoverage(s.db, dialect, series)
+}
+
+// ReadRange streams the candles of a series in timestamp order.
+func (s *SQLiteStore) ReadRange(series Series, from, to time.Time, fn func(Candle) error) error {
+	dialect, err := s.dialect()
+	if err != nil {
+		return err
+	}
+	return sqlReadRange(s.db, dialect, series, from, to, fn)
+}
+
+// Dedupe removes duplicate timestamps of a series. Since schema version 2
+// the primary key rules them out; databases of earlier releases keep the
+// last inserted row.
+func (s *SQLiteStore) Dedupe(series Series, dryRun bool) (int64, error) {
+	dialect, err := s.dialect()
+	if err != nil {
+		return 0, err
+	}
+	if s.version >= 2 {
+		return 0, nil
+	}
+	return sqlDedupe(s.db, dialect, series, dryRun)
+}
+
+// DeleteRange deletes the candles of a series with from <= timestamp <= to.
+func (s *SQLiteStore) DeleteRange(series Series, from, to time.Time, dryRun bool) (int64, error) {
+	dialect, err := s.dialect()
+	if err != nil {
+		return 0, err
+	}
+	return sqlDeleteRange(s.db, dialect, series, from, to, dryRun)
+}
+
+// Vacuum rebuilds the database file to release the space of deleted rows and
+// truncates the write-ahead log.
+func (s *SQLiteStore) Vacuum(dryRun bool) (int64, error) {
+	rows, err := sqlRowCount(s.db)
+	if err != nil || dryRun {
+		return rows, err
+	}
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return rows, fmt.Errorf("SQLite VACUUM failed: %v", err)
+	}
+	if _, err := s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return rows, fmt.Errorf("SQLite checkpoint failed: %v", err)
+	}
+	return rows, nil
+}
+
+// RecordRun records a fetch run in the fetch_runs and fetch_run_results tables.
+func (s *SQLiteStore) RecordRun(run FetchRun) error {
+	return sqlRecordRun(s.db, run)
+}
+
+// FetchRuns returns the recorded fetch runs, oldest first.
+func (s *SQLiteStore) FetchRuns() ([]FetchRun, error) {
+	return sqlFetchRuns(s.db)
+}
+
 // Close closes the database connection.
 func (s *SQLiteStore) Close() error {
 	return s.db.Close()
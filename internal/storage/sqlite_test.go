@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+// TestSQLiteMigrateV1 migrates a database written by the first release:
+// IST wall time as TEXT, no series columns, no key and duplicate rows.
+func TestSQLiteMigrateV1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "market_data.sqlite")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The table and inserts of the first release
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ohlcv (
+		instrument TEXT,
+		open REAL,
+		high REAL,
+		low REAL,
+		close REAL,
+		timestamp TEXT,
+		volume INTEGER
+	);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []struct {
+		instrument string
+		timestamp  string
+		close      float64
+	}{
+		{"SBIN", "2024-01-02 09:15:00", 600},
+		{"SBIN", "2024-01-02 09:16:00", 601},
+		{"SBIN", "2024-01-02 09:15:00", 602}, // Fetched again: replaces the first row
+		{"TCS", "2024-01-02 15:29:00", 3700},
+		{"TCS", "not a timestamp", 3701},
+	}
+	for _, r := range rows {
+		_, err := db.Exec("INSERT INTO ohlcv VALUES (?,?,?,?,?,?,?)", r.instrument, 1.0, 2.0, 0.5, r.close, r.timestamp, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	store, err := NewSQLiteStore(path, Options{}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	// Versions 2 to 6 are recorded, one migration each
+	var versions []int
+	result, err := store.db.Query("SELECT version FROM schema_migrations ORDER BY version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for result.Next() {
+		var v int
+		if err := result.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, v)
+	}
+	result.Close()
+	if want := []int{2, 3, 4, 5, 6}; !slices.Equal(versions, want) {
+		t.Errorf("schema_migrations versions = %v, want %v", versions, want)
+	}
+	if store.version != SQLiteSchemaVersion {
+		t.Errorf("schema version = %d, want %d", store.version, SQLiteSchemaVersion)
+	}
+
+	// Timestamps are UTC epoch seconds, one row per series and timestamp
+	type row struct {
+		instrument, exchange, interval string
+		timestamp                      int64
+		close                          float64
+	}
+	var got []row
+	result, err = store.db.Query(`SELECT instrument, exchange, "interval", timestamp, close FROM ohlcv ORDER BY instrument, timestamp`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for result.Next() {
+		var r row
+		if err := result.Scan(&r.instrument, &r.exchange, &r.interval, &r.timestamp, &r.close); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	result.Close()
+	epoch := func(s string) int64 {
+		ts, err := time.ParseInLocation("2006-01-02 15:04:05", s, calendar.IST)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts.Unix()
+	}
+	want := []row{
+		{"SBIN", "", "", epoch("2024-01-02 09:15:00"), 602},
+		{"SBIN", "", "", epoch("2024-01-02 09:16:00"), 601},
+		{"TCS", "", "", epoch("2024-01-02 15:29:00"), 3700},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("migrated rows = %v, want %v", got, want)
+	}
+	if want[0].timestamp != 1704167100 {
+		t.Errorf("2024-01-02 09:15 IST = %d, want 1704167100 (03:45 UTC)", want[0].timestamp)
+	}
+
+	// The lineage and completeness columns exist and are NULL for migrated rows
+	var lineage int
+	err = store.db.QueryRow("SELECT COUNT(*) FROM ohlcv WHERE fetched_at IS NOT NULL OR run_id IS NOT NULL OR is_complete IS NOT NULL").Scan(&lineage)
+	if err != nil || lineage != 0 {
+		t.Errorf("rows with lineage = %d, %v, want 0", lineage, err)
+	}
+	zone, err := sqlMetadata(store.db, "timezone")
+	if err != nil || zone != string(TimezoneUTC) {
+		t.Errorf("recorded timezone = %q, %v, want UTC", zone, err)
+	}
+
+	// The migrated candles read back in IST
+	var candles []Candle
+	err = store.ReadRange(Series{Symbol: "SBIN"}, time.Time{}, time.Time{}, func(c Candle) error {
+		candles = append(candles, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadRange: %v", err)
+	}
+	if len(candles) != 2 || !candles[0].Timestamp.Equal(time.Date(2024, 1, 2, 9, 15, 0, 0, calendar.IST)) || candles[0].Close != 602 {
+		t.Errorf("ReadRange = %+v", candles)
+	}
+
+	// A second Init finds nothing to migrate
+	if err := store.Init(); err != nil {
+		t.Fatalf("second Init: %v", err)
+	}
+	var count int
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count); err != nil || count != 5 {
+		t.Errorf("schema_migrations rows after a second Init = %d, %v, want 5", count, err)
+	}
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+// sqlDialect describes how a SQL backend lays out the ohlcv table: the
+// condition selecting a series, how timestamps are converted between Go and
+// the column representation, whether the table has the exchange and interval
+// columns, whether it has the fetched_at and run_id lineage columns and the
+// is_complete flag, and whether it has the oi column.
+type sqlDialect struct {
+	seriesFilter    string
+	bind            func(time.Time) interface{}
+	parse           func(interface{}) (time.Time, error)
+	noSeriesColumns bool
+	lineage         bool
+	completeness    bool
+	openInterest    bool
+}
+
+// withoutSeriesColumns adapts a dialect to a table of the earliest releases,
+// which has no exchange and interval columns until a store is initialized.
+// Its rows belong to series without exchange and interval.
+func (ts sqlDialect) withoutSeriesColumns() sqlDialect {
+	ts.seriesFilter = `instrument = ? AND '' = ? AND '' = ?`
+	ts.noSeriesColumns = true
+	return ts
+}
+
+// parseFetchedAt converts a fetched_at value: epoch seconds in SQLite, a
+// naive UTC TIMESTAMP in DuckDB. NULL is the zero time.
+func parseFetchedAt(v interface{}) time.Time {
+	switch value := v.(type) {
+	case int64:
+		return time.Unix(value, 0).In(calendar.IST)
+	case time.Time:
+		return time.Date(value.Year(), value.Month(), value.Day(), value.Hour(), value.Minute(), value.Second(),
+			value.Nanosecond(), time.UTC).In(calendar.IST)
+	default:
+		return time.Time{}
+	}
+}
+
+// nullableSeriesFilter matches the rows of a series. Rows written before
+// exchange and interval were recorded have NULLs there and match an empty value.
+const nullableSeriesFilter = `instrument = ? AND COALESCE(exchange, '') = ? AND COALESCE("interval", '') = ?`
+
+func seriesArgs(series Series) []interface{} {
+	return []interface{}{series.Symbol, series.Exchange, series.Interval}
+}
+
+// listSQLSeries lists the series stored in the ohlcv table.
+func listSQLSeries(db *sql.DB, ts sqlDialect) ([]Series, error) {
+	query := `SELECT DISTINCT COALESCE(exchange, ''), instrument, COALESCE("interval", '') FROM ohlcv`
+	if ts.noSeriesColumns {
+		query = `SELECT DISTINCT '', instrument, '' FROM ohlcv`
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list series: %v", err)
+	}
+	defer rows.Close()
+
+	var series []Series
+	for rows.Next() {
+		var s Series
+		if err := rows.Scan(&s.Exchange, &s.Symbol, &s.Interval); err != nil {
+			return nil, fmt.Errorf("failed to read series: %v", err)
+		}
+		series = append(series, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortSeries(series)
+	return series, nil
+}
+
+// sqlCoverage reports the coverage of a series in the ohlcv table.
+func sqlCoverage(db *sql.DB, ts sqlDialect, series Series) (Coverage, error) {
+	cov := Coverage{Series: series}
+	var first, last, fetched interface{}
+	lastFetched := "NULL"
+	if ts.lineage {
+		lastFetched = "MAX(fetched_at)"
+	}
+	query := "SELECT MIN(timestamp), MAX(timestamp), COUNT(*), " + lastFetched + " FROM ohlcv WHERE " + ts.seriesFilter
+	if err := db.QueryRow(query, seriesArgs(series)...).Scan(&first, &last, &cov.Rows, &fetched); err != nil {
+		return cov, fmt.Errorf("failed to read coverage of %s: %v", series, err)
+	}
+	cov.LastFetched = parseFetchedAt(fetched)
+	if cov.Rows == 0 {
+		return cov, nil
+	}
+	var err error
+	if cov.First, err = ts.parse(first); err != nil {
+		return cov, err
+	}
+	if cov.Last, err = ts.parse(last); err != nil {
+		return cov, err
+	}
+	return cov, nil
+}
+
+// sqlReadRange streams the candles of a series from the ohlcv table in timestamp order.
+func sqlReadRange(db *sql.DB, ts sqlDialect, series Series, from, to time.Time, fn func(Candle) error) error {
+	conditions := []string{ts.seriesFilter}
+	args := seriesArgs(series)
+	if !from.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, ts.bind(from))
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, "timestamp <= ?")
+		args = append(args, ts.bind(to))
+	}
+	lineage := "NULL, NULL"
+	if ts.lineage {
+		lineage = "fetched_at, run_id"
+	}
+	isComplete := "NULL"
+	if ts.completeness {
+		isComplete = "is_complete"
+	}
+	oi := "NULL"
+	if ts.openInterest {
+		oi = "oi"
+	}
+	query := "SELECT timestamp, open, high, low, close, volume, " + oi + ", " + lineage + ", " + isComplete + " FROM ohlcv WHERE " +
+		strings.Join(conditions, " AND ") + " ORDER BY timestamp"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", series, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Candle
+		var raw, fetched interface{}
+		var volume, oi sql.NullInt64
+		var runID sql.NullString
+		var complete sql.NullBool
+		if err := rows.Scan(&raw, &c.Open, &c.High, &c.Low, &c.Close, &volume, &oi, &fetched, &runID, &complete); err != nil {
+			return fmt.Errorf("failed to read candle of %s: %v", series, err)
+		}
+		if c.Timestamp, err = ts.parse(raw); err != nil {
+			return err
+		}
+		c.Volume, c.OI = volume.Int64, oi.Int64
+		c.FetchedAt, c.RunID = parseFetchedAt(fetched), runID.String
+		c.Incomplete = complete.Valid && !complete.Bool
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
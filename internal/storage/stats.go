@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"os"
+	"time"
+)
+
+// SeriesFiler is implemented by stores keeping the candles of every series in
+// files of their own, so that their size and write time can be reported per
+// series. Database stores hold all series in one file and do not implement it.
+type SeriesFiler interface {
+	SeriesFiles(series Series) ([]string, error)
+}
+
+// FileUsage is the disk space and most recent write of a set of files.
+type FileUsage struct {
+	Size     int64
+	Modified time.Time
+}
+
+// SeriesUsage sums the size of the files of a series and finds their latest
+// modification time.
+func SeriesUsage(f SeriesFiler, series Series) (FileUsage, error) {
+	files, err := f.SeriesFiles(series)
+	if err != nil {
+		return FileUsage{}, err
+	}
+	var usage FileUsage
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return usage, err
+		}
+		usage.Size += info.Size()
+		if info.ModTime().After(usage.Modified) {
+			usage.Modified = info.ModTime()
+		}
+	}
+	return usage, nil
+}
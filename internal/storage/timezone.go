@@ -0,0 +1,340 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+)
+
+// Timezone is the zone a store writes wall-clock timestamps in. Every store
+// records its timezone, in a storage_metadata table for databases and in a
+// _metadata.json file for directories of files.
+type Timezone string
+
+const (
+	TimezoneUTC Timezone = "UTC"
+	TimezoneIST Timezone = "Asia/Kolkata"
+)
+
+// ParseTimezone parses a storage timezone setting: "UTC" or "Asia/Kolkata"
+// (also accepted as "IST"). An empty value leaves the choice to the store.
+func ParseTimezone(value string) (Timezone, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return "", nil
+	case "utc":
+		return TimezoneUTC, nil
+	case "asia/kolkata", "ist":
+		return TimezoneIST, nil
+	default:
+		return "", fmt.Errorf("unknown storage timezone %q (use UTC or Asia/Kolkata)", value)
+	}
+}
+
+// Location returns the time zone of the policy.
+func (z Timezone) Location() *time.Location {
+	if z == TimezoneUTC {
+		return time.UTC
+	}
+	return calendar.IST
+}
+
+// wallClock returns the wall time of t in zone z as a zone-less UTC value,
+// which is how naive TIMESTAMP columns are bound.
+func wallClock(t time.Time, z Timezone) time.Time {
+	t = t.In(z.Location())
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// fromWallClock interprets the wall time of a naive timestamp in zone z.
+func fromWallClock(t time.Time, z Timezone) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), z.Location())
+}
+
+// TimezoneConverter is implemented by stores that can rewrite their stored
+// timestamps in place for another timezone.
+type TimezoneConverter interface {
+	// StoredTimezone returns the timezone the store's timestamps are in
+	StoredTimezone() (Timezone, error)
+
+	// ConvertTimezone rewrites the stored timestamps in the given timezone
+	ConvertTimezone(to Timezone) error
+}
+
+// TimezoneMismatchError reports a store that holds timestamps in a different
+// timezone than the configuration asks for.
+type TimezoneMismatchError struct {
+	Path       string
+	Stored     Timezone
+	Configured Timezone
+}
+
+func (e *TimezoneMismatchError) Error() string {
+	return fmt.Sprintf("%s stores timestamps in %s, not %s (convert it with: zerodha-connect storage timezone --to %s)",
+		e.Path, e.Stored, e.Configured, e.Configured)
+}
+
+// resolveTimezone decides the timezone of a store opened for writing. A
+// recorded timezone is kept. Without one, a store that already holds data
+// (written before timezones were recorded) is in the backend's legacy zone,
+// and an empty store takes the configured zone, or the legacy one if none is
+// configured. It reports whether the result still has to be recorded.
+func resolveTimezone(path string, recorded Timezone, hasData bool, configured, legacy Timezone) (Timezone, bool, error) {
+	zone, record := recorded, false
+	if zone == "" {
+		zone, record = legacy, true
+		if !hasData && configured != "" {
+			zone = configured
+		}
+	}
+	if configured != "" && configured != zone {
+		return zone, false, &TimezoneMismatchError{Path: path, Stored: zone, Configured: configured}
+	}
+	return zone, record, nil
+}
+
+// fileMetadataName is the metadata file of file-based stores. Names starting
+// with an underscore are skipped when listing series, as in Hive layouts.
+const fileMetadataName = "_metadata.json"
+
+// convertingExt marks files rewritten by a timezone conversion that has not
+// been committed yet.
+const convertingExt = ".tz"
+
+// fileMetadata is the content of a file store's _metadata.json.
+type fileMetadata struct {
+	Timezone Timezone `json:"timezone"`
+	// PendingTimezone is set while the converted files are being renamed into place
+	PendingTimezone Timezone `json:"pending_timezone,omitempty"`
+	// PathTemplate lays out the files of the store ("" = DefaultPathTemplate)
+	PathTemplate string `json:"path_template,omitempty"`
+}
+
+// readFileMetadata reads the metadata of a file store, finishing a timezone
+// conversion that was interrupted while its files were being renamed.
+func readFileMetadata(base string) (fileMetadata, error) {
+	var meta fileMetadata
+	data, err := os.ReadFile(filepath.Join(base, fileMetadataName))
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	if err != nil {
+		return meta, fmt.Errorf("failed to read storage metadata: %v", err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("failed to parse %s: %v", filepath.Join(base, fileMetadataName), err)
+	}
+	if meta.PendingTimezone != "" {
+		if err := renameConverted(base); err != nil {
+			return meta, err
+		}
+		meta.Timezone, meta.PendingTimezone = meta.PendingTimezone, ""
+		if err := writeFileMetadata(base, meta); err != nil {
+			return meta, err
+		}
+	}
+	return meta, nil
+}
+
+// writeFileMetadata atomically replaces the metadata of a file store.
+func writeFileMetadata(base string, meta fileMetadata) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(base, fileMetadataName), CompressionNone, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write storage metadata: %v", err)
+	}
+	return nil
+}
+
+// fileStoreTimezone returns the timezone of a file store for reading: the
+// recorded one, or the backend's legacy zone for stores from earlier releases.
+func fileStoreTimezone(base string, legacy Timezone) (Timezone, error) {
+	meta, err := readFileMetadata(base)
+	if err != nil {
+		return "", err
+	}
+	if meta.Timezone == "" {
+		return legacy, nil
+	}
+	return meta.Timezone, nil
+}
+
+// initFileTimezone resolves and records the timezone of a file store opened for writing.
+func initFileTimezone(base string, configured, legacy Timezone, hasData func() (bool, error)) (Timezone, error) {
+	meta, err := readFileMetadata(base)
+	if err != nil {
+		return "", err
+	}
+	stored := false
+	if meta.Timezone == "" {
+		if stored, err = hasData(); err != nil {
+			return "", err
+		}
+	}
+	zone, record, err := resolveTimezone(base, meta.Timezone, stored, configured, legacy)
+	if err != nil {
+		return "", err
+	}
+	if record {
+		meta.Timezone = zone
+		if err := writeFileMetadata(base, meta); err != nil {
+			return "", err
+		}
+	}
+	return zone, nil
+}
+
+// convertFiles rewrites every file of a file store with the given extension
+// (in any compression) through rewrite, and records the new timezone. All
+// files are first written next to the originals; the metadata then marks the
+// conversion as pending before the files are renamed into place, so an
+// interrupted conversion is completed by the next readFileMetadata.
+func convertFiles(base, ext string, to Timezone, rewrite func(data []byte) ([]byte, error)) (int, error) {
+	if err := removeConverted(base); err != nil {
+		return 0, err
+	}
+	meta, err := readFileMetadata(base)
+	if err != nil {
+		return 0, err
+	}
+
+	var files []string
+	err = filepath.WalkDir(base, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(trimCompressionExt(d.Name()), ext) && !strings.HasPrefix(d.Name(), "_") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, path := range files {
+		data, truncated, err := readFile(path)
+		if err != nil {
+			return 0, err
+		}
+		if truncated {
+			return 0, fmt.Errorf("%s ends in a partial compressed member; run a fetch or compaction first", path)
+		}
+		converted, err := rewrite(data)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", path, err)
+		}
+		if err := writeFileAtomic(path+convertingExt, compressionOf(path), converted); err != nil {
+			removeConverted(base)
+			return 0, fmt.Errorf("failed to write converted %s: %v", path, err)
+		}
+	}
+
+	meta.PendingTimezone = to
+	if err := writeFileMetadata(base, meta); err != nil {
+		removeConverted(base)
+		return 0, err
+	}
+	if err := renameConverted(base); err != nil {
+		return 0, err
+	}
+	meta.Timezone, meta.PendingTimezone = to, ""
+	if err := writeFileMetadata(base, meta); err != nil {
+		return 0, err
+	}
+	return len(files), nil
+}
+
+// renameConverted moves converted files over their originals.
+func renameConverted(base string) error {
+	return walkConverted(base, func(path string) error {
+		return os.Rename(path, strings.TrimSuffix(path, convertingExt))
+	})
+}
+
+// removeConverted deletes converted files left by a conversion that failed
+// before it was committed.
+func removeConverted(base string) error {
+	return walkConverted(base, os.Remove)
+}
+
+func walkConverted(base string, fn func(path string) error) error {
+	return filepath.WalkDir(base, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), convertingExt) {
+			return nil
+		}
+		if err := fn(path); err != nil {
+			return fmt.Errorf("failed to finish timezone conversion of %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// createSQLMetadata is the key/value table recording the settings of a database.
+const createSQLMetadata = `
+	CREATE TABLE IF NOT EXISTS storage_metadata (
+		key VARCHAR PRIMARY KEY,
+		value VARCHAR NOT NULL
+	);`
+
+// sqlMetadata reads a metadata value, returning "" if it is not set or the
+// metadata table does not exist yet.
+func sqlMetadata(db *sql.DB, key string) (string, error) {
+	var value string
+	err := db.QueryRow("SELECT value FROM storage_metadata WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "storage_metadata") {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read storage metadata: %v", err)
+	}
+	return value, nil
+}
+
+// setSQLMetadata writes a metadata value.
+func setSQLMetadata(exec interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, key, value string) error {
+	if _, err := exec.Exec("INSERT OR REPLACE INTO storage_metadata (key, value) VALUES (?, ?)", key, value); err != nil {
+		return fmt.Errorf("failed to write storage metadata: %v", err)
+	}
+	return nil
+}
+
+// initSQLTimezone resolves and records the timezone of a database opened for writing.
+func initSQLTimezone(db *sql.DB, path string, configured, legacy Timezone) (Timezone, error) {
+	recorded, err := sqlMetadata(db, "timezone")
+	if err != nil {
+		return "", err
+	}
+	hasData := false
+	if recorded == "" {
+		if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM ohlcv)").Scan(&hasData); err != nil {
+			return "", fmt.Errorf("failed to inspect ohlcv table: %v", err)
+		}
+	}
+	zone, record, err := resolveTimezone(path, Timezone(recorded), hasData, configured, legacy)
+	if err != nil {
+		return "", err
+	}
+	if record {
+		if err := setSQLMetadata(db, "timezone", string(zone)); err != nil {
+			return "", err
+		}
+	}
+	return zone, nil
+}
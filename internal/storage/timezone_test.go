@@ -0,0 +1,438 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"zerodha-connect/internal/calendar"
+
+	kiteconnect "github.com/zerodha/gokiteconnect/v4"
+	"github.com/zerodha/gokiteconnect/v4/models"
+)
+
+func TestResolveTimezone(t *testing.T) {
+	tests := []struct {
+		name       string
+		recorded   Timezone
+		hasData    bool
+		configured Timezone
+		zone       Timezone
+		record     bool
+		mismatch   bool
+	}{
+		{"new store, nothing configured", "", false, "", TimezoneIST, true, false},
+		{"new store, configured", "", false, TimezoneUTC, TimezoneUTC, true, false},
+		{"legacy store, nothing configured", "", true, "", TimezoneIST, true, false},
+		{"legacy store, legacy zone configured", "", true, TimezoneIST, TimezoneIST, true, false},
+		{"legacy store, other zone configured", "", true, TimezoneUTC, TimezoneIST, false, true},
+		{"recorded, nothing configured", TimezoneUTC, true, "", TimezoneUTC, false, false},
+		{"recorded, same zone configured", TimezoneUTC, true, TimezoneUTC, TimezoneUTC, false, false},
+		{"recorded, other zone configured", TimezoneUTC, false, TimezoneIST, TimezoneUTC, false, true},
+	}
+	for _, tt := range tests {
+		zone, record, err := resolveTimezone("store", tt.recorded, tt.hasData, tt.configured, TimezoneIST)
+		var mismatch *TimezoneMismatchError
+		if tt.mismatch != errors.As(err, &mismatch) || (err != nil && !tt.mismatch) {
+			t.Errorf("%s: error %v, want mismatch %v", tt.name, err, tt.mismatch)
+			continue
+		}
+		if zone != tt.zone || record != tt.record {
+			t.Errorf("%s: = %s, record %v, want %s, record %v", tt.name, zone, record, tt.zone, tt.record)
+		}
+	}
+}
+
+// timezoneCandles are two candles of a session, whose IST and UTC wall times
+// fall on different days for the second one.
+var timezoneCandles = []kiteconnect.HistoricalData{
+	{Date: models.Time{Time: time.Date(2024, 1, 2, 9, 15, 0, 0, calendar.IST)}, Open: 1, High: 2, Low: 0.5, Close: 1.5, Volume: 10},
+	{Date: models.Time{Time: time.Date(2024, 1, 3, 5, 0, 0, 0, calendar.IST)}, Open: 2, High: 3, Low: 1.5, Close: 2.5, Volume: 20},
+}
+
+// storedWallTimes returns the wall times of timezoneCandles a store holds, as
+// "YYYY-MM-DD HH:MM": read from the timestamp column of a database, or found
+// in the files of a file store in their IST or UTC wall time.
+func storedWallTimes(t *testing.T, storageType StorageType, path string) []string {
+	t.Helper()
+	if storageType == StorageTypeDuckDB {
+		db, err := sql.Open("duckdb", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		rows, err := db.Query("SELECT strftime(timestamp, '%Y-%m-%d %H:%M') FROM ohlcv ORDER BY timestamp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var times []string
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatal(err)
+			}
+			times = append(times, s)
+		}
+		return times
+	}
+
+	var times []string
+	err := filepath.WalkDir(path, func(file string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), "_") {
+			return err
+		}
+		data, _, err := readFile(file)
+		if err != nil {
+			return err
+		}
+		for _, wall := range []string{"2024-01-02 09:15", "2024-01-02T09:15", "2024-01-02 03:45", "2024-01-02T03:45",
+			"2024-01-03 05:00", "2024-01-03T05:00", "2024-01-02 23:30", "2024-01-02T23:30"} {
+			if strings.Contains(string(data), wall) {
+				times = append(times, strings.Replace(wall, "T", " ", 1))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(times)
+	return times
+}
+
+// TestConvertTimezoneRoundTrip converts every store recording a timezone from
+// IST to UTC and back, checking the stored wall times and that the candles
+// read back at the same instants.
+func TestConvertTimezoneRoundTrip(t *testing.T) {
+	series := Series{Exchange: "NSE", Symbol: "SBIN", Interval: "minute"}
+	wallTimes := map[Timezone][]string{
+		TimezoneIST: {"2024-01-02 09:15", "2024-01-03 05:00"},
+		TimezoneUTC: {"2024-01-02 03:45", "2024-01-02 23:30"},
+	}
+
+	for _, backend := range Backends() {
+		if !slices.Contains(backend.Schema.Timezones, TimezoneIST) {
+			continue
+		}
+		t.Run(string(backend.Name), func(t *testing.T) {
+			logger := log.New(io.Discard, "", 0)
+			path := filepath.Join(t.TempDir(), "market_data")
+			store, err := NewStore(backend.Name, path, Options{Timezone: TimezoneIST}, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Init(); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			if _, err := store.StoreCandles(series, timezoneCandles); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := storedWallTimes(t, backend.Name, path); !slices.Equal(got, wallTimes[TimezoneIST]) {
+				t.Fatalf("IST store holds %v, want %v", got, wallTimes[TimezoneIST])
+			}
+
+			for _, to := range []Timezone{TimezoneUTC, TimezoneIST} {
+				// As 'storage timezone --to' does: a store opened without Init
+				store, err := NewStore(backend.Name, path, Options{}, logger)
+				if err != nil {
+					t.Fatal(err)
+				}
+				converter := store.(TimezoneConverter)
+				if err := converter.ConvertTimezone(to); err != nil {
+					t.Fatalf("ConvertTimezone(%s): %v", to, err)
+				}
+				if err := store.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if got := storedWallTimes(t, backend.Name, path); !slices.Equal(got, wallTimes[to]) {
+					t.Errorf("%s store holds %v, want %v", to, got, wallTimes[to])
+				}
+
+				reader, err := OpenReader(backend.Name, path, logger)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if zone, err := reader.(TimezoneConverter).StoredTimezone(); err != nil || zone != to {
+					t.Errorf("StoredTimezone = %s, %v, want %s", zone, err, to)
+				}
+				var got []time.Time
+				err = reader.ReadRange(series, time.Time{}, time.Time{}, func(c Candle) error {
+					got = append(got, c.Timestamp)
+					return nil
+				})
+				reader.Close()
+				if err != nil {
+					t.Fatalf("ReadRange: %v", err)
+				}
+				if len(got) != len(timezoneCandles) {
+					t.Fatalf("read %d candles in %s, want %d", len(got), to, len(timezoneCandles))
+				}
+				for i, ts := range got {
+					if !ts.Equal(timezoneCandles[i].Date.Time) {
+						t.Errorf("candle %d read at %s in %s, want %s", i, ts, to, timezoneCandles[i].Date.Time)
+					}
+				}
+			}
+
+			// Writing with the old zone configured is refused
+			store, err = NewStore(backend.Name, path, Options{Timezone: TimezoneUTC}, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			var mismatch *TimezoneMismatchError
+			if err := store.Init(); !errors.As(err, &mismatch) {
+				t.Errorf("Init with storage timezone UTC = %v, want a mismatch", err)
+			}
+		})
+	}
+}
+
+// TestConvertTimezoneUnsupported accepts UTC and rejects IST for stores
+// holding zone-independent timestamps.
+func TestConvertTimezoneUnsupported(t *testing.T) {
+	for _, name := range []StorageType{StorageTypeSQLite, StorageTypeParquet} {
+		store, err := NewStore(name, filepath.Join(t.TempDir(), "market_data"), Options{}, log.New(io.Discard, "", 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		converter := store.(TimezoneConverter)
+		if zone, err := converter.StoredTimezone(); err != nil || zone != TimezoneUTC {
+			t.Errorf("%s StoredTimezone = %s, %v, want UTC", name, zone, err)
+		}
+		if err := converter.ConvertTimezone(TimezoneUTC); err != nil {
+			t.Errorf("%s ConvertTimezone(UTC): %v", name, err)
+		}
+		if err := converter.ConvertTimezone(TimezoneIST); err == nil {
+			t.Errorf("%s ConvertTimezone(IST) succeeded", name)
+		}
+		store.Close()
+	}
+}
+
+// TestInterruptedTimezoneConversion leaves a CSV store as a conversion that
+// stopped before or after it was committed, and expects readers and the next
+// conversion to end up with consistent files.
+func TestInterruptedTimezoneConversion(t *testing.T) {
+	series := Series{Exchange: "NSE", Symbol: "SBIN", Interval: "minute"}
+	logger := log.New(io.Discard, "", 0)
+
+	// newStore writes the candles to a CSV store in zone
+	newStore := func(t *testing.T, zone Timezone) string {
+		path := filepath.Join(t.TempDir(), "market_data")
+		store, err := NewCSVStore(path, Options{Timezone: zone}, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.StoreCandles(series, timezoneCandles); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// stageConversion writes the UTC files of a conversion of the IST store next to its files
+	stageConversion := func(t *testing.T, path string) {
+		converted, err := os.ReadFile(filepath.Join(newStore(t, TimezoneUTC), "NSE", "minute", "SBIN.csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(path, "NSE", "minute", "SBIN.csv"+convertingExt), converted, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readAll := func(t *testing.T, path string) (Timezone, []time.Time) {
+		t.Helper()
+		reader, err := OpenReader(StorageTypeCSV, path, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+		zone, err := reader.(TimezoneConverter).StoredTimezone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		series, err := reader.ListSeries()
+		if err != nil || len(series) != 1 {
+			t.Fatalf("ListSeries = %v, %v, want one series", series, err)
+		}
+		var times []time.Time
+		err = reader.ReadRange(series[0], time.Time{}, time.Time{}, func(c Candle) error {
+			times = append(times, c.Timestamp)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return zone, times
+	}
+	checkCandles := func(t *testing.T, times []time.Time) {
+		t.Helper()
+		if len(times) != len(timezoneCandles) {
+			t.Fatalf("read %d candles, want %d", len(times), len(timezoneCandles))
+		}
+		for i, ts := range times {
+			if !ts.Equal(timezoneCandles[i].Date.Time) {
+				t.Errorf("candle %d read at %s, want %s", i, ts, timezoneCandles[i].Date.Time)
+			}
+		}
+	}
+	leftover := func(path string) bool {
+		_, err := os.Stat(filepath.Join(path, "NSE", "minute", "SBIN.csv"+convertingExt))
+		return err == nil
+	}
+
+	t.Run("committed", func(t *testing.T) {
+		// The metadata marks the conversion as pending: readers finish it
+		path := newStore(t, TimezoneIST)
+		stageConversion(t, path)
+		if err := writeFileMetadata(path, fileMetadata{Timezone: TimezoneIST, PendingTimezone: TimezoneUTC}); err != nil {
+			t.Fatal(err)
+		}
+
+		zone, times := readAll(t, path)
+		if zone != TimezoneUTC {
+			t.Errorf("StoredTimezone = %s, want UTC", zone)
+		}
+		checkCandles(t, times)
+		if leftover(path) {
+			t.Error("converted file was not renamed into place")
+		}
+		if got := storedWallTimes(t, StorageTypeCSV, path); !slices.Equal(got, []string{"2024-01-02 03:45", "2024-01-02 23:30"}) {
+			t.Errorf("store holds %v, want UTC wall times", got)
+		}
+		meta, err := readFileMetadata(path)
+		if err != nil || meta.Timezone != TimezoneUTC || meta.PendingTimezone != "" {
+			t.Errorf("metadata = %+v, %v, want UTC without a pending zone", meta, err)
+		}
+	})
+
+	t.Run("not committed", func(t *testing.T) {
+		// Converted files without a pending zone are ignored, and removed by the next conversion
+		path := newStore(t, TimezoneIST)
+		stageConversion(t, path)
+
+		zone, times := readAll(t, path)
+		if zone != TimezoneIST {
+			t.Errorf("StoredTimezone = %s, want Asia/Kolkata", zone)
+		}
+		checkCandles(t, times)
+
+		store, err := NewCSVStore(path, Options{}, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ConvertTimezone(TimezoneUTC); err != nil {
+			t.Fatalf("ConvertTimezone: %v", err)
+		}
+		store.Close()
+		if leftover(path) {
+			t.Error("converted file of the interrupted conversion was left behind")
+		}
+		zone, times = readAll(t, path)
+		if zone != TimezoneUTC {
+			t.Errorf("StoredTimezone after conversion = %s, want UTC", zone)
+		}
+		checkCandles(t, times)
+	})
+}
+
+// TestLegacyTimezone opens stores written before timezones were recorded:
+// their timestamps are in the backend's legacy zone, whatever is configured
+// for new stores.
+func TestLegacyTimezone(t *testing.T) {
+	series := Series{Exchange: "NSE", Symbol: "SBIN", Interval: "minute"}
+	logger := log.New(io.Discard, "", 0)
+	tests := []struct {
+		storageType StorageType
+		legacy      Timezone
+		forget      func(t *testing.T, path string) // Removes the recorded timezone
+	}{
+		{StorageTypeCSV, TimezoneIST, func(t *testing.T, path string) {
+			if err := writeFileMetadata(path, fileMetadata{}); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{StorageTypeDuckDB, TimezoneUTC, func(t *testing.T, path string) {
+			db, err := sql.Open("duckdb", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if _, err := db.Exec("DROP TABLE storage_metadata"); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.storageType), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "market_data")
+			store, err := NewStore(tt.storageType, path, Options{Timezone: tt.legacy}, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Init(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.StoreCandles(series, timezoneCandles); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+			tt.forget(t, path)
+
+			// The other zone is refused for a store holding data
+			other := TimezoneUTC
+			if tt.legacy == TimezoneUTC {
+				other = TimezoneIST
+			}
+			store, err = NewStore(tt.storageType, path, Options{Timezone: other}, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var mismatch *TimezoneMismatchError
+			if err := store.Init(); !errors.As(err, &mismatch) || mismatch.Stored != tt.legacy {
+				t.Errorf("Init with storage timezone %s = %v, want a mismatch with %s", other, err, tt.legacy)
+			}
+			store.Close()
+
+			// Without a configured zone, the legacy zone is recorded
+			store, err = NewStore(tt.storageType, path, Options{}, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Init(); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			zone, err := store.(TimezoneConverter).StoredTimezone()
+			if err != nil || zone != tt.legacy {
+				t.Errorf("StoredTimezone = %s, %v, want %s", zone, err, tt.legacy)
+			}
+			var got []time.Time
+			err = store.(Reader).ReadRange(series, time.Time{}, time.Time{}, func(c Candle) error {
+				got = append(got, c.Timestamp)
+				return nil
+			})
+			store.Close()
+			if err != nil || len(got) != len(timezoneCandles) || !got[0].Equal(timezoneCandles[0].Date.Time) {
+				t.Errorf("ReadRange = %v, %v", got, err)
+			}
+		})
+	}
+}
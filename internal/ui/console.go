@@ -6,9 +6,14 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
 )
 
+// stdin is shared by prompts that may be asked several times in a row, so
+// that answers piped in on consecutive lines are not lost to buffering.
+var stdin = bufio.NewReader(os.Stdin)
+
 // OpenBrowser opens the specified URL in the user's default browser.
 func OpenBrowser(url string) error {
 	var cmd string
@@ -57,9 +62,13 @@ func GetRequestToken(loginURL string) (string, error) {
 // FetchPlan holds the details for the data fetching operation to be confirmed by the user.
 type FetchPlan struct {
 	ValidInstruments          int
+	CustomInstruments         int // instruments overriding the job's settings
+	Units                     int // instrument × interval combinations to fetch
 	FromDate                  string
 	ToDate                    string
+	Windows                   int
 	Interval                  string
+	Intervals                 []IntervalEstimate
 	RateLimitPerSecond        int
 	ChunkExplanation          string
 	ChunkSizeInfo             string
@@ -69,14 +78,31 @@ type FetchPlan struct {
 	EstimatedRemainingSeconds int
 }
 
+// IntervalEstimate is the share of one interval in a FetchPlan.
+type IntervalEstimate struct {
+	Interval    string
+	Instruments int
+	APICalls    int
+}
+
 // ConfirmExecution displays the fetching plan and asks for user confirmation.
 func ConfirmExecution(plan FetchPlan) bool {
 	fmt.Println("\n" + strings.Repeat("=", 60))
 	fmt.Println("📈 DATA FETCHING PLAN")
 	fmt.Println(strings.Repeat("=", 60))
 	fmt.Printf("🎯 Valid instruments: %d\n", plan.ValidInstruments)
+	if plan.CustomInstruments > 0 {
+		fmt.Printf("🛠️  With their own settings: %d\n", plan.CustomInstruments)
+	}
 	fmt.Printf("📅 Date range: %s to %s\n", plan.FromDate, plan.ToDate)
-	fmt.Printf("⏱️  Interval: %s\n", plan.Interval)
+	if plan.Windows > 1 {
+		fmt.Printf("🗓️  Time windows: %d\n", plan.Windows)
+	}
+	if len(plan.Intervals) > 1 {
+		fmt.Printf("⏱️  Intervals: %s (%d instrument × interval units)\n", plan.Interval, plan.Units)
+	} else {
+		fmt.Printf("⏱️  Interval: %s\n", plan.Interval)
+	}
 	fmt.Println()
 	fmt.Println("🧩 CHUNKING STRATEGY:")
 	fmt.Printf("  • API Rate Limit: %d requests/second globally\n", plan.RateLimitPerSecond)
@@ -86,6 +112,11 @@ func ConfirmExecution(plan FetchPlan) bool {
 	fmt.Printf("  • Result: %d total chunks across all instruments\n", plan.TotalAPICalls)
 	fmt.Println()
 	fmt.Printf("📡 Total API calls needed: %d\n", plan.TotalAPICalls)
+	if len(plan.Intervals) > 1 {
+		for _, estimate := range plan.Intervals {
+			fmt.Printf("  • %s: %d calls for %d instruments\n", estimate.Interval, estimate.APICalls, estimate.Instruments)
+		}
+	}
 	if plan.EstimatedMinutes > 0 {
 		fmt.Printf("⏳ Estimated time: ~%d minutes %d seconds\n", plan.EstimatedMinutes, plan.EstimatedRemainingSeconds)
 	} else {
@@ -105,29 +136,34 @@ func ConfirmExecution(plan FetchPlan) bool {
 	return response == "y" || response == "yes"
 }
 
-// ConfirmAuthRestart asks the user if they want to restart the authentication process
-func ConfirmAuthRestart() bool {
-	fmt.Println("\n" + strings.Repeat("=", 60))
-	fmt.Println("🚨 AUTHENTICATION PROBLEM")
-	fmt.Println(strings.Repeat("=", 60))
-	fmt.Println("❌ Your request token appears to be expired or invalid.")
-	fmt.Println("🔑 API key and secret are present in your configuration.")
-	fmt.Println("")
-	fmt.Println("To proceed, you need to start the authentication process again.")
-	fmt.Println("This will:")
-	fmt.Println("  • Open your browser for Zerodha login")
-	fmt.Println("  • Generate a new request token")
-	fmt.Println("  • Save the new token to your config file")
-	fmt.Println(strings.Repeat("=", 60))
-	fmt.Print("Do you want to start the authentication process? (y/N): ")
+// ChooseReplacement lists suggested replacements for a symbol and asks which
+// one to use. It returns the chosen index, or -1 to keep the symbol as is.
+func ChooseReplacement(symbol string, options []string) int {
+	fmt.Printf("\n🔧 %s was not found. Replace it with:\n", symbol)
+	for i, option := range options {
+		fmt.Printf("  %d) %s\n", i+1, option)
+	}
+	if len(options) == 1 {
+		fmt.Print("Apply this fix? (Y/n): ")
+	} else {
+		fmt.Printf("Choose 1-%d, or press Enter to skip: ", len(options))
+	}
 
-	reader := bufio.NewReader(os.Stdin)
-	response, err := reader.ReadString('\n')
-	if err != nil {
-		fmt.Printf("Failed to read user input: %v\n", err)
-		return false
+	response, err := stdin.ReadString('\n')
+	if err != nil && response == "" {
+		return -1
 	}
 	response = strings.TrimSpace(strings.ToLower(response))
 
-	return response == "y" || response == "yes"
+	if len(options) == 1 {
+		if response == "" || response == "y" || response == "yes" {
+			return 0
+		}
+		return -1
+	}
+	choice, err := strconv.Atoi(response)
+	if err != nil || choice < 1 || choice > len(options) {
+		return -1
+	}
+	return choice - 1
 }
@@ -0,0 +1,13 @@
+// Package cli runs the zerodha-connect command line from another module,
+// e.g. a main package that registers extra storage backends first (see
+// zerodha-connect/pkg/storage).
+package cli
+
+import (
+	internal "zerodha-connect/internal/cli"
+)
+
+// Execute runs the zerodha-connect command line and exits on error.
+func Execute() {
+	internal.Execute()
+}
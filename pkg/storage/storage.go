@@ -0,0 +1,88 @@
+// Package storage lets other Go modules add storage backends to
+// zerodha-connect. A backend registered here can be selected with
+// storage_type like the built-in ones, and shows up in validation and the
+// storage command:
+//
+//	func init() {
+//		storage.Register(storage.Backend{
+//			Name:   "mydb",
+//			New:    newMyDBStore,
+//			Schema: storage.Schema{DefaultPath: "market_data.mydb"},
+//		})
+//	}
+//
+//	func main() {
+//		cli.Execute() // zerodha-connect/pkg/cli
+//	}
+//
+// A backend's store must implement Store; implementing Reader makes it usable
+// by query, convert and the storage commands as well, and implementing
+// RunRecorder keeps the history of the fetch runs writing it. Options.RunID
+// is the run whose ID a store should stamp on the candles it writes. A store
+// implementing IncompleteStorer can keep candles still forming, flagged
+// until the next write of their timestamps replaces them, and one
+// implementing LineageStorer keeps the lineage of candles copied by convert.
+package storage
+
+import (
+	internal "zerodha-connect/internal/storage"
+)
+
+// Types implemented or used by storage backends.
+type (
+	Store             = internal.Store
+	Reader            = internal.Reader
+	Compactor         = internal.Compactor
+	TimezoneConverter = internal.TimezoneConverter
+	RunRecorder       = internal.RunRecorder
+	IncompleteStorer  = internal.IncompleteStorer
+	LineageStorer     = internal.LineageStorer
+	FetchRun          = internal.FetchRun
+	InstrumentResult  = internal.InstrumentResult
+	Series            = internal.Series
+	Candle            = internal.Candle
+	Coverage          = internal.Coverage
+	Options           = internal.Options
+	Compression       = internal.Compression
+	Timezone          = internal.Timezone
+	StorageType       = internal.StorageType
+	Backend           = internal.Backend
+	Schema            = internal.Schema
+	Description       = internal.Description
+)
+
+// Compressions and timezones of Options.
+const (
+	CompressionNone = internal.CompressionNone
+	CompressionGzip = internal.CompressionGzip
+	CompressionZstd = internal.CompressionZstd
+
+	TimezoneUTC = internal.TimezoneUTC
+	TimezoneIST = internal.TimezoneIST
+)
+
+// DefaultPathTemplate is the layout of file stores without a path template.
+const DefaultPathTemplate = internal.DefaultPathTemplate
+
+// Status of a FetchRun.
+const (
+	RunRunning   = internal.RunRunning
+	RunCompleted = internal.RunCompleted
+	RunFailed    = internal.RunFailed
+)
+
+// Register makes a backend available under its name. It panics when the name
+// is empty or already registered, or the backend has no constructor.
+func Register(b Backend) {
+	internal.Register(b)
+}
+
+// Lookup returns the backend registered under a name.
+func Lookup(name StorageType) (Backend, bool) {
+	return internal.Lookup(name)
+}
+
+// Backends returns every registered backend, sorted by name.
+func Backends() []Backend {
+	return internal.Backends()
+}